@@ -3,59 +3,123 @@ package queues
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 	"hotels-api/domain/hotels"
 	"log"
+	"sync"
+	"time"
 )
 
 type RabbitConfig struct {
-	Host      string
-	Port      string
-	Username  string
-	Password  string
-	QueueName string
+	Host           string
+	Port           string
+	Username       string
+	Password       string
+	QueueName      string
+	ConfirmTimeout time.Duration // How long a publish waits for the broker to confirm it
 }
 
 type Rabbit struct {
 	connection *amqp.Connection
 	channel    *amqp.Channel
 	queue      amqp.Queue
+	config     RabbitConfig
+	confirms   chan amqp.Confirmation
+	publishing *sync.Mutex
+	published  *uint64 // Delivery tag of the last message published on the channel
 }
 
 func NewRabbit(config RabbitConfig) Rabbit {
 	connection, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%s/", config.Username, config.Password, config.Host, config.Port))
 	if err != nil {
-		log.Fatalf("error getting Rabbit connection: %w", err)
+		log.Fatalf("error getting Rabbit connection: %v", err)
 	}
 	channel, err := connection.Channel()
 	if err != nil {
-		log.Fatalf("error creating Rabbit channel: %w", err)
+		log.Fatalf("error creating Rabbit channel: %v", err)
+	}
+
+	// Durable, along with persistent messages the events survive a broker restart
+	queue, err := channel.QueueDeclare(config.QueueName, true, false, false, false, nil)
+	if err != nil {
+		log.Fatalf("error declaring Rabbit queue: %v", err)
+	}
+
+	// Have the broker confirm every message once it has taken responsibility for it
+	if err := channel.Confirm(false); err != nil {
+		log.Fatalf("error enabling Rabbit publisher confirms: %v", err)
 	}
-	queue, err := channel.QueueDeclare(config.QueueName, false, false, false, false, nil)
 	return Rabbit{
 		connection: connection,
 		channel:    channel,
 		queue:      queue,
+		config:     config,
+		confirms:   channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		publishing: &sync.Mutex{},
+		published:  new(uint64),
 	}
 }
 
+// Publish sends the event in the current envelope, stamping the ID and time the events
+// produced outside the outbox don't have yet. It returns once the broker confirms the
+// message, so a nil error means the event won't be lost
 func (queue Rabbit) Publish(hotelNew hotels.HotelNew) error {
+	hotelNew.SchemaVersion = hotels.EventSchemaVersion
+	if hotelNew.EventID == "" {
+		hotelNew.EventID = uuid.New().String()
+	}
+	if hotelNew.Timestamp.IsZero() {
+		hotelNew.Timestamp = time.Now().UTC()
+	}
 	bytes, err := json.Marshal(hotelNew)
 	if err != nil {
-		return fmt.Errorf("error marshaling Rabbit hotelNew: %w", err)
+		return fmt.Errorf("%w: error marshaling Rabbit hotelNew: %v", hotels.ErrInvalidEvent, err)
 	}
+
+	// Confirmations arrive in publishing order, one message is in flight at a time
+	queue.publishing.Lock()
+	defer queue.publishing.Unlock()
 	if err := queue.channel.Publish(
 		"",
 		queue.queue.Name,
 		false,
 		false,
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        bytes,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    hotelNew.EventID,
+			Timestamp:    hotelNew.Timestamp,
+			Body:         bytes,
 		}); err != nil {
 		return fmt.Errorf("error publishing to Rabbit: %w", err)
 	}
-	return nil
+	*queue.published++
+	return queue.waitConfirm(*queue.published)
+}
+
+// waitConfirm waits for the broker to confirm the message with the given delivery tag,
+// skipping the late confirmations of the messages that timed out before it
+func (queue Rabbit) waitConfirm(tag uint64) error {
+	timeout := time.NewTimer(queue.config.ConfirmTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case confirmation, ok := <-queue.confirms:
+			if !ok {
+				return fmt.Errorf("error publishing to Rabbit: channel closed before the confirmation")
+			}
+			if confirmation.DeliveryTag < tag {
+				continue
+			}
+			if !confirmation.Ack {
+				return fmt.Errorf("error publishing to Rabbit: message rejected by the broker")
+			}
+			return nil
+		case <-timeout.C:
+			return fmt.Errorf("error publishing to Rabbit: no confirmation after %s", queue.config.ConfirmTimeout)
+		}
+	}
 }
 
 // Close cleans up the RabbitMQ resources
@@ -2,18 +2,31 @@ package hotels
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	hotelsDomain "hotels-api/domain/hotels"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+
+	// exportFlushSize is how many exported hotels are buffered before flushing them to the client
+	exportFlushSize = 100
+)
+
 type Service interface {
 	GetHotelByID(ctx context.Context, id string) (hotelsDomain.Hotel, error)
+	List(ctx context.Context, request hotelsDomain.ListRequest) (hotelsDomain.ListResponse, error)
 	Create(ctx context.Context, hotel hotelsDomain.Hotel) (string, error)
-	Update(ctx context.Context, hotel hotelsDomain.Hotel) error
+	Update(ctx context.Context, id string, request hotelsDomain.UpdateRequest) error
 	Delete(ctx context.Context, id string) error
+	Export(ctx context.Context, fn func(hotel hotelsDomain.Hotel) error) error
 }
 
 type Controller struct {
@@ -43,6 +56,100 @@ func (controller Controller) GetHotelByID(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, hotel)
 }
 
+func (controller Controller) List(ctx *gin.Context) {
+	// Parse filters
+	request := hotelsDomain.ListRequest{
+		City:   strings.TrimSpace(ctx.Query("city")),
+		State:  strings.TrimSpace(ctx.Query("state")),
+		Sort:   strings.TrimSpace(ctx.Query("sort")),
+		Cursor: strings.TrimSpace(ctx.Query("cursor")),
+		Limit:  defaultListLimit,
+	}
+	if minRating := ctx.Query("min_rating"); minRating != "" {
+		value, err := strconv.ParseFloat(minRating, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid min_rating: %s", err.Error()),
+			})
+			return
+		}
+		request.MinRating = value
+	}
+	if amenities := ctx.Query("amenities"); amenities != "" {
+		for _, amenity := range strings.Split(amenities, ",") {
+			if amenity = strings.TrimSpace(amenity); amenity != "" {
+				request.Amenities = append(request.Amenities, amenity)
+			}
+		}
+	}
+
+	// Validate sort
+	switch request.Sort {
+	case hotelsDomain.SortByID, hotelsDomain.SortByName, hotelsDomain.SortByNameDesc,
+		hotelsDomain.SortByRating, hotelsDomain.SortByRatingDesc:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid sort: %s", request.Sort),
+		})
+		return
+	}
+
+	// Validate limit
+	if limit := ctx.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid limit: %s", limit),
+			})
+			return
+		}
+		request.Limit = min(value, maxListLimit)
+	}
+
+	// List hotels using the service
+	response, err := controller.service.List(ctx.Request.Context(), request)
+	if errors.Is(err, hotelsDomain.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error listing hotels: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Export streams every hotel as newline delimited JSON. The status is sent before the first
+// hotel, so a failure halfway is reported as a last line holding only an error
+func (controller Controller) Export(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	exported := 0
+	err := controller.service.Export(ctx.Request.Context(), func(hotel hotelsDomain.Hotel) error {
+		if err := encoder.Encode(hotel); err != nil {
+			return fmt.Errorf("error writing hotel: %w", err)
+		}
+		if exported++; exported%exportFlushSize == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		_ = encoder.Encode(gin.H{
+			"error": fmt.Sprintf("error exporting hotels: %s", err.Error()),
+		})
+	}
+	ctx.Writer.Flush()
+}
+
 func (controller Controller) Create(ctx *gin.Context) {
 	// Parse hotel
 	var hotel hotelsDomain.Hotel
@@ -55,6 +162,12 @@ func (controller Controller) Create(ctx *gin.Context) {
 
 	// Create hotel
 	id, err := controller.service.Create(ctx.Request.Context(), hotel)
+	if errors.Is(err, hotelsDomain.ErrInvalidLocation) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("error creating hotel: %s", err.Error()),
@@ -72,20 +185,24 @@ func (controller Controller) Update(ctx *gin.Context) {
 	// Validate ID param
 	id := strings.TrimSpace(ctx.Param("id"))
 
-	// Parse hotel
-	var hotel hotelsDomain.Hotel
-	if err := ctx.ShouldBindJSON(&hotel); err != nil {
+	// Parse the fields to update
+	var request hotelsDomain.UpdateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("invalid request: %s", err.Error()),
 		})
 		return
 	}
 
-	// Set the ID from the URL to the hotel object
-	hotel.ID = id
-
 	// Update hotel
-	if err := controller.service.Update(ctx.Request.Context(), hotel); err != nil {
+	err := controller.service.Update(ctx.Request.Context(), id, request)
+	if errors.Is(err, hotelsDomain.ErrInvalidLocation) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("error updating hotel: %s", err.Error()),
 		})
@@ -0,0 +1,165 @@
+package reservations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	reservationsDomain "hotels-api/domain/reservations"
+	"hotels-api/middlewares/auth"
+	"net/http"
+	"strings"
+)
+
+const (
+	// exportFlushSize is how many exported stays are buffered before flushing them to the client
+	exportFlushSize = 100
+)
+
+type Service interface {
+	GetReservationByID(ctx context.Context, userID int64, id string) (reservationsDomain.Reservation, error)
+	ListByUserID(ctx context.Context, userID int64) ([]reservationsDomain.Reservation, error)
+	Create(ctx context.Context, reservation reservationsDomain.Reservation) (string, error)
+	Cancel(ctx context.Context, userID int64, id string) error
+	ExportStays(ctx context.Context, fn func(stay reservationsDomain.Stay) error) error
+}
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) Controller {
+	return Controller{
+		service: service,
+	}
+}
+
+func (controller Controller) GetReservationByID(ctx *gin.Context) {
+	// Get the user authenticated by the middleware
+	userID := auth.UserID(ctx.Request.Context())
+
+	// Validate ID param
+	id := strings.TrimSpace(ctx.Param("id"))
+
+	// Get reservation by ID using the service
+	reservation, err := controller.service.GetReservationByID(ctx.Request.Context(), userID, id)
+	if err != nil {
+		ctx.JSON(statusFor(err), gin.H{
+			"error": fmt.Sprintf("error getting reservation: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, reservation)
+}
+
+func (controller Controller) List(ctx *gin.Context) {
+	// Get the user authenticated by the middleware
+	userID := auth.UserID(ctx.Request.Context())
+
+	// List the reservations of the user
+	reservations, err := controller.service.ListByUserID(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error listing reservations: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, reservations)
+}
+
+func (controller Controller) Create(ctx *gin.Context) {
+	// Get the user authenticated by the middleware
+	userID := auth.UserID(ctx.Request.Context())
+
+	// Parse reservation
+	var reservation reservationsDomain.Reservation
+	if err := ctx.ShouldBindJSON(&reservation); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
+
+	// Reservations are always made for the authenticated user
+	reservation.UserID = userID
+
+	// Create reservation
+	id, err := controller.service.Create(ctx.Request.Context(), reservation)
+	if err != nil {
+		ctx.JSON(statusFor(err), gin.H{
+			"error": fmt.Sprintf("error creating reservation: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send ID
+	ctx.JSON(http.StatusCreated, gin.H{
+		"id": id,
+	})
+}
+
+func (controller Controller) Cancel(ctx *gin.Context) {
+	// Get the user authenticated by the middleware
+	userID := auth.UserID(ctx.Request.Context())
+
+	// Validate ID param
+	id := strings.TrimSpace(ctx.Param("id"))
+
+	// Cancel reservation
+	if err := controller.service.Cancel(ctx.Request.Context(), userID, id); err != nil {
+		ctx.JSON(statusFor(err), gin.H{
+			"error": fmt.Sprintf("error cancelling reservation: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": id,
+	})
+}
+
+// Export streams the stay of every confirmed reservation that hasn't checked out yet as newline
+// delimited JSON. The status is sent before the first stay, so a failure halfway is reported as
+// a last line holding only an error
+func (controller Controller) Export(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	exported := 0
+	err := controller.service.ExportStays(ctx.Request.Context(), func(stay reservationsDomain.Stay) error {
+		if err := encoder.Encode(stay); err != nil {
+			return fmt.Errorf("error writing stay: %w", err)
+		}
+		if exported++; exported%exportFlushSize == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		_ = encoder.Encode(gin.H{
+			"error": fmt.Sprintf("error exporting reservations: %s", err.Error()),
+		})
+	}
+	ctx.Writer.Flush()
+}
+
+// statusFor maps service errors to HTTP status codes
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, reservationsDomain.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, reservationsDomain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, reservationsDomain.ErrNotAvailable), errors.Is(err, reservationsDomain.ErrNotCancellable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
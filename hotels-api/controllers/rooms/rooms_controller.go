@@ -0,0 +1,203 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	roomsDomain "hotels-api/domain/rooms"
+	"net/http"
+	"strings"
+)
+
+const (
+	// exportFlushSize is how many exported rooms are buffered before flushing them to the client
+	exportFlushSize = 100
+)
+
+type Service interface {
+	GetRoomByID(ctx context.Context, hotelID string, id string) (roomsDomain.Room, error)
+	ListByHotelID(ctx context.Context, hotelID string) ([]roomsDomain.Room, error)
+	Create(ctx context.Context, room roomsDomain.Room) (string, error)
+	Update(ctx context.Context, room roomsDomain.Room) error
+	Delete(ctx context.Context, hotelID string, id string) error
+	Export(ctx context.Context, fn func(room roomsDomain.Room) error) error
+}
+
+type Controller struct {
+	service Service
+}
+
+func NewController(service Service) Controller {
+	return Controller{
+		service: service,
+	}
+}
+
+func (controller Controller) GetRoomByID(ctx *gin.Context) {
+	// Validate ID params
+	hotelID := strings.TrimSpace(ctx.Param("id"))
+	roomID := strings.TrimSpace(ctx.Param("roomID"))
+
+	// Get room by ID using the service
+	room, err := controller.service.GetRoomByID(ctx.Request.Context(), hotelID, roomID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("error getting room: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, room)
+}
+
+func (controller Controller) List(ctx *gin.Context) {
+	// Validate ID param
+	hotelID := strings.TrimSpace(ctx.Param("id"))
+
+	// List rooms using the service
+	rooms, err := controller.service.ListByHotelID(ctx.Request.Context(), hotelID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error listing rooms: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, rooms)
+}
+
+func (controller Controller) Create(ctx *gin.Context) {
+	// Parse room
+	var room roomsDomain.Room
+	if err := ctx.ShouldBindJSON(&room); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
+	if err := validate(room); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
+
+	// Set the hotel ID from the URL to the room object
+	room.HotelID = strings.TrimSpace(ctx.Param("id"))
+
+	// Create room
+	id, err := controller.service.Create(ctx.Request.Context(), room)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error creating room: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send ID
+	ctx.JSON(http.StatusCreated, gin.H{
+		"id": id,
+	})
+}
+
+func (controller Controller) Update(ctx *gin.Context) {
+	// Validate ID params
+	hotelID := strings.TrimSpace(ctx.Param("id"))
+	roomID := strings.TrimSpace(ctx.Param("roomID"))
+
+	// Parse room
+	var room roomsDomain.Room
+	if err := ctx.ShouldBindJSON(&room); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid request: %s", err.Error()),
+		})
+		return
+	}
+	if room.Capacity < 0 || room.Units < 0 || room.BasePrice < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: capacity, units and base_price can't be negative",
+		})
+		return
+	}
+
+	// Set the IDs from the URL to the room object
+	room.ID = roomID
+	room.HotelID = hotelID
+
+	// Update room
+	if err := controller.service.Update(ctx.Request.Context(), room); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error updating room: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": roomID,
+	})
+}
+
+func (controller Controller) Delete(ctx *gin.Context) {
+	// Validate ID params
+	hotelID := strings.TrimSpace(ctx.Param("id"))
+	roomID := strings.TrimSpace(ctx.Param("roomID"))
+
+	// Delete room
+	if err := controller.service.Delete(ctx.Request.Context(), hotelID, roomID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error deleting room: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": roomID,
+	})
+}
+
+// validate checks the fields required to create a room
+func validate(room roomsDomain.Room) error {
+	if strings.TrimSpace(room.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if room.Capacity <= 0 {
+		return fmt.Errorf("capacity must be greater than zero")
+	}
+	if room.Units <= 0 {
+		return fmt.Errorf("units must be greater than zero")
+	}
+	if room.BasePrice < 0 {
+		return fmt.Errorf("base_price can't be negative")
+	}
+	return nil
+}
+
+// Export streams every room as newline delimited JSON. The status is sent before the first
+// room, so a failure halfway is reported as a last line holding only an error
+func (controller Controller) Export(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	exported := 0
+	err := controller.service.Export(ctx.Request.Context(), func(room roomsDomain.Room) error {
+		if err := encoder.Encode(room); err != nil {
+			return fmt.Errorf("error writing room: %w", err)
+		}
+		if exported++; exported%exportFlushSize == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		_ = encoder.Encode(gin.H{
+			"error": fmt.Sprintf("error exporting rooms: %s", err.Error()),
+		})
+	}
+	ctx.Writer.Flush()
+}
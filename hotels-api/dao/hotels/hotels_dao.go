@@ -1,11 +1,70 @@
 package hotels
 
+import "errors"
+
+// ErrInvalidCursor is returned when a listing cursor wasn't issued by the repository
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Hotel struct {
-	ID        string   `bson:"_id,omitempty"`
-	Name      string   `bson:"name"`
-	Address   string   `bson:"address"`
-	City      string   `bson:"city"`
-	State     string   `bson:"state"`
-	Rating    float64  `bson:"rating"`
-	Amenities []string `bson:"amenities"`
+	ID        string    `bson:"_id,omitempty"`
+	Name      string    `bson:"name"`
+	Address   string    `bson:"address"`
+	City      string    `bson:"city"`
+	State     string    `bson:"state"`
+	Rating    float64   `bson:"rating"`
+	Amenities []string  `bson:"amenities"`
+	Location  *Location `bson:"location,omitempty"`
+	Version   int64     `bson:"version"`
+
+	// ClearLocation removes the location on updates, a nil one is kept
+	ClearLocation bool `bson:"-"`
+}
+
+// Location is a GeoJSON point, coordinates are longitude first
+type Location struct {
+	Type        string    `bson:"type"`
+	Coordinates []float64 `bson:"coordinates"`
+}
+
+// NewLocation returns the point at the coordinates, or nil when they aren't both set
+func NewLocation(latitude *float64, longitude *float64) *Location {
+	if latitude == nil || longitude == nil {
+		return nil
+	}
+	return &Location{
+		Type:        "Point",
+		Coordinates: []float64{*longitude, *latitude},
+	}
+}
+
+func (location *Location) Latitude() *float64 {
+	if location == nil || len(location.Coordinates) < 2 {
+		return nil
+	}
+	latitude := location.Coordinates[1]
+	return &latitude
+}
+
+func (location *Location) Longitude() *float64 {
+	if location == nil || len(location.Coordinates) < 2 {
+		return nil
+	}
+	longitude := location.Coordinates[0]
+	return &longitude
+}
+
+type ListFilter struct {
+	City      string
+	State     string
+	MinRating float64
+	Amenities []string
+	Sort      string
+	Cursor    string
+	Limit     int
+}
+
+type ListResult struct {
+	Hotels     []Hotel
+	NextCursor string
+	Total      int64
 }
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	hotelsDAO "hotels-api/dao/hotels"
+	reservationsDAO "hotels-api/dao/reservations"
+	"time"
+)
+
+const (
+	StatusPending   = "PENDING"
+	StatusDelivered = "DELIVERED"
+	StatusFailed    = "FAILED" // Can never be published, kept until someone looks at it
+)
+
+// Entry is a change waiting to be published, written along with the change itself
+type Entry struct {
+	ID            string           `bson:"_id,omitempty"`
+	Operation     string           `bson:"operation"`
+	HotelID       string           `bson:"hotel_id"`
+	Version       int64            `bson:"version"`
+	Hotel         *hotelsDAO.Hotel `bson:"hotel,omitempty"` // Snapshot after the change, none on delete
+	RoomID        string           `bson:"room_id,omitempty"`
+	ReservationID string           `bson:"reservation_id,omitempty"`
+	CheckIn       time.Time        `bson:"check_in,omitempty"`
+	CheckOut      time.Time        `bson:"check_out,omitempty"`
+	Status        string           `bson:"status"`
+	Attempts      int              `bson:"attempts"` // Times the entry was claimed, for diagnostics
+	LastError     string           `bson:"last_error,omitempty"`
+	LockedUntil   time.Time        `bson:"locked_until"`
+	CreatedAt     time.Time        `bson:"created_at"`
+	DeliveredAt   time.Time        `bson:"delivered_at,omitempty"`
+}
+
+func NewEntry(operation string, hotelID string, version int64, hotel *hotelsDAO.Hotel) Entry {
+	entry := newEntry(operation, hotelID)
+	entry.Version = version
+	entry.Hotel = hotel
+	return entry
+}
+
+// NewRoomEntry builds the entry of a change to a room of the hotel
+func NewRoomEntry(operation string, hotelID string, roomID string) Entry {
+	entry := newEntry(operation, hotelID)
+	entry.RoomID = roomID
+	return entry
+}
+
+// NewReservationEntry builds the entry of a change to a reservation, carrying the nights it holds
+func NewReservationEntry(operation string, reservation reservationsDAO.Reservation) Entry {
+	entry := newEntry(operation, reservation.HotelID)
+	entry.RoomID = reservation.RoomID
+	entry.ReservationID = reservation.ID
+	entry.CheckIn = reservation.CheckIn
+	entry.CheckOut = reservation.CheckOut
+	return entry
+}
+
+func newEntry(operation string, hotelID string) Entry {
+	now := time.Now().UTC()
+	return Entry{
+		Operation:   operation,
+		HotelID:     hotelID,
+		Status:      StatusPending,
+		LockedUntil: now,
+		CreatedAt:   now,
+	}
+}
@@ -0,0 +1,29 @@
+package reservations
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+var (
+	ErrNoAvailability = errors.New("no availability")
+	ErrNotConfirmed   = errors.New("reservation not confirmed")
+)
+
+type Reservation struct {
+	ID         string    `bson:"_id,omitempty"`
+	UserID     int64     `bson:"user_id"`
+	HotelID    string    `bson:"hotel_id"`
+	RoomID     string    `bson:"room_id"`
+	CheckIn    time.Time `bson:"check_in"`
+	CheckOut   time.Time `bson:"check_out"`
+	Guests     int       `bson:"guests"`
+	TotalPrice float64   `bson:"total_price"`
+	Status     string    `bson:"status"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
@@ -0,0 +1,16 @@
+package rooms
+
+type Room struct {
+	ID        string  `bson:"_id,omitempty"`
+	HotelID   string  `bson:"hotel_id"`
+	Name      string  `bson:"name"`
+	Capacity  int     `bson:"capacity"`
+	Beds      []Bed   `bson:"beds"`
+	BasePrice float64 `bson:"base_price"`
+	Units     int     `bson:"units"`
+}
+
+type Bed struct {
+	Type  string `bson:"type"`
+	Count int    `bson:"count"`
+}
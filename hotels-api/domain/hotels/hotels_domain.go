@@ -1,5 +1,33 @@
 package hotels
 
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// EventSchemaVersion is the version of the HotelNew envelope published, events without
+	// one are the legacy operation and ID pair
+	EventSchemaVersion = 1
+
+	SortByID         = ""
+	SortByName       = "name"
+	SortByNameDesc   = "-name"
+	SortByRating     = "rating"
+	SortByRatingDesc = "-rating"
+)
+
+var (
+	// ErrInvalidCursor is returned when listing with a cursor that wasn't a next_cursor
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidEvent is returned when publishing an event that can never be published as it is
+	ErrInvalidEvent = errors.New("invalid event")
+
+	// ErrInvalidLocation is returned when the coordinates of a hotel are out of range or incomplete
+	ErrInvalidLocation = errors.New("invalid location")
+)
+
 type Hotel struct {
 	ID        string   `json:"id"`
 	Name      string   `json:"name"`
@@ -8,9 +36,51 @@ type Hotel struct {
 	State     string   `json:"state"`
 	Rating    float64  `json:"rating"`
 	Amenities []string `json:"amenities"`
+	Latitude  *float64 `json:"latitude,omitempty"` // Both nil when the hotel has no location
+	Longitude *float64 `json:"longitude,omitempty"`
+	Version   int64    `json:"version,omitempty"` // Only set on exports
+}
+
+// UpdateRequest holds the hotel fields to change, the empty ones are kept. The coordinates
+// are pointers since zero is a valid one, they are only changed together
+type UpdateRequest struct {
+	Name          string   `json:"name"`
+	Address       string   `json:"address"`
+	City          string   `json:"city"`
+	State         string   `json:"state"`
+	Rating        float64  `json:"rating"`
+	Amenities     []string `json:"amenities"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	ClearLocation bool     `json:"clear_location"` // Removes the location, without coordinates
 }
 
 type HotelNew struct {
-	Operation string `json:"operation"`
-	HotelID   string `json:"hotel_id"`
+	SchemaVersion int       `json:"schema_version"`
+	EventID       string    `json:"event_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Operation     string    `json:"operation"`
+	HotelID       string    `json:"hotel_id"`
+	Version       int64     `json:"version,omitempty"` // Hotel version after the change
+	Hotel         *Hotel    `json:"hotel,omitempty"`   // Hotel snapshot after the change, none on delete
+	RoomID        string    `json:"room_id,omitempty"`
+	ReservationID string    `json:"reservation_id,omitempty"`
+	CheckIn       string    `json:"check_in,omitempty"`
+	CheckOut      string    `json:"check_out,omitempty"`
+}
+
+type ListRequest struct {
+	City      string
+	State     string
+	MinRating float64
+	Amenities []string
+	Sort      string
+	Cursor    string
+	Limit     int
+}
+
+type ListResponse struct {
+	Hotels     []Hotel `json:"hotels"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      int64   `json:"total"`
 }
@@ -0,0 +1,43 @@
+package reservations
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	DateLayout = "2006-01-02"
+
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+var (
+	ErrInvalid        = errors.New("invalid reservation")
+	ErrNotAvailable   = errors.New("room not available for the requested dates")
+	ErrNotCancellable = errors.New("reservation is already cancelled")
+	ErrNotFound       = errors.New("reservation not found")
+)
+
+type Reservation struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	HotelID    string    `json:"hotel_id"`
+	RoomID     string    `json:"room_id"`
+	CheckIn    string    `json:"check_in"`
+	CheckOut   string    `json:"check_out"`
+	Guests     int       `json:"guests"`
+	Nights     int       `json:"nights"`
+	TotalPrice float64   `json:"total_price"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Stay is the nights a confirmed reservation holds a room, without who holds it
+type Stay struct {
+	ID       string `json:"id"`
+	HotelID  string `json:"hotel_id"`
+	RoomID   string `json:"room_id"`
+	CheckIn  string `json:"check_in"`
+	CheckOut string `json:"check_out"`
+}
@@ -0,0 +1,16 @@
+package rooms
+
+type Room struct {
+	ID        string  `json:"id"`
+	HotelID   string  `json:"hotel_id"`
+	Name      string  `json:"name"`
+	Capacity  int     `json:"capacity"`
+	Beds      []Bed   `json:"beds"`
+	BasePrice float64 `json:"base_price"`
+	Units     int     `json:"units"`
+}
+
+type Bed struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,301 @@
+package tokenizers_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"hotels-api/internal/tokenizers"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// issuer stands in for users-api, publishing the public keys of its signing keys
+type issuer struct {
+	mutex    sync.Mutex
+	keys     map[string]crypto.Signer
+	requests int
+	blocked  chan struct{} // The keys aren't served until it's closed, when set
+}
+
+func (issuer *issuer) publish(id string, key crypto.Signer) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.keys[id] = key
+}
+
+func (issuer *issuer) fetches() int {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	return issuer.requests
+}
+
+func (issuer *issuer) block() chan struct{} {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.blocked = make(chan struct{})
+	return issuer.blocked
+}
+
+func (issuer *issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	issuer.mutex.Lock()
+	blocked := issuer.blocked
+	issuer.mutex.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.requests++
+
+	jwks := tokenizers.JWKS{Keys: make([]tokenizers.JWK, 0)}
+	for id, key := range issuer.keys {
+		switch key := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, tokenizers.JWK{
+				KeyType:   "RSA",
+				KeyID:     id,
+				Use:       "sig",
+				Algorithm: "RS256",
+				N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, tokenizers.JWK{
+				KeyType:   "OKP",
+				KeyID:     id,
+				Use:       "sig",
+				Algorithm: "EdDSA",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+	_ = json.NewEncoder(w).Encode(jwks)
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	return key
+}
+
+// sign issues a token the way users-api does
+func sign(t *testing.T, id string, key crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+	method := jwt.SigningMethod(jwt.SigningMethodEdDSA)
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		method = jwt.SigningMethodRS256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = id
+	value, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return value
+}
+
+// validClaims are the claims of a token issued now by users-api
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":      "users-api",
+		"aud":      []string{"hotels"},
+		"sub":      "1",
+		"iat":      now.Unix(),
+		"nbf":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+		"username": "user1",
+		"user_id":  1,
+	}
+}
+
+func newTokenizer(t *testing.T, minRefreshInterval time.Duration) (tokenizers.JWT, *issuer) {
+	issuer := &issuer{keys: make(map[string]crypto.Signer)}
+	server := httptest.NewServer(issuer)
+	t.Cleanup(server.Close)
+	return tokenizers.NewTokenizer(tokenizers.JWTConfig{
+		JWKSURL:            server.URL,
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: minRefreshInterval,
+		Issuer:             "users-api",
+		Audience:           "hotels",
+		Leeway:             30 * time.Second,
+	}), issuer
+}
+
+func TestJWT(t *testing.T) {
+	t.Run("EdDSA", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+
+		claims, err := tokenizer.ValidateToken(sign(t, "ed25519", key, validClaims()))
+
+		assert.NoError(t, err)
+		assert.Equal(t, tokenizers.Claims{UserID: 1, Username: "user1", Roles: []string{}}, claims)
+	})
+
+	t.Run("RS256", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		issuer.publish("rsa", key)
+
+		claims, err := tokenizer.ValidateToken(sign(t, "rsa", key, validClaims()))
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), claims.UserID)
+	})
+
+	t.Run("Cached keys", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+
+		for i := 0; i < 3; i++ {
+			_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, validClaims()))
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, 1, issuer.fetches())
+	})
+
+	t.Run("Stale keys", func(t *testing.T) {
+		issuer := &issuer{keys: make(map[string]crypto.Signer)}
+		server := httptest.NewServer(issuer)
+		defer server.Close()
+		tokenizer := tokenizers.NewTokenizer(tokenizers.JWTConfig{
+			JWKSURL:         server.URL,
+			RefreshInterval: time.Nanosecond,
+			Issuer:          "users-api",
+			Audience:        "hotels",
+		})
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+		_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, validClaims()))
+		assert.NoError(t, err)
+
+		// The cached key is served while the keys are fetched again
+		blocked := issuer.block()
+		validated := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, validClaims()))
+				validated <- err
+			}()
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-validated:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				assert.Fail(t, "validation waited for the keys to be fetched")
+			}
+		}
+		close(blocked)
+
+		// Only one fetch is in flight at a time
+		assert.Eventually(t, func() bool { return issuer.fetches() == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		previous := newEd25519Key(t)
+		issuer.publish("previous", previous)
+		_, err := tokenizer.ValidateToken(sign(t, "previous", previous, validClaims()))
+		assert.NoError(t, err)
+
+		// The new key is fetched as soon as a token signed with it shows up
+		next := newEd25519Key(t)
+		issuer.publish("next", next)
+		_, err = tokenizer.ValidateToken(sign(t, "next", next, validClaims()))
+		assert.NoError(t, err)
+		_, err = tokenizer.ValidateToken(sign(t, "previous", previous, validClaims()))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, issuer.fetches())
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, time.Hour)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+
+		for i := 0; i < 3; i++ {
+			_, err := tokenizer.ValidateToken(sign(t, "forged", newEd25519Key(t), validClaims()))
+			assert.ErrorIs(t, err, jwt.ErrTokenUnverifiable)
+		}
+
+		// Unknown keys don't fetch the keys on every request
+		assert.Equal(t, 1, issuer.fetches())
+	})
+
+	t.Run("Key published under another ID", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		issuer.publish("ed25519", newEd25519Key(t))
+
+		_, err := tokenizer.ValidateToken(sign(t, "ed25519", newEd25519Key(t), validClaims()))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("Symmetric token", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+		token.Header["kid"] = "ed25519"
+		value, err := token.SignedString([]byte(key.Public().(ed25519.PublicKey)))
+		assert.NoError(t, err)
+
+		_, err = tokenizer.ValidateToken(value)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+		claims := validClaims()
+		claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+		_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, claims))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	})
+
+	t.Run("Wrong audience", func(t *testing.T) {
+		tokenizer, issuer := newTokenizer(t, 0)
+		key := newEd25519Key(t)
+		issuer.publish("ed25519", key)
+		claims := validClaims()
+		claims["aud"] = []string{"another-platform"}
+
+		_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, claims))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+	})
+
+	t.Run("Unreachable issuer", func(t *testing.T) {
+		tokenizer := tokenizers.NewTokenizer(tokenizers.JWTConfig{
+			JWKSURL:  "http://127.0.0.1:1/.well-known/jwks.json",
+			Issuer:   "users-api",
+			Audience: "hotels",
+		})
+		key := newEd25519Key(t)
+
+		_, err := tokenizer.ValidateToken(sign(t, "ed25519", key, validClaims()))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenUnverifiable)
+	})
+}
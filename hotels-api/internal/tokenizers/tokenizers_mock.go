@@ -0,0 +1,16 @@
+package tokenizers
+
+import "github.com/stretchr/testify/mock"
+
+type Mock struct {
+	mock.Mock
+}
+
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+func (m *Mock) ValidateToken(token string) (Claims, error) {
+	args := m.Called(token)
+	return args.Get(0).(Claims), args.Error(1)
+}
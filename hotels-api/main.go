@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"hotels-api/clients/queues"
 	controllers "hotels-api/controllers/hotels"
+	reservationsControllers "hotels-api/controllers/reservations"
+	roomsControllers "hotels-api/controllers/rooms"
+	"hotels-api/internal/tokenizers"
+	"hotels-api/middlewares/auth"
 	repositories "hotels-api/repositories/hotels"
+	outboxRepositories "hotels-api/repositories/outbox"
+	reservationsRepositories "hotels-api/repositories/reservations"
+	roomsRepositories "hotels-api/repositories/rooms"
 	services "hotels-api/services/hotels"
+	outboxServices "hotels-api/services/outbox"
+	reservationsServices "hotels-api/services/reservations"
+	roomsServices "hotels-api/services/rooms"
 	"log"
+	"os"
 	"time"
 )
 
@@ -20,36 +32,125 @@ func main() {
 
 	// Mongo
 	mainRepository := repositories.NewMongo(repositories.MongoConfig{
-		Host:       "mongo",
-		Port:       "27017",
-		Username:   "root",
-		Password:   "root",
-		Database:   "hotels-api",
-		Collection: "hotels",
+		Host:             "mongo",
+		Port:             "27017",
+		Username:         "root",
+		Password:         "root",
+		Database:         "hotels-api",
+		Collection:       "hotels",
+		OutboxCollection: "outbox",
+	})
+
+	// Outbox Mongo
+	outboxRepository := outboxRepositories.NewMongo(outboxRepositories.MongoConfig{
+		Host:         "mongo",
+		Port:         "27017",
+		Username:     "root",
+		Password:     "root",
+		Database:     "hotels-api",
+		Collection:   "outbox",
+		DeliveredTTL: 7 * 24 * time.Hour,
+	})
+
+	// Rooms local cache
+	roomsCacheRepository := roomsRepositories.NewCache(roomsRepositories.CacheConfig{
+		MaxSize:      100000,
+		ItemsToPrune: 100,
+		Duration:     30 * time.Second,
+	})
+
+	// Rooms Mongo
+	roomsMainRepository := roomsRepositories.NewMongo(roomsRepositories.MongoConfig{
+		Host:             "mongo",
+		Port:             "27017",
+		Username:         "root",
+		Password:         "root",
+		Database:         "hotels-api",
+		Collection:       "rooms",
+		OutboxCollection: "outbox",
+	})
+
+	// Reservations Mongo
+	reservationsRepository := reservationsRepositories.NewMongo(reservationsRepositories.MongoConfig{
+		Host:                "mongo",
+		Port:                "27017",
+		Username:            "root",
+		Password:            "root",
+		Database:            "hotels-api",
+		Collection:          "reservations",
+		InventoryCollection: "room_nights",
+		OutboxCollection:    "outbox",
 	})
 
 	// Rabbit
 	eventsQueue := queues.NewRabbit(queues.RabbitConfig{
-		Host:      "rabbitmq",
-		Port:      "5672",
-		Username:  "root",
-		Password:  "root",
-		QueueName: "hotels-news",
+		Host:           "rabbitmq",
+		Port:           "5672",
+		Username:       "root",
+		Password:       "root",
+		QueueName:      "hotels-news",
+		ConfirmTimeout: 5 * time.Second,
+	})
+
+	// Tokenizer, verifies the tokens with the public keys published by users-api
+	jwtTokenizer := tokenizers.NewTokenizer(tokenizers.JWTConfig{
+		JWKSURL:            "http://users-api:8080/.well-known/jwks.json",
+		RefreshInterval:    5 * time.Minute,
+		MinRefreshInterval: 10 * time.Second,
+		Issuer:             "users-api",
+		Audience:           "hotels",
+		Leeway:             30 * time.Second,
 	})
 
 	// Services
-	service := services.NewService(mainRepository, cacheRepository, eventsQueue)
+	service := services.NewService(mainRepository, cacheRepository)
+	outboxService := outboxServices.NewService(outboxRepository, eventsQueue, outboxServices.Config{
+		PollInterval: time.Second,
+		Lease:        30 * time.Second,
+		RetryBackoff: time.Second,
+		MaxBackoff:   time.Minute,
+	})
+	roomsService := roomsServices.NewService(roomsMainRepository, roomsCacheRepository, mainRepository)
+	reservationsService := reservationsServices.NewService(reservationsRepository, roomsMainRepository)
 
 	// Controllers
 	controller := controllers.NewController(service)
+	roomsController := roomsControllers.NewController(roomsService)
+	reservationsController := reservationsControllers.NewController(reservationsService)
+
+	// Middlewares
+	authMiddleware := auth.NewMiddleware(jwtTokenizer)
+	requireAdmin := authMiddleware.RequireRole(auth.RoleAdmin)
+
+	// Service token, shared with search-api to read the exports with personal data
+	serviceToken := os.Getenv("SERVICE_TOKEN")
+	if serviceToken == "" {
+		log.Println("SERVICE_TOKEN isn't set, the reservations export rejects every request")
+	}
+
+	// Launch outbox relay
+	go outboxService.Run(context.Background())
 
 	// Router
 	router := gin.Default()
+	router.GET("/hotels", controller.List)
+	router.GET("/hotels/export", controller.Export)
 	router.GET("/hotels/:id", controller.GetHotelByID)
-	router.POST("/hotels", controller.Create)
-	router.PUT("/hotels/:id", controller.Update)
-	router.DELETE("/hotels/:id", controller.Delete)
+	router.POST("/hotels", authMiddleware.Authenticate, requireAdmin, controller.Create)
+	router.PUT("/hotels/:id", authMiddleware.Authenticate, requireAdmin, controller.Update)
+	router.DELETE("/hotels/:id", authMiddleware.Authenticate, requireAdmin, controller.Delete)
+	router.GET("/rooms/export", roomsController.Export)
+	router.GET("/hotels/:id/rooms", roomsController.List)
+	router.GET("/hotels/:id/rooms/:roomID", roomsController.GetRoomByID)
+	router.POST("/hotels/:id/rooms", authMiddleware.Authenticate, requireAdmin, roomsController.Create)
+	router.PUT("/hotels/:id/rooms/:roomID", authMiddleware.Authenticate, requireAdmin, roomsController.Update)
+	router.DELETE("/hotels/:id/rooms/:roomID", authMiddleware.Authenticate, requireAdmin, roomsController.Delete)
+	router.GET("/reservations", authMiddleware.Authenticate, reservationsController.List)
+	router.GET("/reservations/export", auth.ServiceToken(serviceToken), reservationsController.Export)
+	router.GET("/reservations/:id", authMiddleware.Authenticate, reservationsController.GetReservationByID)
+	router.POST("/reservations", authMiddleware.Authenticate, reservationsController.Create)
+	router.DELETE("/reservations/:id", authMiddleware.Authenticate, reservationsController.Cancel)
 	if err := router.Run(":8081"); err != nil {
-		log.Fatalf("error running application: %w", err)
+		log.Fatalf("error running application: %v", err)
 	}
 }
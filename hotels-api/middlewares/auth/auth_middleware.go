@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"hotels-api/internal/tokenizers"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type Tokenizer interface {
+	ValidateToken(token string) (tokenizers.Claims, error)
+}
+
+// RoleAdmin is required to manage the hotels and their rooms
+const RoleAdmin = "admin"
+
+// claimsKey stores the claims of the authenticated user in the request context
+type claimsKey struct{}
+
+type Middleware struct {
+	tokenizer Tokenizer
+}
+
+func NewMiddleware(tokenizer Tokenizer) Middleware {
+	return Middleware{
+		tokenizer: tokenizer,
+	}
+}
+
+// Authenticate rejects the requests without a valid bearer token, otherwise it puts the claims
+// of the token in the request context for the next handlers
+func (middleware Middleware) Authenticate(ctx *gin.Context) {
+	token, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !found || strings.TrimSpace(token) == "" {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "missing bearer token",
+		})
+		return
+	}
+
+	claims, err := middleware.tokenizer.ValidateToken(strings.TrimSpace(token))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": fmt.Sprintf("unauthorized: %s", err.Error()),
+		})
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), claimsKey{}, claims))
+	ctx.Next()
+}
+
+// RequireRole rejects the requests whose token doesn't grant the role, it goes after Authenticate
+func (middleware Middleware) RequireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := FromContext(ctx.Request.Context())
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing bearer token",
+			})
+			return
+		}
+		if !slices.Contains(claims.Roles, role) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("forbidden: the %s role is required", role),
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// ServiceToken rejects the requests without the bearer token shared with the other services,
+// all of them when the token isn't configured
+func ServiceToken(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		bearer, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !found || token == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(bearer)), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized: invalid service token",
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// FromContext returns the claims of the authenticated user, if the request went through Authenticate
+func FromContext(ctx context.Context) (tokenizers.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(tokenizers.Claims)
+	return claims, ok
+}
+
+// UserID returns the ID of the authenticated user, or zero if the request wasn't authenticated
+func UserID(ctx context.Context) int64 {
+	claims, _ := FromContext(ctx)
+	return claims.UserID
+}
@@ -0,0 +1,96 @@
+package auth_test
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hotels-api/internal/tokenizers"
+	"hotels-api/middlewares/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenizer := tokenizers.NewMock()
+	tokenizer.On("ValidateToken", "admin").Return(tokenizers.Claims{UserID: 1, Username: "admin1", Roles: []string{auth.RoleAdmin}}, nil)
+	tokenizer.On("ValidateToken", "user").Return(tokenizers.Claims{UserID: 2, Username: "user1", Roles: []string{}}, nil)
+	tokenizer.On("ValidateToken", "expired").Return(tokenizers.Claims{}, errors.New("token has invalid claims: token is expired"))
+
+	middleware := auth.NewMiddleware(tokenizer)
+	router := gin.New()
+	router.POST("/admin", middleware.Authenticate, middleware.RequireRole(auth.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.POST("/me", middleware.Authenticate, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": auth.UserID(c.Request.Context())})
+	})
+	router.POST("/unauthenticated", middleware.RequireRole(auth.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	serve := func(path string, token string) int {
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	t.Run("Authenticate - Valid Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/me", "user"))
+	})
+
+	t.Run("Authenticate - Invalid Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/me", "expired"))
+	})
+
+	t.Run("Authenticate - Missing Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/me", ""))
+	})
+
+	t.Run("RequireRole - Granted", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve("/admin", "admin"))
+	})
+
+	t.Run("RequireRole - Missing Role", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve("/admin", "user"))
+	})
+
+	t.Run("RequireRole - Not Authenticated", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/unauthenticated", "admin"))
+	})
+}
+
+func TestServiceToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(token string, header string) int {
+		router := gin.New()
+		router.GET("/export", auth.ServiceToken(token), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		request := httptest.NewRequest(http.MethodGet, "/export", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	t.Run("ServiceToken - Granted", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve("secret", "Bearer secret"))
+	})
+
+	t.Run("ServiceToken - Wrong Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("secret", "Bearer other"))
+	})
+
+	t.Run("ServiceToken - Missing Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("secret", ""))
+	})
+
+	t.Run("ServiceToken - Not Configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("", "Bearer "))
+	})
+}
@@ -49,6 +49,16 @@ func (repository Cache) GetHotelByID(ctx context.Context, id string) (hotelsDAO.
 	return hotelDAO, nil
 }
 
+func (repository Cache) List(ctx context.Context, filter hotelsDAO.ListFilter) (hotelsDAO.ListResult, error) {
+	// Listings are not cached, they change with every write and are paged by cursor
+	return hotelsDAO.ListResult{}, fmt.Errorf("List not implemented in cache")
+}
+
+func (repository Cache) Export(ctx context.Context, fn func(hotel hotelsDAO.Hotel) error) error {
+	// The cache only holds some of the hotels
+	return fmt.Errorf("Export not implemented in cache")
+}
+
 func (repository Cache) Create(ctx context.Context, hotel hotelsDAO.Hotel) (string, error) {
 	key := fmt.Sprintf(keyFormat, hotel.ID)
 	repository.client.Set(key, hotel, repository.duration)
@@ -92,6 +102,12 @@ func (repository Cache) Update(ctx context.Context, hotel hotelsDAO.Hotel) error
 	if len(hotel.Amenities) > 0 {
 		currentHotel.Amenities = hotel.Amenities
 	}
+	if hotel.Location != nil {
+		currentHotel.Location = hotel.Location
+	}
+	if hotel.ClearLocation {
+		currentHotel.Location = nil
+	}
 
 	// Update the cache with the new hotel data and reset the expiration timer
 	repository.client.Set(key, currentHotel, repository.duration)
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	hotelsDAO "hotels-api/dao/hotels"
+	"slices"
+	"sort"
+	"strconv"
 )
 
 type Mock struct {
@@ -18,14 +21,108 @@ func NewMock() Mock {
 }
 
 func (repository Mock) GetHotelByID(ctx context.Context, id string) (hotelsDAO.Hotel, error) {
-	return repository.docs[id], nil
+	hotel, exists := repository.docs[id]
+	if !exists {
+		return hotelsDAO.Hotel{}, fmt.Errorf("hotel with ID %s not found", id)
+	}
+	return hotel, nil
+}
+
+func (repository Mock) List(ctx context.Context, filter hotelsDAO.ListFilter) (hotelsDAO.ListResult, error) {
+	// Apply filters
+	hotels := make([]hotelsDAO.Hotel, 0)
+	for id, hotel := range repository.docs {
+		if filter.City != "" && hotel.City != filter.City {
+			continue
+		}
+		if filter.State != "" && hotel.State != filter.State {
+			continue
+		}
+		if hotel.Rating < filter.MinRating {
+			continue
+		}
+		matches := true
+		for _, amenity := range filter.Amenities {
+			if !slices.Contains(hotel.Amenities, amenity) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		hotel.ID = id
+		hotels = append(hotels, hotel)
+	}
+
+	// Apply sort, using ID as tiebreaker
+	sort.Slice(hotels, func(i, j int) bool {
+		switch filter.Sort {
+		case "name":
+			if hotels[i].Name != hotels[j].Name {
+				return hotels[i].Name < hotels[j].Name
+			}
+		case "-name":
+			if hotels[i].Name != hotels[j].Name {
+				return hotels[i].Name > hotels[j].Name
+			}
+		case "rating":
+			if hotels[i].Rating != hotels[j].Rating {
+				return hotels[i].Rating < hotels[j].Rating
+			}
+		case "-rating":
+			if hotels[i].Rating != hotels[j].Rating {
+				return hotels[i].Rating > hotels[j].Rating
+			}
+		}
+		return hotels[i].ID < hotels[j].ID
+	})
+
+	// The mock cursor is just the offset of the next page
+	offset := 0
+	if filter.Cursor != "" {
+		value, err := strconv.Atoi(filter.Cursor)
+		if err != nil || value < 0 {
+			return hotelsDAO.ListResult{}, fmt.Errorf("%w: %s", hotelsDAO.ErrInvalidCursor, filter.Cursor)
+		}
+		offset = min(value, len(hotels))
+	}
+	end := min(offset+filter.Limit, len(hotels))
+
+	var nextCursor string
+	if end < len(hotels) {
+		nextCursor = strconv.Itoa(end)
+	}
+
+	return hotelsDAO.ListResult{
+		Hotels:     hotels[offset:end],
+		NextCursor: nextCursor,
+		Total:      int64(len(hotels)),
+	}, nil
+}
+
+func (repository Mock) Export(ctx context.Context, fn func(hotel hotelsDAO.Hotel) error) error {
+	ids := make([]string, 0, len(repository.docs))
+	for id := range repository.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		hotel := repository.docs[id]
+		hotel.ID = id
+		if err := fn(hotel); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (repository Mock) Create(ctx context.Context, hotel hotelsDAO.Hotel) (string, error) {
-	id := uuid.New().String()
-	hotel.ID = uuid.New().String()
-	repository.docs[id] = hotel
-	return id, nil
+	if hotel.ID == "" {
+		hotel.ID = uuid.New().String()
+	}
+	repository.docs[hotel.ID] = hotel
+	return hotel.ID, nil
 }
 
 func (repository Mock) Update(ctx context.Context, hotel hotelsDAO.Hotel) error {
@@ -54,6 +151,12 @@ func (repository Mock) Update(ctx context.Context, hotel hotelsDAO.Hotel) error
 	if len(hotel.Amenities) > 0 {
 		currentHotel.Amenities = hotel.Amenities
 	}
+	if hotel.Location != nil {
+		currentHotel.Location = hotel.Location
+	}
+	if hotel.ClearLocation {
+		currentHotel.Location = nil
+	}
 
 	// Save the updated hotel back to the mock storage
 	repository.docs[hotel.ID] = currentHotel
@@ -2,34 +2,47 @@ package hotels
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	hotelsDAO "hotels-api/dao/hotels"
+	outboxDAO "hotels-api/dao/outbox"
 	"log"
 )
 
 type MongoConfig struct {
-	Host       string
-	Port       string
-	Username   string
-	Password   string
-	Database   string
-	Collection string
+	Host             string
+	Port             string
+	Username         string
+	Password         string
+	Database         string
+	Collection       string
+	OutboxCollection string
 }
 
 type Mongo struct {
-	client     *mongo.Client
-	database   string
-	collection string
+	client           *mongo.Client
+	database         string
+	collection       string
+	outboxCollection string
 }
 
 const (
-	connectionURI = "mongodb://%s:%s"
+	connectionURI   = "mongodb://%s:%s"
+	exportBatchSize = 500
 )
 
+// listCursor is the opaque position encoded in the next_cursor of a listing
+type listCursor struct {
+	Value interface{} `json:"v,omitempty"`
+	ID    string      `json:"id"`
+}
+
 func NewMongo(config MongoConfig) Mongo {
 	credentials := options.Credential{
 		Username: config.Username,
@@ -45,10 +58,24 @@ func NewMongo(config MongoConfig) Mongo {
 		log.Panicf("error connecting to mongo DB: %v", err)
 	}
 
+	// Create the indexes used to filter and sort listings
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "city", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "rating", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "amenities", Value: 1}}},
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+	}
+	if _, err := client.Database(config.Database).Collection(config.Collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Printf("error creating mongo indexes: %v", err)
+	}
+
 	return Mongo{
-		client:     client,
-		database:   config.Database,
-		collection: config.Collection,
+		client:           client,
+		database:         config.Database,
+		collection:       config.Collection,
+		outboxCollection: config.OutboxCollection,
 	}
 }
 
@@ -71,19 +98,145 @@ func (repository Mongo) GetHotelByID(ctx context.Context, id string) (hotelsDAO.
 	return hotelDAO, nil
 }
 
-func (repository Mongo) Create(ctx context.Context, hotel hotelsDAO.Hotel) (string, error) {
-	// Insert into mongo
-	result, err := repository.client.Database(repository.database).Collection(repository.collection).InsertOne(ctx, hotel)
+func (repository Mongo) List(ctx context.Context, filter hotelsDAO.ListFilter) (hotelsDAO.ListResult, error) {
+	collection := repository.client.Database(repository.database).Collection(repository.collection)
+
+	// Build the query from the filters
+	query := bson.M{}
+	if filter.City != "" {
+		query["city"] = filter.City
+	}
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+	if filter.MinRating > 0 {
+		query["rating"] = bson.M{"$gte": filter.MinRating}
+	}
+	if len(filter.Amenities) > 0 {
+		query["amenities"] = bson.M{"$all": filter.Amenities}
+	}
+
+	// Count the total before applying the cursor
+	total, err := collection.CountDocuments(ctx, query)
 	if err != nil {
-		return "", fmt.Errorf("error creating document: %w", err)
+		return hotelsDAO.ListResult{}, fmt.Errorf("error counting documents: %w", err)
 	}
 
-	// Get inserted ID
-	objectID, ok := result.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return "", fmt.Errorf("error converting mongo ID to object ID")
+	// Resolve sort field and direction, always using _id as tiebreaker
+	field, direction, operator := "_id", 1, "$gt"
+	switch filter.Sort {
+	case "name", "-name":
+		field = "name"
+	case "rating", "-rating":
+		field = "rating"
+	}
+	if len(filter.Sort) > 0 && filter.Sort[0] == '-' {
+		direction, operator = -1, "$lt"
 	}
-	return objectID.Hex(), nil
+
+	// Continue after the cursor position
+	if filter.Cursor != "" {
+		cursor, err := decodeListCursor(filter.Cursor)
+		if err != nil {
+			return hotelsDAO.ListResult{}, err
+		}
+		objectID, err := primitive.ObjectIDFromHex(cursor.ID)
+		if err != nil {
+			return hotelsDAO.ListResult{}, fmt.Errorf("%w: %v", hotelsDAO.ErrInvalidCursor, err)
+		}
+		if field == "_id" {
+			query["_id"] = bson.M{operator: objectID}
+		} else {
+			query["$or"] = bson.A{
+				bson.M{field: bson.M{operator: cursor.Value}},
+				bson.M{field: cursor.Value, "_id": bson.M{operator: objectID}},
+			}
+		}
+	}
+
+	// Fetch one extra document to know if there is a next page
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(filter.Limit + 1))
+	result, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return hotelsDAO.ListResult{}, fmt.Errorf("error finding documents: %w", err)
+	}
+	var hotels []hotelsDAO.Hotel
+	if err := result.All(ctx, &hotels); err != nil {
+		return hotelsDAO.ListResult{}, fmt.Errorf("error decoding results: %w", err)
+	}
+
+	// Build next cursor from the last returned hotel
+	var nextCursor string
+	if len(hotels) > filter.Limit {
+		hotels = hotels[:filter.Limit]
+		last := hotels[len(hotels)-1]
+		cursor := listCursor{ID: last.ID}
+		switch field {
+		case "name":
+			cursor.Value = last.Name
+		case "rating":
+			cursor.Value = last.Rating
+		}
+		nextCursor, err = encodeListCursor(cursor)
+		if err != nil {
+			return hotelsDAO.ListResult{}, err
+		}
+	}
+
+	return hotelsDAO.ListResult{
+		Hotels:     hotels,
+		NextCursor: nextCursor,
+		Total:      total,
+	}, nil
+}
+
+// Export calls fn with every hotel in ID order, reading them in batches
+func (repository Mongo) Export(ctx context.Context, fn func(hotel hotelsDAO.Hotel) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize)
+	cursor, err := repository.client.Database(repository.database).Collection(repository.collection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return fmt.Errorf("error finding documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var hotel hotelsDAO.Hotel
+		if err := cursor.Decode(&hotel); err != nil {
+			return fmt.Errorf("error decoding result: %w", err)
+		}
+		if err := fn(hotel); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error iterating documents: %w", err)
+	}
+	return nil
+}
+
+func (repository Mongo) Create(ctx context.Context, hotel hotelsDAO.Hotel) (string, error) {
+	// Insert into mongo along with the CREATE event
+	hotel, err := repository.withOutbox(ctx, "CREATE", func(ctx mongo.SessionContext) (hotelsDAO.Hotel, error) {
+		hotel.Version = 1
+		result, err := repository.client.Database(repository.database).Collection(repository.collection).InsertOne(ctx, hotel)
+		if err != nil {
+			return hotelsDAO.Hotel{}, fmt.Errorf("error creating document: %w", err)
+		}
+
+		// Get inserted ID
+		objectID, ok := result.InsertedID.(primitive.ObjectID)
+		if !ok {
+			return hotelsDAO.Hotel{}, fmt.Errorf("error converting mongo ID to object ID")
+		}
+		hotel.ID = objectID.Hex()
+		return hotel, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hotel.ID, nil
 }
 
 func (repository Mongo) Update(ctx context.Context, hotel hotelsDAO.Hotel) error {
@@ -115,22 +268,38 @@ func (repository Mongo) Update(ctx context.Context, hotel hotelsDAO.Hotel) error
 	if len(hotel.Amenities) > 0 { // Assuming empty slice is the default for Amenities
 		update["amenities"] = hotel.Amenities
 	}
+	if hotel.Location != nil {
+		update["location"] = hotel.Location
+	}
 
 	// Update the document in MongoDB
-	if len(update) == 0 {
+	if len(update) == 0 && !hotel.ClearLocation {
 		return fmt.Errorf("no fields to update for hotel ID %s", hotel.ID)
 	}
 
+	// Bump the version and keep the updated hotel for the UPDATE event
 	filter := bson.M{"_id": objectID}
-	result, err := repository.client.Database(repository.database).Collection(repository.collection).UpdateOne(ctx, filter, bson.M{"$set": update})
-	if err != nil {
-		return fmt.Errorf("error updating document: %w", err)
+	changes := bson.M{"$inc": bson.M{"version": 1}}
+	if len(update) > 0 {
+		changes["$set"] = update
 	}
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("no document found with ID %s", hotel.ID)
+	if hotel.ClearLocation {
+		changes["$unset"] = bson.M{"location": ""}
 	}
-
-	return nil
+	_, err = repository.withOutbox(ctx, "UPDATE", func(ctx mongo.SessionContext) (hotelsDAO.Hotel, error) {
+		var updated hotelsDAO.Hotel
+		err := repository.client.Database(repository.database).Collection(repository.collection).
+			FindOneAndUpdate(ctx, filter, changes, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&updated)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return hotelsDAO.Hotel{}, fmt.Errorf("no document found with ID %s", hotel.ID)
+		}
+		if err != nil {
+			return hotelsDAO.Hotel{}, fmt.Errorf("error updating document: %w", err)
+		}
+		return updated, nil
+	})
+	return err
 }
 
 func (repository Mongo) Delete(ctx context.Context, id string) error {
@@ -141,14 +310,70 @@ func (repository Mongo) Delete(ctx context.Context, id string) error {
 	}
 
 	// Delete the document from MongoDB
+	// The deletion is the last version of the hotel
 	filter := bson.M{"_id": objectID}
-	result, err := repository.client.Database(repository.database).Collection(repository.collection).DeleteOne(ctx, filter)
+	_, err = repository.withOutbox(ctx, "DELETE", func(ctx mongo.SessionContext) (hotelsDAO.Hotel, error) {
+		var deleted hotelsDAO.Hotel
+		err := repository.client.Database(repository.database).Collection(repository.collection).FindOneAndDelete(ctx, filter).Decode(&deleted)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return hotelsDAO.Hotel{}, fmt.Errorf("no document found with ID %s", id)
+		}
+		if err != nil {
+			return hotelsDAO.Hotel{}, fmt.Errorf("error deleting document: %w", err)
+		}
+		deleted.Version++
+		return deleted, nil
+	})
+	return err
+}
+
+// withOutbox runs a hotel change in a transaction along with its outbox entry, so the event
+// is recorded if and only if the change is committed. The change returns the hotel as it
+// was left, which is the snapshot published unless it was deleted
+func (repository Mongo) withOutbox(ctx context.Context, operation string, change func(ctx mongo.SessionContext) (hotelsDAO.Hotel, error)) (hotelsDAO.Hotel, error) {
+	session, err := repository.client.StartSession()
 	if err != nil {
-		return fmt.Errorf("error deleting document: %w", err)
+		return hotelsDAO.Hotel{}, fmt.Errorf("error starting mongo session: %w", err)
 	}
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no document found with ID %s", id)
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		hotel, err := change(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snapshot := &hotel
+		if operation == "DELETE" {
+			snapshot = nil
+		}
+		entry := outboxDAO.NewEntry(operation, hotel.ID, hotel.Version, snapshot)
+		if _, err := repository.client.Database(repository.database).Collection(repository.outboxCollection).InsertOne(ctx, entry); err != nil {
+			return nil, fmt.Errorf("error creating outbox entry: %w", err)
+		}
+		return hotel, nil
+	})
+	if err != nil {
+		return hotelsDAO.Hotel{}, err
 	}
+	return result.(hotelsDAO.Hotel), nil
+}
 
-	return nil
+func encodeListCursor(cursor listCursor) (string, error) {
+	bytes, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func decodeListCursor(value string) (listCursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("%w: %v", hotelsDAO.ErrInvalidCursor, err)
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(bytes, &cursor); err != nil {
+		return listCursor{}, fmt.Errorf("%w: %v", hotelsDAO.ErrInvalidCursor, err)
+	}
+	return cursor, nil
 }
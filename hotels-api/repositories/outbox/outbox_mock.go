@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	outboxDAO "hotels-api/dao/outbox"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Mock struct {
+	mutex   *sync.Mutex
+	entries map[string]*outboxDAO.Entry
+}
+
+func NewMock() Mock {
+	return Mock{
+		mutex:   &sync.Mutex{},
+		entries: make(map[string]*outboxDAO.Entry),
+	}
+}
+
+// Add stores a new pending entry, the way the hotels repository does along with each change
+func (repository Mock) Add(entry outboxDAO.Entry) string {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	repository.entries[entry.ID] = &entry
+	return entry.ID
+}
+
+// Get returns a copy of the entry with the given ID
+func (repository Mock) Get(id string) (outboxDAO.Entry, bool) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	entry, exists := repository.entries[id]
+	if !exists {
+		return outboxDAO.Entry{}, false
+	}
+	return *entry, true
+}
+
+func (repository Mock) Claim(ctx context.Context, lease time.Duration) (outboxDAO.Entry, bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	// Find the oldest pending entry that isn't leased
+	now := time.Now().UTC()
+	pending := make([]*outboxDAO.Entry, 0)
+	for _, entry := range repository.entries {
+		if entry.Status == outboxDAO.StatusPending && !entry.LockedUntil.After(now) {
+			pending = append(pending, entry)
+		}
+	}
+	if len(pending) == 0 {
+		return outboxDAO.Entry{}, false, nil
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].CreatedAt.Equal(pending[j].CreatedAt) {
+			return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+
+	entry := pending[0]
+	entry.LockedUntil = now.Add(lease)
+	entry.Attempts++
+	return *entry, true, nil
+}
+
+func (repository Mock) MarkDelivered(ctx context.Context, id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	entry, exists := repository.entries[id]
+	if !exists {
+		return fmt.Errorf("outbox entry with ID %s not found", id)
+	}
+	entry.Status = outboxDAO.StatusDelivered
+	entry.DeliveredAt = time.Now().UTC()
+	return nil
+}
+
+func (repository Mock) Release(ctx context.Context, id string, retryAt time.Time, cause error) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	entry, exists := repository.entries[id]
+	if !exists {
+		return fmt.Errorf("outbox entry with ID %s not found", id)
+	}
+	entry.LockedUntil = retryAt.UTC()
+	entry.LastError = cause.Error()
+	return nil
+}
+
+func (repository Mock) MarkFailed(ctx context.Context, id string, cause error) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	entry, exists := repository.entries[id]
+	if !exists {
+		return fmt.Errorf("outbox entry with ID %s not found", id)
+	}
+	entry.Status = outboxDAO.StatusFailed
+	entry.LastError = cause.Error()
+	return nil
+}
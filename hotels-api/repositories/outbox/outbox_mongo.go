@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	outboxDAO "hotels-api/dao/outbox"
+	"log"
+	"time"
+)
+
+type MongoConfig struct {
+	Host         string
+	Port         string
+	Username     string
+	Password     string
+	Database     string
+	Collection   string
+	DeliveredTTL time.Duration // How long delivered entries are kept
+}
+
+type Mongo struct {
+	client     *mongo.Client
+	database   string
+	collection string
+}
+
+const (
+	connectionURI = "mongodb://%s:%s"
+)
+
+func NewMongo(config MongoConfig) Mongo {
+	credentials := options.Credential{
+		Username: config.Username,
+		Password: config.Password,
+	}
+
+	ctx := context.Background()
+	uri := fmt.Sprintf(connectionURI, config.Host, config.Port)
+	cfg := options.Client().ApplyURI(uri).SetAuth(credentials)
+
+	client, err := mongo.Connect(ctx, cfg)
+	if err != nil {
+		log.Panicf("error connecting to mongo DB: %v", err)
+	}
+
+	// Pending entries are claimed oldest first, delivered ones expire after a while
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}, {Key: "created_at", Value: 1}}},
+	}
+	if config.DeliveredTTL > 0 {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(config.DeliveredTTL.Seconds())),
+		})
+	}
+	if _, err := client.Database(config.Database).Collection(config.Collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Printf("error creating mongo indexes: %v", err)
+	}
+
+	return Mongo{
+		client:     client,
+		database:   config.Database,
+		collection: config.Collection,
+	}
+}
+
+// Claim leases the oldest pending entry that isn't leased, so no other relay publishes it until
+// the lease expires. Entries are ordered by the time they were written, not committed, so events
+// are only roughly in order, the consumers rely on the hotel versions and reservation IDs instead
+func (repository Mongo) Claim(ctx context.Context, lease time.Duration) (outboxDAO.Entry, bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":       outboxDAO.StatusPending,
+		"locked_until": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"locked_until": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+	var entry outboxDAO.Entry
+	err := repository.client.Database(repository.database).Collection(repository.collection).FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return outboxDAO.Entry{}, false, nil
+	}
+	if err != nil {
+		return outboxDAO.Entry{}, false, fmt.Errorf("error claiming outbox entry: %w", err)
+	}
+	return entry, true, nil
+}
+
+// MarkDelivered records the entry as published, it won't be claimed again
+func (repository Mongo) MarkDelivered(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+	update := bson.M{"$set": bson.M{
+		"status":       outboxDAO.StatusDelivered,
+		"delivered_at": time.Now().UTC(),
+	}}
+	if _, err := repository.client.Database(repository.database).Collection(repository.collection).UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+		return fmt.Errorf("error marking outbox entry as delivered: %w", err)
+	}
+	return nil
+}
+
+// Release gives back a claimed entry that couldn't be published, to be retried after the given time
+func (repository Mongo) Release(ctx context.Context, id string, retryAt time.Time, cause error) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+	update := bson.M{"$set": bson.M{
+		"locked_until": retryAt.UTC(),
+		"last_error":   cause.Error(),
+	}}
+	if _, err := repository.client.Database(repository.database).Collection(repository.collection).UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+		return fmt.Errorf("error releasing outbox entry: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed gives up on an entry that couldn't be published, it won't be claimed again
+func (repository Mongo) MarkFailed(ctx context.Context, id string, cause error) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+	update := bson.M{"$set": bson.M{
+		"status":     outboxDAO.StatusFailed,
+		"last_error": cause.Error(),
+	}}
+	if _, err := repository.client.Database(repository.database).Collection(repository.collection).UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+		return fmt.Errorf("error marking outbox entry as failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package reservations
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	reservationsDAO "hotels-api/dao/reservations"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Mock struct {
+	mutex  *sync.Mutex
+	docs   map[string]reservationsDAO.Reservation
+	nights map[string]int
+}
+
+func NewMock() Mock {
+	return Mock{
+		mutex:  &sync.Mutex{},
+		docs:   make(map[string]reservationsDAO.Reservation),
+		nights: make(map[string]int),
+	}
+}
+
+func (repository Mock) GetReservationByID(ctx context.Context, id string) (reservationsDAO.Reservation, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	reservation, exists := repository.docs[id]
+	if !exists {
+		return reservationsDAO.Reservation{}, fmt.Errorf("reservation with ID %s not found", id)
+	}
+	return reservation, nil
+}
+
+func (repository Mock) ListByUserID(ctx context.Context, userID int64) ([]reservationsDAO.Reservation, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	reservations := make([]reservationsDAO.Reservation, 0)
+	for _, reservation := range repository.docs {
+		if reservation.UserID == userID {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return reservations, nil
+}
+
+func (repository Mock) ExportActive(ctx context.Context, from time.Time, fn func(reservation reservationsDAO.Reservation) error) error {
+	repository.mutex.Lock()
+	active := make([]reservationsDAO.Reservation, 0)
+	for _, reservation := range repository.docs {
+		if reservation.Status == reservationsDAO.StatusConfirmed && reservation.CheckOut.After(from) {
+			active = append(active, reservation)
+		}
+	}
+	repository.mutex.Unlock()
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].ID < active[j].ID
+	})
+	for _, reservation := range active {
+		if err := fn(reservation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository Mock) Create(ctx context.Context, reservation reservationsDAO.Reservation, nights []time.Time, units int) (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	// Check every night first so the reservation is all or nothing
+	for _, night := range nights {
+		if repository.nights[nightKey(reservation.RoomID, night)] >= units {
+			return "", reservationsDAO.ErrNoAvailability
+		}
+	}
+	for _, night := range nights {
+		repository.nights[nightKey(reservation.RoomID, night)]++
+	}
+	reservation.ID = uuid.New().String()
+	repository.docs[reservation.ID] = reservation
+	return reservation.ID, nil
+}
+
+func (repository Mock) Cancel(ctx context.Context, id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	reservation, exists := repository.docs[id]
+	if !exists || reservation.Status != reservationsDAO.StatusConfirmed {
+		return fmt.Errorf("reservation %s: %w", id, reservationsDAO.ErrNotConfirmed)
+	}
+	reservation.Status = reservationsDAO.StatusCancelled
+	repository.docs[id] = reservation
+	for night := reservation.CheckIn; night.Before(reservation.CheckOut); night = night.AddDate(0, 0, 1) {
+		if key := nightKey(reservation.RoomID, night); repository.nights[key] > 0 {
+			repository.nights[key]--
+		}
+	}
+	return nil
+}
+
+func nightKey(roomID string, night time.Time) string {
+	return fmt.Sprintf("%s:%s", roomID, night.Format(time.DateOnly))
+}
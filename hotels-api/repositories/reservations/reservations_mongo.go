@@ -0,0 +1,268 @@
+package reservations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	outboxDAO "hotels-api/dao/outbox"
+	reservationsDAO "hotels-api/dao/reservations"
+	"log"
+	"time"
+)
+
+type MongoConfig struct {
+	Host                string
+	Port                string
+	Username            string
+	Password            string
+	Database            string
+	Collection          string
+	InventoryCollection string
+	OutboxCollection    string
+}
+
+type Mongo struct {
+	client              *mongo.Client
+	database            string
+	collection          string
+	inventoryCollection string
+	outboxCollection    string
+}
+
+const (
+	connectionURI   = "mongodb://%s:%s"
+	exportBatchSize = 500
+)
+
+func NewMongo(config MongoConfig) Mongo {
+	credentials := options.Credential{
+		Username: config.Username,
+		Password: config.Password,
+	}
+
+	ctx := context.Background()
+	uri := fmt.Sprintf(connectionURI, config.Host, config.Port)
+	cfg := options.Client().ApplyURI(uri).SetAuth(credentials)
+
+	client, err := mongo.Connect(ctx, cfg)
+	if err != nil {
+		log.Panicf("error connecting to mongo DB: %v", err)
+	}
+
+	// The unique room/night index is what makes the inventory counters safe under concurrency
+	database := client.Database(config.Database)
+	if _, err := database.Collection(config.InventoryCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		log.Printf("error creating mongo indexes: %v", err)
+	}
+	if _, err := database.Collection(config.Collection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "check_in", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "check_out", Value: 1}}},
+	}); err != nil {
+		log.Printf("error creating mongo indexes: %v", err)
+	}
+
+	return Mongo{
+		client:              client,
+		database:            config.Database,
+		collection:          config.Collection,
+		inventoryCollection: config.InventoryCollection,
+		outboxCollection:    config.OutboxCollection,
+	}
+}
+
+func (repository Mongo) GetReservationByID(ctx context.Context, id string) (reservationsDAO.Reservation, error) {
+	// Get from MongoDB
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return reservationsDAO.Reservation{}, fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+	result := repository.client.Database(repository.database).Collection(repository.collection).FindOne(ctx, bson.M{"_id": objectID})
+	if result.Err() != nil {
+		return reservationsDAO.Reservation{}, fmt.Errorf("error finding document: %w", result.Err())
+	}
+
+	// Convert document to DAO
+	var reservationDAO reservationsDAO.Reservation
+	if err := result.Decode(&reservationDAO); err != nil {
+		return reservationsDAO.Reservation{}, fmt.Errorf("error decoding result: %w", err)
+	}
+	return reservationDAO, nil
+}
+
+func (repository Mongo) ListByUserID(ctx context.Context, userID int64) ([]reservationsDAO.Reservation, error) {
+	// Find the reservations of the user, newest stays first
+	opts := options.Find().SetSort(bson.D{{Key: "check_in", Value: -1}})
+	cursor, err := repository.client.Database(repository.database).Collection(repository.collection).Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding documents: %w", err)
+	}
+
+	// Convert documents to DAOs
+	reservations := make([]reservationsDAO.Reservation, 0)
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, fmt.Errorf("error decoding results: %w", err)
+	}
+	return reservations, nil
+}
+
+// ExportActive calls fn with every confirmed reservation checking out after the given time
+func (repository Mongo) ExportActive(ctx context.Context, from time.Time, fn func(reservation reservationsDAO.Reservation) error) error {
+	filter := bson.M{"status": reservationsDAO.StatusConfirmed, "check_out": bson.M{"$gt": from}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize)
+	cursor, err := repository.client.Database(repository.database).Collection(repository.collection).Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("error finding documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var reservation reservationsDAO.Reservation
+		if err := cursor.Decode(&reservation); err != nil {
+			return fmt.Errorf("error decoding result: %w", err)
+		}
+		if err := fn(reservation); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error iterating documents: %w", err)
+	}
+	return nil
+}
+
+func (repository Mongo) Create(ctx context.Context, reservation reservationsDAO.Reservation, nights []time.Time, units int) (string, error) {
+	// Take the nights and insert into mongo along with the outbox entry, all in a single
+	// transaction so the inventory can't stay reserved without its reservation
+	reservation, err := repository.withOutbox(ctx, "RESERVATION_CREATE", func(ctx mongo.SessionContext) (reservationsDAO.Reservation, error) {
+		if err := repository.reserve(ctx, reservation.RoomID, nights, units); err != nil {
+			return reservationsDAO.Reservation{}, err
+		}
+		result, err := repository.client.Database(repository.database).Collection(repository.collection).InsertOne(ctx, reservation)
+		if err != nil {
+			return reservationsDAO.Reservation{}, fmt.Errorf("error creating document: %w", err)
+		}
+
+		// Get inserted ID
+		objectID, ok := result.InsertedID.(primitive.ObjectID)
+		if !ok {
+			return reservationsDAO.Reservation{}, fmt.Errorf("error converting mongo ID to object ID")
+		}
+		reservation.ID = objectID.Hex()
+		return reservation, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return reservation.ID, nil
+}
+
+func (repository Mongo) Cancel(ctx context.Context, id string) error {
+	// Convert reservation ID to MongoDB ObjectID
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+
+	// Only cancel confirmed reservations so concurrent cancellations can't both win, the
+	// nights are given back in the same transaction so they can't stay reserved
+	filter := bson.M{"_id": objectID, "status": reservationsDAO.StatusConfirmed}
+	update := bson.M{"$set": bson.M{"status": reservationsDAO.StatusCancelled}}
+	_, err = repository.withOutbox(ctx, "RESERVATION_CANCEL", func(ctx mongo.SessionContext) (reservationsDAO.Reservation, error) {
+		var cancelled reservationsDAO.Reservation
+		err := repository.client.Database(repository.database).Collection(repository.collection).
+			FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&cancelled)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return reservationsDAO.Reservation{}, fmt.Errorf("reservation %s: %w", id, reservationsDAO.ErrNotConfirmed)
+		}
+		if err != nil {
+			return reservationsDAO.Reservation{}, fmt.Errorf("error updating document: %w", err)
+		}
+		if err := repository.release(ctx, cancelled.RoomID, stayNights(cancelled.CheckIn, cancelled.CheckOut)); err != nil {
+			return reservationsDAO.Reservation{}, err
+		}
+		return cancelled, nil
+	})
+	return err
+}
+
+// reserve takes one unit of the room per night, it runs in the transaction of the reservation
+// which is aborted when a night is full
+func (repository Mongo) reserve(ctx mongo.SessionContext, roomID string, nights []time.Time, units int) error {
+	collection := repository.client.Database(repository.database).Collection(repository.inventoryCollection)
+	for _, night := range nights {
+		// Make sure the counter exists, concurrent transactions creating it conflict and are retried
+		filter := bson.M{"room_id": roomID, "date": night}
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": bson.M{"reserved": 0}}, options.Update().SetUpsert(true)); err != nil {
+			return fmt.Errorf("error creating night %s: %w", night.Format(time.DateOnly), err)
+		}
+
+		// The increment only matches while there are units left
+		filter["reserved"] = bson.M{"$lt": units}
+		result, err := collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"reserved": 1}})
+		if err != nil {
+			return fmt.Errorf("error reserving night %s: %w", night.Format(time.DateOnly), err)
+		}
+		if result.MatchedCount == 0 {
+			return reservationsDAO.ErrNoAvailability
+		}
+	}
+	return nil
+}
+
+// release gives back the nights of a cancelled reservation, in the transaction of the cancellation
+func (repository Mongo) release(ctx mongo.SessionContext, roomID string, nights []time.Time) error {
+	if len(nights) == 0 {
+		return nil
+	}
+
+	// Give back one unit for each night
+	filter := bson.M{"room_id": roomID, "date": bson.M{"$in": nights}, "reserved": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"reserved": -1}}
+	if _, err := repository.client.Database(repository.database).Collection(repository.inventoryCollection).UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("error releasing nights: %w", err)
+	}
+	return nil
+}
+
+// withOutbox runs a reservation change in a transaction along with its outbox entry, so the
+// event is recorded if and only if the change is committed
+func (repository Mongo) withOutbox(ctx context.Context, operation string, change func(ctx mongo.SessionContext) (reservationsDAO.Reservation, error)) (reservationsDAO.Reservation, error) {
+	session, err := repository.client.StartSession()
+	if err != nil {
+		return reservationsDAO.Reservation{}, fmt.Errorf("error starting mongo session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		reservation, err := change(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entry := outboxDAO.NewReservationEntry(operation, reservation)
+		if _, err := repository.client.Database(repository.database).Collection(repository.outboxCollection).InsertOne(ctx, entry); err != nil {
+			return nil, fmt.Errorf("error creating outbox entry: %w", err)
+		}
+		return reservation, nil
+	})
+	if err != nil {
+		return reservationsDAO.Reservation{}, err
+	}
+	return result.(reservationsDAO.Reservation), nil
+}
+
+// stayNights returns the dates of every night between check in and check out
+func stayNights(checkIn time.Time, checkOut time.Time) []time.Time {
+	nights := make([]time.Time, 0)
+	for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night)
+	}
+	return nights
+}
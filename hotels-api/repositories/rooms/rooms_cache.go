@@ -0,0 +1,114 @@
+package rooms
+
+import (
+	"context"
+	"fmt"
+	"github.com/karlseguin/ccache"
+	roomsDAO "hotels-api/dao/rooms"
+	"time"
+)
+
+const (
+	keyFormat = "room:%s"
+)
+
+type CacheConfig struct {
+	MaxSize      int64
+	ItemsToPrune uint32
+	Duration     time.Duration
+}
+
+type Cache struct {
+	client   *ccache.Cache
+	duration time.Duration
+}
+
+func NewCache(config CacheConfig) Cache {
+	client := ccache.New(ccache.Configure().
+		MaxSize(config.MaxSize).
+		ItemsToPrune(config.ItemsToPrune))
+	return Cache{
+		client:   client,
+		duration: config.Duration,
+	}
+}
+
+func (repository Cache) GetRoomByID(ctx context.Context, id string) (roomsDAO.Room, error) {
+	key := fmt.Sprintf(keyFormat, id)
+	item := repository.client.Get(key)
+	if item == nil {
+		return roomsDAO.Room{}, fmt.Errorf("not found item with key %s", key)
+	}
+	if item.Expired() {
+		return roomsDAO.Room{}, fmt.Errorf("item with key %s is expired", key)
+	}
+	roomDAO, ok := item.Value().(roomsDAO.Room)
+	if !ok {
+		return roomsDAO.Room{}, fmt.Errorf("error converting item with key %s", key)
+	}
+	return roomDAO, nil
+}
+
+func (repository Cache) ListByHotelID(ctx context.Context, hotelID string) ([]roomsDAO.Room, error) {
+	// Only single rooms are cached
+	return nil, fmt.Errorf("ListByHotelID not implemented in cache")
+}
+
+func (repository Cache) Export(ctx context.Context, fn func(room roomsDAO.Room) error) error {
+	// The cache only holds some of the rooms
+	return fmt.Errorf("Export not implemented in cache")
+}
+
+func (repository Cache) Create(ctx context.Context, room roomsDAO.Room) (string, error) {
+	key := fmt.Sprintf(keyFormat, room.ID)
+	repository.client.Set(key, room, repository.duration)
+	return room.ID, nil
+}
+
+func (repository Cache) Update(ctx context.Context, room roomsDAO.Room) error {
+	key := fmt.Sprintf(keyFormat, room.ID)
+
+	// Retrieve the current room data from the cache
+	item := repository.client.Get(key)
+	if item == nil {
+		return fmt.Errorf("room with ID %s not found in cache", room.ID)
+	}
+	if item.Expired() {
+		return fmt.Errorf("item with key %s is expired", key)
+	}
+
+	// Get the current room data
+	currentRoom, ok := item.Value().(roomsDAO.Room)
+	if !ok {
+		return fmt.Errorf("error converting item with key %s", key)
+	}
+
+	// Update only the fields that are non-zero or non-empty
+	if room.Name != "" {
+		currentRoom.Name = room.Name
+	}
+	if room.Capacity != 0 {
+		currentRoom.Capacity = room.Capacity
+	}
+	if len(room.Beds) > 0 {
+		currentRoom.Beds = room.Beds
+	}
+	if room.BasePrice != 0 {
+		currentRoom.BasePrice = room.BasePrice
+	}
+	if room.Units != 0 {
+		currentRoom.Units = room.Units
+	}
+
+	// Update the cache with the new room data and reset the expiration timer
+	repository.client.Set(key, currentRoom, repository.duration)
+
+	return nil
+}
+
+func (repository Cache) Delete(ctx context.Context, id string) error {
+	key := fmt.Sprintf(keyFormat, id)
+	// Remove the item from the cache
+	repository.client.Delete(key)
+	return nil
+}
@@ -0,0 +1,97 @@
+package rooms
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	roomsDAO "hotels-api/dao/rooms"
+	"sort"
+)
+
+type Mock struct {
+	docs map[string]roomsDAO.Room
+}
+
+func NewMock() Mock {
+	return Mock{
+		docs: make(map[string]roomsDAO.Room),
+	}
+}
+
+func (repository Mock) GetRoomByID(ctx context.Context, id string) (roomsDAO.Room, error) {
+	room, exists := repository.docs[id]
+	if !exists {
+		return roomsDAO.Room{}, fmt.Errorf("room with ID %s not found", id)
+	}
+	return room, nil
+}
+
+func (repository Mock) ListByHotelID(ctx context.Context, hotelID string) ([]roomsDAO.Room, error) {
+	rooms := make([]roomsDAO.Room, 0)
+	for _, room := range repository.docs {
+		if room.HotelID == hotelID {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+func (repository Mock) Export(ctx context.Context, fn func(room roomsDAO.Room) error) error {
+	ids := make([]string, 0, len(repository.docs))
+	for id := range repository.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := fn(repository.docs[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository Mock) Create(ctx context.Context, room roomsDAO.Room) (string, error) {
+	if room.ID == "" {
+		room.ID = uuid.New().String()
+	}
+	repository.docs[room.ID] = room
+	return room.ID, nil
+}
+
+func (repository Mock) Update(ctx context.Context, room roomsDAO.Room) error {
+	// Check if the room exists in the mock storage
+	currentRoom, exists := repository.docs[room.ID]
+	if !exists {
+		return fmt.Errorf("room with ID %s not found", room.ID)
+	}
+
+	// Update only the fields that are non-zero or non-empty
+	if room.Name != "" {
+		currentRoom.Name = room.Name
+	}
+	if room.Capacity != 0 {
+		currentRoom.Capacity = room.Capacity
+	}
+	if len(room.Beds) > 0 {
+		currentRoom.Beds = room.Beds
+	}
+	if room.BasePrice != 0 {
+		currentRoom.BasePrice = room.BasePrice
+	}
+	if room.Units != 0 {
+		currentRoom.Units = room.Units
+	}
+
+	// Save the updated room back to the mock storage
+	repository.docs[room.ID] = currentRoom
+	return nil
+}
+
+func (repository Mock) Delete(ctx context.Context, id string) error {
+	if _, exists := repository.docs[id]; !exists {
+		return fmt.Errorf("room with ID %s not found", id)
+	}
+	// Remove the room from the mock storage
+	delete(repository.docs, id)
+	return nil
+}
@@ -0,0 +1,240 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	outboxDAO "hotels-api/dao/outbox"
+	roomsDAO "hotels-api/dao/rooms"
+	"log"
+)
+
+type MongoConfig struct {
+	Host             string
+	Port             string
+	Username         string
+	Password         string
+	Database         string
+	Collection       string
+	OutboxCollection string
+}
+
+type Mongo struct {
+	client           *mongo.Client
+	database         string
+	collection       string
+	outboxCollection string
+}
+
+const (
+	connectionURI   = "mongodb://%s:%s"
+	exportBatchSize = 500
+)
+
+func NewMongo(config MongoConfig) Mongo {
+	credentials := options.Credential{
+		Username: config.Username,
+		Password: config.Password,
+	}
+
+	ctx := context.Background()
+	uri := fmt.Sprintf(connectionURI, config.Host, config.Port)
+	cfg := options.Client().ApplyURI(uri).SetAuth(credentials)
+
+	client, err := mongo.Connect(ctx, cfg)
+	if err != nil {
+		log.Panicf("error connecting to mongo DB: %v", err)
+	}
+
+	// Rooms are always looked up by hotel
+	index := mongo.IndexModel{Keys: bson.D{{Key: "hotel_id", Value: 1}}}
+	if _, err := client.Database(config.Database).Collection(config.Collection).Indexes().CreateOne(ctx, index); err != nil {
+		log.Printf("error creating mongo indexes: %v", err)
+	}
+
+	return Mongo{
+		client:           client,
+		database:         config.Database,
+		collection:       config.Collection,
+		outboxCollection: config.OutboxCollection,
+	}
+}
+
+func (repository Mongo) GetRoomByID(ctx context.Context, id string) (roomsDAO.Room, error) {
+	// Get from MongoDB
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return roomsDAO.Room{}, fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+	result := repository.client.Database(repository.database).Collection(repository.collection).FindOne(ctx, bson.M{"_id": objectID})
+	if result.Err() != nil {
+		return roomsDAO.Room{}, fmt.Errorf("error finding document: %w", result.Err())
+	}
+
+	// Convert document to DAO
+	var roomDAO roomsDAO.Room
+	if err := result.Decode(&roomDAO); err != nil {
+		return roomsDAO.Room{}, fmt.Errorf("error decoding result: %w", err)
+	}
+	return roomDAO, nil
+}
+
+func (repository Mongo) ListByHotelID(ctx context.Context, hotelID string) ([]roomsDAO.Room, error) {
+	// Find all the rooms of the hotel
+	cursor, err := repository.client.Database(repository.database).Collection(repository.collection).Find(ctx, bson.M{"hotel_id": hotelID})
+	if err != nil {
+		return nil, fmt.Errorf("error finding documents: %w", err)
+	}
+
+	// Convert documents to DAOs
+	rooms := make([]roomsDAO.Room, 0)
+	if err := cursor.All(ctx, &rooms); err != nil {
+		return nil, fmt.Errorf("error decoding results: %w", err)
+	}
+	return rooms, nil
+}
+
+// Export calls fn with every room in ID order, reading them in batches
+func (repository Mongo) Export(ctx context.Context, fn func(room roomsDAO.Room) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize)
+	cursor, err := repository.client.Database(repository.database).Collection(repository.collection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return fmt.Errorf("error finding documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var room roomsDAO.Room
+		if err := cursor.Decode(&room); err != nil {
+			return fmt.Errorf("error decoding result: %w", err)
+		}
+		if err := fn(room); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error iterating documents: %w", err)
+	}
+	return nil
+}
+
+func (repository Mongo) Create(ctx context.Context, room roomsDAO.Room) (string, error) {
+	// Insert into mongo along with the outbox entry
+	room, err := repository.withOutbox(ctx, "ROOM_CREATE", func(ctx mongo.SessionContext) (roomsDAO.Room, error) {
+		result, err := repository.client.Database(repository.database).Collection(repository.collection).InsertOne(ctx, room)
+		if err != nil {
+			return roomsDAO.Room{}, fmt.Errorf("error creating document: %w", err)
+		}
+
+		// Get inserted ID
+		objectID, ok := result.InsertedID.(primitive.ObjectID)
+		if !ok {
+			return roomsDAO.Room{}, fmt.Errorf("error converting mongo ID to object ID")
+		}
+		room.ID = objectID.Hex()
+		return room, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return room.ID, nil
+}
+
+func (repository Mongo) Update(ctx context.Context, room roomsDAO.Room) error {
+	// Convert room ID to MongoDB ObjectID
+	objectID, err := primitive.ObjectIDFromHex(room.ID)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+
+	// Only set the fields that are not empty or their default value
+	update := bson.M{}
+	if room.Name != "" {
+		update["name"] = room.Name
+	}
+	if room.Capacity != 0 {
+		update["capacity"] = room.Capacity
+	}
+	if len(room.Beds) > 0 {
+		update["beds"] = room.Beds
+	}
+	if room.BasePrice != 0 {
+		update["base_price"] = room.BasePrice
+	}
+	if room.Units != 0 {
+		update["units"] = room.Units
+	}
+	if len(update) == 0 {
+		return fmt.Errorf("no fields to update for room ID %s", room.ID)
+	}
+
+	// Update the document in MongoDB along with the outbox entry
+	filter := bson.M{"_id": objectID}
+	_, err = repository.withOutbox(ctx, "ROOM_UPDATE", func(ctx mongo.SessionContext) (roomsDAO.Room, error) {
+		var updated roomsDAO.Room
+		err := repository.client.Database(repository.database).Collection(repository.collection).
+			FindOneAndUpdate(ctx, filter, bson.M{"$set": update}, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&updated)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return roomsDAO.Room{}, fmt.Errorf("no document found with ID %s", room.ID)
+		}
+		if err != nil {
+			return roomsDAO.Room{}, fmt.Errorf("error updating document: %w", err)
+		}
+		return updated, nil
+	})
+	return err
+}
+
+func (repository Mongo) Delete(ctx context.Context, id string) error {
+	// Convert room ID to MongoDB ObjectID
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("error converting id to mongo ID: %w", err)
+	}
+
+	// Delete the document from MongoDB along with the outbox entry
+	filter := bson.M{"_id": objectID}
+	_, err = repository.withOutbox(ctx, "ROOM_DELETE", func(ctx mongo.SessionContext) (roomsDAO.Room, error) {
+		var deleted roomsDAO.Room
+		err := repository.client.Database(repository.database).Collection(repository.collection).FindOneAndDelete(ctx, filter).Decode(&deleted)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return roomsDAO.Room{}, fmt.Errorf("no document found with ID %s", id)
+		}
+		if err != nil {
+			return roomsDAO.Room{}, fmt.Errorf("error deleting document: %w", err)
+		}
+		return deleted, nil
+	})
+	return err
+}
+
+// withOutbox runs a room change in a transaction along with its outbox entry, so the event
+// is recorded if and only if the change is committed
+func (repository Mongo) withOutbox(ctx context.Context, operation string, change func(ctx mongo.SessionContext) (roomsDAO.Room, error)) (roomsDAO.Room, error) {
+	session, err := repository.client.StartSession()
+	if err != nil {
+		return roomsDAO.Room{}, fmt.Errorf("error starting mongo session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		room, err := change(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entry := outboxDAO.NewRoomEntry(operation, room.HotelID, room.ID)
+		if _, err := repository.client.Database(repository.database).Collection(repository.outboxCollection).InsertOne(ctx, entry); err != nil {
+			return nil, fmt.Errorf("error creating outbox entry: %w", err)
+		}
+		return room, nil
+	})
+	if err != nil {
+		return roomsDAO.Room{}, err
+	}
+	return result.(roomsDAO.Room), nil
+}
@@ -2,33 +2,33 @@ package hotels
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	hotelsDAO "hotels-api/dao/hotels"
 	hotelsDomain "hotels-api/domain/hotels"
+	"log"
 )
 
 type Repository interface {
 	GetHotelByID(ctx context.Context, id string) (hotelsDAO.Hotel, error)
+	List(ctx context.Context, filter hotelsDAO.ListFilter) (hotelsDAO.ListResult, error)
 	Create(ctx context.Context, hotel hotelsDAO.Hotel) (string, error)
 	Update(ctx context.Context, hotel hotelsDAO.Hotel) error
 	Delete(ctx context.Context, id string) error
-}
-
-type Queue interface {
-	Publish(hotelNew hotelsDomain.HotelNew) error
+	Export(ctx context.Context, fn func(hotel hotelsDAO.Hotel) error) error
 }
 
 type Service struct {
 	mainRepository  Repository
 	cacheRepository Repository
-	eventsQueue     Queue
 }
 
-func NewService(mainRepository Repository, cacheRepository Repository, eventsQueue Queue) Service {
+// NewService creates the hotels service, change events are recorded by the main repository
+// in its outbox along with each change and published from there
+func NewService(mainRepository Repository, cacheRepository Repository) Service {
 	return Service{
 		mainRepository:  mainRepository,
 		cacheRepository: cacheRepository,
-		eventsQueue:     eventsQueue,
 	}
 }
 
@@ -42,7 +42,7 @@ func (service Service) GetHotelByID(ctx context.Context, id string) (hotelsDomai
 		}
 		// Set ID from main repository to use in the rest of the repositories
 		if _, err := service.cacheRepository.Create(ctx, hotelDAO); err != nil {
-			return hotelsDomain.Hotel{}, fmt.Errorf("error creating hotel in cache: %w", err)
+			log.Printf("error creating hotel %s in cache: %v", id, err)
 		}
 	}
 
@@ -55,10 +55,77 @@ func (service Service) GetHotelByID(ctx context.Context, id string) (hotelsDomai
 		State:     hotelDAO.State,
 		Rating:    hotelDAO.Rating,
 		Amenities: hotelDAO.Amenities,
+		Latitude:  hotelDAO.Location.Latitude(),
+		Longitude: hotelDAO.Location.Longitude(),
+	}, nil
+}
+
+func (service Service) List(ctx context.Context, request hotelsDomain.ListRequest) (hotelsDomain.ListResponse, error) {
+	// Listing always goes to the main repository, the cache only holds single hotels
+	result, err := service.mainRepository.List(ctx, hotelsDAO.ListFilter{
+		City:      request.City,
+		State:     request.State,
+		MinRating: request.MinRating,
+		Amenities: request.Amenities,
+		Sort:      request.Sort,
+		Cursor:    request.Cursor,
+		Limit:     request.Limit,
+	})
+	if errors.Is(err, hotelsDAO.ErrInvalidCursor) {
+		return hotelsDomain.ListResponse{}, fmt.Errorf("%w: %s", hotelsDomain.ErrInvalidCursor, request.Cursor)
+	}
+	if err != nil {
+		return hotelsDomain.ListResponse{}, fmt.Errorf("error listing hotels from repository: %w", err)
+	}
+
+	// Convert DAOs to DTOs
+	hotels := make([]hotelsDomain.Hotel, 0, len(result.Hotels))
+	for _, hotelDAO := range result.Hotels {
+		hotels = append(hotels, hotelsDomain.Hotel{
+			ID:        hotelDAO.ID,
+			Name:      hotelDAO.Name,
+			Address:   hotelDAO.Address,
+			City:      hotelDAO.City,
+			State:     hotelDAO.State,
+			Rating:    hotelDAO.Rating,
+			Amenities: hotelDAO.Amenities,
+			Latitude:  hotelDAO.Location.Latitude(),
+			Longitude: hotelDAO.Location.Longitude(),
+		})
+	}
+
+	return hotelsDomain.ListResponse{
+		Hotels:     hotels,
+		NextCursor: result.NextCursor,
+		Total:      result.Total,
 	}, nil
 }
 
+// Export calls fn with every hotel, with its version, straight from the main repository
+func (service Service) Export(ctx context.Context, fn func(hotel hotelsDomain.Hotel) error) error {
+	if err := service.mainRepository.Export(ctx, func(hotelDAO hotelsDAO.Hotel) error {
+		return fn(hotelsDomain.Hotel{
+			ID:        hotelDAO.ID,
+			Name:      hotelDAO.Name,
+			Address:   hotelDAO.Address,
+			City:      hotelDAO.City,
+			State:     hotelDAO.State,
+			Rating:    hotelDAO.Rating,
+			Amenities: hotelDAO.Amenities,
+			Latitude:  hotelDAO.Location.Latitude(),
+			Longitude: hotelDAO.Location.Longitude(),
+			Version:   hotelDAO.Version,
+		})
+	}); err != nil {
+		return fmt.Errorf("error exporting hotels from repository: %w", err)
+	}
+	return nil
+}
+
 func (service Service) Create(ctx context.Context, hotel hotelsDomain.Hotel) (string, error) {
+	if err := validateLocation(hotel.Latitude, hotel.Longitude); err != nil {
+		return "", err
+	}
 	record := hotelsDAO.Hotel{
 		Name:      hotel.Name,
 		Address:   hotel.Address,
@@ -66,6 +133,7 @@ func (service Service) Create(ctx context.Context, hotel hotelsDomain.Hotel) (st
 		State:     hotel.State,
 		Rating:    hotel.Rating,
 		Amenities: hotel.Amenities,
+		Location:  hotelsDAO.NewLocation(hotel.Latitude, hotel.Longitude),
 	}
 	id, err := service.mainRepository.Create(ctx, record)
 	if err != nil {
@@ -74,28 +142,31 @@ func (service Service) Create(ctx context.Context, hotel hotelsDomain.Hotel) (st
 	// Set ID from main repository to use in the rest of the repositories
 	record.ID = id
 	if _, err := service.cacheRepository.Create(ctx, record); err != nil {
-		return "", fmt.Errorf("error creating hotel in cache: %w", err)
-	}
-	if err := service.eventsQueue.Publish(hotelsDomain.HotelNew{
-		Operation: "CREATE",
-		HotelID:   id,
-	}); err != nil {
-		return "", fmt.Errorf("error publishing hotel new: %w", err)
+		log.Printf("error creating hotel %s in cache: %v", id, err)
 	}
 
 	return id, nil
 }
 
-func (service Service) Update(ctx context.Context, hotel hotelsDomain.Hotel) error {
-	// Convert domain model to DAO model
+func (service Service) Update(ctx context.Context, id string, request hotelsDomain.UpdateRequest) error {
+	if err := validateLocation(request.Latitude, request.Longitude); err != nil {
+		return err
+	}
+	if request.ClearLocation && request.Latitude != nil {
+		return fmt.Errorf("%w: a location can't be set and cleared at once", hotelsDomain.ErrInvalidLocation)
+	}
+
+	// Convert domain model to DAO model, the location is kept unless it's replaced or cleared
 	record := hotelsDAO.Hotel{
-		ID:        hotel.ID,
-		Name:      hotel.Name,
-		Address:   hotel.Address,
-		City:      hotel.City,
-		State:     hotel.State,
-		Rating:    hotel.Rating,
-		Amenities: hotel.Amenities,
+		ID:            id,
+		Name:          request.Name,
+		Address:       request.Address,
+		City:          request.City,
+		State:         request.State,
+		Rating:        request.Rating,
+		Amenities:     request.Amenities,
+		Location:      hotelsDAO.NewLocation(request.Latitude, request.Longitude),
+		ClearLocation: request.ClearLocation,
 	}
 
 	// Update the hotel in the main repository
@@ -104,17 +175,10 @@ func (service Service) Update(ctx context.Context, hotel hotelsDomain.Hotel) err
 		return fmt.Errorf("error updating hotel in main repository: %w", err)
 	}
 
-	// Try to update the hotel in the cache repository
-	if err := service.cacheRepository.Update(ctx, record); err != nil {
-		return fmt.Errorf("error updating hotel in cache: %w", err)
-	}
-
-	// Publish an event for the update operation
-	if err := service.eventsQueue.Publish(hotelsDomain.HotelNew{
-		Operation: "UPDATE",
-		HotelID:   hotel.ID,
-	}); err != nil {
-		return fmt.Errorf("error publishing hotel update: %w", err)
+	// The update is committed, drop the cached hotel so the next read gets it from the main
+	// repository. The cache is best effort, it expires on its own if this fails
+	if err := service.cacheRepository.Delete(ctx, id); err != nil {
+		log.Printf("error invalidating hotel %s in cache: %v", id, err)
 	}
 
 	return nil
@@ -127,18 +191,27 @@ func (service Service) Delete(ctx context.Context, id string) error {
 		return fmt.Errorf("error deleting hotel from main repository: %w", err)
 	}
 
-	// Try to delete the hotel from the cache repository
+	// Try to delete the hotel from the cache repository, the delete is committed anyway
 	if err := service.cacheRepository.Delete(ctx, id); err != nil {
-		return fmt.Errorf("error deleting hotel from cache: %w", err)
+		log.Printf("error deleting hotel %s from cache: %v", id, err)
 	}
 
-	// Publish an event for the delete operation
-	if err := service.eventsQueue.Publish(hotelsDomain.HotelNew{
-		Operation: "DELETE",
-		HotelID:   id,
-	}); err != nil {
-		return fmt.Errorf("error publishing hotel delete: %w", err)
-	}
+	return nil
+}
 
+// validateLocation checks the coordinates are set together and within the valid ranges
+func validateLocation(latitude *float64, longitude *float64) error {
+	if (latitude == nil) != (longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be set together", hotelsDomain.ErrInvalidLocation)
+	}
+	if latitude == nil {
+		return nil
+	}
+	if *latitude < -90 || *latitude > 90 {
+		return fmt.Errorf("%w: latitude must be between -90 and 90", hotelsDomain.ErrInvalidLocation)
+	}
+	if *longitude < -180 || *longitude > 180 {
+		return fmt.Errorf("%w: longitude must be between -180 and 180", hotelsDomain.ErrInvalidLocation)
+	}
 	return nil
 }
@@ -1 +1,148 @@
-package hotels
+package hotels_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	hotelsDAO "hotels-api/dao/hotels"
+	hotelsDomain "hotels-api/domain/hotels"
+	repositories "hotels-api/repositories/hotels"
+	services "hotels-api/services/hotels"
+	"testing"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	mainRepo := repositories.NewMock()
+	service := services.NewService(mainRepo, repositories.NewMock())
+
+	for _, hotel := range []hotelsDomain.Hotel{
+		{Name: "Hotel A", City: "Cordoba", Rating: 4.5, Amenities: []string{"wifi", "pool"}},
+		{Name: "Hotel B", City: "Cordoba", Rating: 3.0, Amenities: []string{"wifi"}},
+		{Name: "Hotel C", City: "Rosario", Rating: 5.0, Amenities: []string{"wifi", "pool"}},
+	} {
+		_, err := service.Create(ctx, hotel)
+		assert.NoError(t, err)
+	}
+
+	t.Run("List - Filters", func(t *testing.T) {
+		response, err := service.List(ctx, hotelsDomain.ListRequest{
+			City:      "Cordoba",
+			Amenities: []string{"pool"},
+			Limit:     10,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), response.Total)
+		assert.Equal(t, "Hotel A", response.Hotels[0].Name)
+		assert.Empty(t, response.NextCursor)
+	})
+
+	t.Run("List - Sort and Pagination", func(t *testing.T) {
+		first, err := service.List(ctx, hotelsDomain.ListRequest{
+			Sort:  hotelsDomain.SortByRatingDesc,
+			Limit: 2,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), first.Total)
+		assert.Equal(t, []string{"Hotel C", "Hotel A"}, []string{first.Hotels[0].Name, first.Hotels[1].Name})
+		assert.NotEmpty(t, first.NextCursor)
+
+		second, err := service.List(ctx, hotelsDomain.ListRequest{
+			Sort:   hotelsDomain.SortByRatingDesc,
+			Cursor: first.NextCursor,
+			Limit:  2,
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, second.Hotels, 1)
+		assert.Equal(t, "Hotel B", second.Hotels[0].Name)
+		assert.Empty(t, second.NextCursor)
+	})
+
+	t.Run("List - Invalid Cursor", func(t *testing.T) {
+		_, err := service.List(ctx, hotelsDomain.ListRequest{
+			Cursor: "not-a-cursor",
+			Limit:  2,
+		})
+
+		assert.ErrorIs(t, err, hotelsDomain.ErrInvalidCursor)
+	})
+
+	t.Run("Export - All Hotels", func(t *testing.T) {
+		names := make([]string, 0)
+		err := service.Export(ctx, func(hotel hotelsDomain.Hotel) error {
+			names = append(names, hotel.Name)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Hotel A", "Hotel B", "Hotel C"}, names)
+	})
+
+	t.Run("Export - Stops On Error", func(t *testing.T) {
+		calls := 0
+		err := service.Export(ctx, func(hotel hotelsDomain.Hotel) error {
+			calls++
+			return errors.New("client gone")
+		})
+
+		assert.ErrorContains(t, err, "client gone")
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Update - Not Cached", func(t *testing.T) {
+		id, err := mainRepo.Create(ctx, hotelsDAO.Hotel{Name: "Hotel E", City: "Mendoza"})
+		assert.NoError(t, err)
+
+		// The hotel was never read, so it isn't in the cache
+		assert.NoError(t, service.Update(ctx, id, hotelsDomain.UpdateRequest{Name: "Hotel E2"}))
+		hotel, err := service.GetHotelByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hotel E2", hotel.Name)
+		assert.Equal(t, "Mendoza", hotel.City)
+	})
+
+	t.Run("Update - Location", func(t *testing.T) {
+		latitude, longitude := -31.4, -64.2
+		id, err := service.Create(ctx, hotelsDomain.Hotel{Name: "Hotel D", Latitude: &latitude, Longitude: &longitude})
+		assert.NoError(t, err)
+
+		// Updates without coordinates keep the location
+		assert.NoError(t, service.Update(ctx, id, hotelsDomain.UpdateRequest{Name: "Hotel D2"}))
+		hotel, err := service.GetHotelByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hotel D2", hotel.Name)
+		assert.Equal(t, &latitude, hotel.Latitude)
+		assert.Equal(t, &longitude, hotel.Longitude)
+
+		// A latitude alone is rejected
+		moved := 10.0
+		err = service.Update(ctx, id, hotelsDomain.UpdateRequest{Latitude: &moved})
+		assert.ErrorIs(t, err, hotelsDomain.ErrInvalidLocation)
+
+		// Zero is a valid coordinate
+		zero := 0.0
+		assert.NoError(t, service.Update(ctx, id, hotelsDomain.UpdateRequest{Latitude: &zero, Longitude: &zero}))
+		hotel, err = service.GetHotelByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, &zero, hotel.Latitude)
+		assert.Equal(t, &zero, hotel.Longitude)
+
+		assert.NoError(t, service.Update(ctx, id, hotelsDomain.UpdateRequest{ClearLocation: true}))
+		hotel, err = service.GetHotelByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Nil(t, hotel.Latitude)
+		assert.Nil(t, hotel.Longitude)
+	})
+
+	t.Run("Create - Invalid Location", func(t *testing.T) {
+		latitude, longitude := 91.0, 0.0
+		_, err := service.Create(ctx, hotelsDomain.Hotel{Name: "Hotel F", Latitude: &latitude, Longitude: &longitude})
+		assert.ErrorIs(t, err, hotelsDomain.ErrInvalidLocation)
+
+		_, err = service.Create(ctx, hotelsDomain.Hotel{Name: "Hotel F", Longitude: &longitude})
+		assert.ErrorIs(t, err, hotelsDomain.ErrInvalidLocation)
+	})
+}
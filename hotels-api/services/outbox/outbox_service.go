@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	outboxDAO "hotels-api/dao/outbox"
+	hotelsDomain "hotels-api/domain/hotels"
+	reservationsDomain "hotels-api/domain/reservations"
+	"log"
+	"time"
+)
+
+type Repository interface {
+	Claim(ctx context.Context, lease time.Duration) (outboxDAO.Entry, bool, error)
+	MarkDelivered(ctx context.Context, id string) error
+	Release(ctx context.Context, id string, retryAt time.Time, cause error) error
+	MarkFailed(ctx context.Context, id string, cause error) error
+}
+
+type Queue interface {
+	Publish(hotelNew hotelsDomain.HotelNew) error
+}
+
+type Config struct {
+	PollInterval time.Duration // Wait between polls once the outbox is drained
+	Lease        time.Duration // How long a claimed entry is hidden from other relays
+	RetryBackoff time.Duration // Wait before retrying after publishing fails, doubled on each failure in a row
+	MaxBackoff   time.Duration // Longest wait between retries
+}
+
+// Service relays the pending outbox entries to the events queue
+type Service struct {
+	repository  Repository
+	eventsQueue Queue
+	config      Config
+}
+
+func NewService(repository Repository, eventsQueue Queue, config Config) Service {
+	return Service{
+		repository:  repository,
+		eventsQueue: eventsQueue,
+		config:      config,
+	}
+}
+
+// Run relays entries until the context is cancelled, backing off while relaying fails
+func (service Service) Run(ctx context.Context) {
+	backoff := time.Duration(0)
+	for {
+		wait := service.config.PollInterval
+		if _, err := service.RelayPending(ctx); err != nil {
+			log.Printf("error relaying outbox: %v", err)
+			backoff = min(max(2*backoff, service.config.RetryBackoff), service.config.MaxBackoff)
+			wait = backoff
+		} else {
+			backoff = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayPending publishes the pending entries oldest first until the outbox is drained or
+// publishing fails, returning how many were delivered. An entry that fails to publish is
+// released right away, so it's the first one retried once the queue is back, while the entries
+// that can never be published are parked as failed
+func (service Service) RelayPending(ctx context.Context) (int, error) {
+	delivered := 0
+	for ctx.Err() == nil {
+		entry, found, err := service.repository.Claim(ctx, service.config.Lease)
+		if err != nil {
+			return delivered, err
+		}
+		if !found {
+			return delivered, nil
+		}
+
+		hotelNew, err := toHotelNew(entry)
+		if err == nil {
+			err = service.eventsQueue.Publish(hotelNew)
+		}
+		if errors.Is(err, hotelsDomain.ErrInvalidEvent) {
+			log.Printf("OUTBOX ENTRY FAILED: %s event (%s) of hotel (%s) can't be published and is parked: %v",
+				entry.Operation, entry.ID, entry.HotelID, err)
+			if err := service.repository.MarkFailed(ctx, entry.ID, err); err != nil {
+				return delivered, fmt.Errorf("error marking outbox entry (%s) as failed: %w", entry.ID, err)
+			}
+			continue
+		}
+		if err != nil {
+			// The queue is likely down, stop here and let Run back off
+			if err := service.repository.Release(ctx, entry.ID, time.Now(), err); err != nil {
+				log.Printf("error releasing outbox entry (%s): %v", entry.ID, err)
+			}
+			return delivered, fmt.Errorf("error publishing outbox entry (%s): %w", entry.ID, err)
+		}
+
+		// Failing here publishes the entry again once the lease expires, never drops it
+		if err := service.repository.MarkDelivered(ctx, entry.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, ctx.Err()
+}
+
+// toHotelNew builds the event for an entry, identified by the entry itself so that publishing
+// it again produces the same event
+func toHotelNew(entry outboxDAO.Entry) (hotelsDomain.HotelNew, error) {
+	if entry.Operation == "" || entry.HotelID == "" {
+		return hotelsDomain.HotelNew{}, fmt.Errorf("%w: entry without operation or hotel ID", hotelsDomain.ErrInvalidEvent)
+	}
+
+	hotelNew := hotelsDomain.HotelNew{
+		EventID:   entry.ID,
+		Timestamp: entry.CreatedAt,
+		Operation: entry.Operation,
+		HotelID:   entry.HotelID,
+		Version:   entry.Version,
+		RoomID:    entry.RoomID,
+	}
+	if entry.ReservationID != "" {
+		hotelNew.ReservationID = entry.ReservationID
+		hotelNew.CheckIn = entry.CheckIn.UTC().Format(reservationsDomain.DateLayout)
+		hotelNew.CheckOut = entry.CheckOut.UTC().Format(reservationsDomain.DateLayout)
+	}
+	if entry.Hotel != nil {
+		hotelNew.Hotel = &hotelsDomain.Hotel{
+			ID:        entry.Hotel.ID,
+			Name:      entry.Hotel.Name,
+			Address:   entry.Hotel.Address,
+			City:      entry.Hotel.City,
+			State:     entry.Hotel.State,
+			Rating:    entry.Hotel.Rating,
+			Amenities: entry.Hotel.Amenities,
+			Latitude:  entry.Hotel.Location.Latitude(),
+			Longitude: entry.Hotel.Location.Longitude(),
+		}
+	}
+	return hotelNew, nil
+}
@@ -0,0 +1,164 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	hotelsDAO "hotels-api/dao/hotels"
+	outboxDAO "hotels-api/dao/outbox"
+	reservationsDAO "hotels-api/dao/reservations"
+	hotelsDomain "hotels-api/domain/hotels"
+	repositories "hotels-api/repositories/outbox"
+	services "hotels-api/services/outbox"
+	"testing"
+	"time"
+)
+
+// queue records the published events and fails while err is set
+type queue struct {
+	published *[]hotelsDomain.HotelNew
+	err       *error
+}
+
+func (queue queue) Publish(hotelNew hotelsDomain.HotelNew) error {
+	if *queue.err != nil {
+		return *queue.err
+	}
+	*queue.published = append(*queue.published, hotelNew)
+	return nil
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	repository := repositories.NewMock()
+	published := make([]hotelsDomain.HotelNew, 0)
+	var publishErr error
+	service := services.NewService(repository, queue{published: &published, err: &publishErr}, services.Config{
+		PollInterval: time.Millisecond,
+		Lease:        time.Minute,
+		RetryBackoff: time.Minute,
+		MaxBackoff:   time.Hour,
+	})
+
+	now := time.Now().UTC().Add(-time.Second)
+	addEntry := func(operation string, hotelID string, version int64, offset int) string {
+		var snapshot *hotelsDAO.Hotel
+		if operation != "DELETE" {
+			snapshot = &hotelsDAO.Hotel{ID: hotelID, Name: fmt.Sprintf("Hotel %s v%d", hotelID, version), Version: version}
+		}
+		entry := outboxDAO.NewEntry(operation, hotelID, version, snapshot)
+		entry.CreatedAt = now.Add(time.Duration(offset) * time.Millisecond)
+		entry.LockedUntil = entry.CreatedAt
+		return repository.Add(entry)
+	}
+
+	t.Run("RelayPending - Publishes In Order", func(t *testing.T) {
+		first := addEntry("CREATE", "1", 1, 0)
+		second := addEntry("UPDATE", "1", 2, 1)
+
+		delivered, err := service.RelayPending(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Len(t, published, 2)
+		for i, id := range []string{first, second} {
+			entry, _ := repository.Get(id)
+			assert.Equal(t, outboxDAO.StatusDelivered, entry.Status)
+
+			// The event is identified by its outbox entry and carries the snapshot
+			assert.Equal(t, id, published[i].EventID)
+			assert.Equal(t, entry.CreatedAt, published[i].Timestamp)
+			assert.Equal(t, entry.Operation, published[i].Operation)
+			assert.Equal(t, int64(i+1), published[i].Version)
+			assert.Equal(t, fmt.Sprintf("Hotel 1 v%d", i+1), published[i].Hotel.Name)
+		}
+
+		// Delivered entries aren't published again
+		delivered, err = service.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+	})
+
+	t.Run("RelayPending - Room And Reservation Events", func(t *testing.T) {
+		published = published[:0]
+		room := outboxDAO.NewRoomEntry("ROOM_CREATE", "1", "room-1")
+		room.CreatedAt = now.Add(5 * time.Millisecond)
+		room.LockedUntil = room.CreatedAt
+		repository.Add(room)
+		checkIn := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+		reservation := outboxDAO.NewReservationEntry("RESERVATION_CREATE", reservationsDAO.Reservation{
+			ID:       "reservation-1",
+			HotelID:  "1",
+			RoomID:   "room-1",
+			CheckIn:  checkIn,
+			CheckOut: checkIn.AddDate(0, 0, 2),
+		})
+		reservation.CreatedAt = now.Add(6 * time.Millisecond)
+		reservation.LockedUntil = reservation.CreatedAt
+		repository.Add(reservation)
+
+		delivered, err := service.RelayPending(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Len(t, published, 2)
+		assert.Equal(t, "ROOM_CREATE", published[0].Operation)
+		assert.Equal(t, "room-1", published[0].RoomID)
+		assert.Nil(t, published[0].Hotel)
+		assert.Equal(t, "RESERVATION_CREATE", published[1].Operation)
+		assert.Equal(t, "reservation-1", published[1].ReservationID)
+		assert.Equal(t, "room-1", published[1].RoomID)
+		assert.Equal(t, "2030-01-10", published[1].CheckIn)
+		assert.Equal(t, "2030-01-12", published[1].CheckOut)
+	})
+
+	t.Run("RelayPending - Broker Outage", func(t *testing.T) {
+		published = published[:0]
+		publishErr = errors.New("connection closed")
+		first := addEntry("DELETE", "2", 3, 10)
+		second := addEntry("CREATE", "3", 1, 11)
+
+		// However long the outage lasts the entries stay pending
+		for attempt := 0; attempt < 20; attempt++ {
+			delivered, err := service.RelayPending(ctx)
+			assert.Error(t, err)
+			assert.Equal(t, 0, delivered)
+		}
+		assert.Empty(t, published)
+		entry, _ := repository.Get(first)
+		assert.Equal(t, outboxDAO.StatusPending, entry.Status)
+		assert.Equal(t, "connection closed", entry.LastError)
+
+		// Once the broker is back they are published in order
+		publishErr = nil
+		delivered, err := service.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Len(t, published, 2)
+		assert.Equal(t, first, published[0].EventID)
+		assert.Equal(t, second, published[1].EventID)
+	})
+
+	t.Run("RelayPending - Invalid Event", func(t *testing.T) {
+		published = published[:0]
+		invalid := addEntry("UPDATE", "", 2, 20)
+		next := addEntry("CREATE", "4", 1, 21)
+
+		delivered, err := service.RelayPending(ctx)
+
+		// The entry is parked and the following one isn't held up by it
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Len(t, published, 1)
+		assert.Equal(t, next, published[0].EventID)
+		entry, _ := repository.Get(invalid)
+		assert.Equal(t, outboxDAO.StatusFailed, entry.Status)
+		assert.Contains(t, entry.LastError, hotelsDomain.ErrInvalidEvent.Error())
+
+		// Parked entries aren't claimed again
+		delivered, err = service.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+	})
+}
@@ -0,0 +1,181 @@
+package reservations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	reservationsDAO "hotels-api/dao/reservations"
+	roomsDAO "hotels-api/dao/rooms"
+	reservationsDomain "hotels-api/domain/reservations"
+	"time"
+)
+
+const (
+	maxNights = 30
+)
+
+type Repository interface {
+	GetReservationByID(ctx context.Context, id string) (reservationsDAO.Reservation, error)
+	ListByUserID(ctx context.Context, userID int64) ([]reservationsDAO.Reservation, error)
+	ExportActive(ctx context.Context, from time.Time, fn func(reservation reservationsDAO.Reservation) error) error
+	Create(ctx context.Context, reservation reservationsDAO.Reservation, nights []time.Time, units int) (string, error)
+	Cancel(ctx context.Context, id string) error
+}
+
+type RoomsRepository interface {
+	GetRoomByID(ctx context.Context, id string) (roomsDAO.Room, error)
+}
+
+type Service struct {
+	repository      Repository
+	roomsRepository RoomsRepository
+}
+
+func NewService(repository Repository, roomsRepository RoomsRepository) Service {
+	return Service{
+		repository:      repository,
+		roomsRepository: roomsRepository,
+	}
+}
+
+func (service Service) GetReservationByID(ctx context.Context, userID int64, id string) (reservationsDomain.Reservation, error) {
+	reservationDAO, err := service.repository.GetReservationByID(ctx, id)
+	if err != nil {
+		return reservationsDomain.Reservation{}, fmt.Errorf("error getting reservation from repository: %v: %w", err, reservationsDomain.ErrNotFound)
+	}
+
+	// Users can only see their own reservations
+	if reservationDAO.UserID != userID {
+		return reservationsDomain.Reservation{}, fmt.Errorf("reservation %s of another user: %w", id, reservationsDomain.ErrNotFound)
+	}
+
+	return toDomain(reservationDAO), nil
+}
+
+func (service Service) ListByUserID(ctx context.Context, userID int64) ([]reservationsDomain.Reservation, error) {
+	reservationsDAOList, err := service.repository.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing reservations from repository: %w", err)
+	}
+
+	reservations := make([]reservationsDomain.Reservation, 0, len(reservationsDAOList))
+	for _, reservationDAO := range reservationsDAOList {
+		reservations = append(reservations, toDomain(reservationDAO))
+	}
+	return reservations, nil
+}
+
+// ExportStays calls fn with the stay of every confirmed reservation that hasn't checked out yet,
+// so that the availability of the rooms can be rebuilt
+func (service Service) ExportStays(ctx context.Context, fn func(stay reservationsDomain.Stay) error) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if err := service.repository.ExportActive(ctx, today, func(reservation reservationsDAO.Reservation) error {
+		return fn(reservationsDomain.Stay{
+			ID:       reservation.ID,
+			HotelID:  reservation.HotelID,
+			RoomID:   reservation.RoomID,
+			CheckIn:  reservation.CheckIn.UTC().Format(reservationsDomain.DateLayout),
+			CheckOut: reservation.CheckOut.UTC().Format(reservationsDomain.DateLayout),
+		})
+	}); err != nil {
+		return fmt.Errorf("error exporting reservations from repository: %w", err)
+	}
+	return nil
+}
+
+func (service Service) Create(ctx context.Context, reservation reservationsDomain.Reservation) (string, error) {
+	// Validate dates
+	checkIn, err := time.Parse(reservationsDomain.DateLayout, reservation.CheckIn)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid check_in: %v", reservationsDomain.ErrInvalid, err)
+	}
+	checkOut, err := time.Parse(reservationsDomain.DateLayout, reservation.CheckOut)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid check_out: %v", reservationsDomain.ErrInvalid, err)
+	}
+	nights := stayNights(checkIn, checkOut)
+	if len(nights) == 0 {
+		return "", fmt.Errorf("%w: check_out must be after check_in", reservationsDomain.ErrInvalid)
+	}
+	if len(nights) > maxNights {
+		return "", fmt.Errorf("%w: stays can't be longer than %d nights", reservationsDomain.ErrInvalid, maxNights)
+	}
+	if today := time.Now().UTC().Truncate(24 * time.Hour); checkIn.Before(today) {
+		return "", fmt.Errorf("%w: check_in can't be in the past", reservationsDomain.ErrInvalid)
+	}
+
+	// Validate the room against the hotel and the guests
+	room, err := service.roomsRepository.GetRoomByID(ctx, reservation.RoomID)
+	if err != nil {
+		return "", fmt.Errorf("%w: error getting room %s: %v", reservationsDomain.ErrInvalid, reservation.RoomID, err)
+	}
+	if room.HotelID != reservation.HotelID {
+		return "", fmt.Errorf("%w: room %s doesn't belong to hotel %s", reservationsDomain.ErrInvalid, reservation.RoomID, reservation.HotelID)
+	}
+	if reservation.Guests <= 0 || reservation.Guests > room.Capacity {
+		return "", fmt.Errorf("%w: room %s allows from 1 to %d guests", reservationsDomain.ErrInvalid, room.ID, room.Capacity)
+	}
+
+	// Create reservation, taking the inventory for every night of the stay
+	id, err := service.repository.Create(ctx, reservationsDAO.Reservation{
+		UserID:     reservation.UserID,
+		HotelID:    reservation.HotelID,
+		RoomID:     reservation.RoomID,
+		CheckIn:    checkIn,
+		CheckOut:   checkOut,
+		Guests:     reservation.Guests,
+		TotalPrice: room.BasePrice * float64(len(nights)),
+		Status:     reservationsDomain.StatusConfirmed,
+		CreatedAt:  time.Now().UTC(),
+	}, nights, room.Units)
+	if err != nil {
+		if errors.Is(err, reservationsDAO.ErrNoAvailability) {
+			return "", reservationsDomain.ErrNotAvailable
+		}
+		return "", fmt.Errorf("error creating reservation in repository: %w", err)
+	}
+
+	return id, nil
+}
+
+func (service Service) Cancel(ctx context.Context, userID int64, id string) error {
+	// Make sure the reservation belongs to the user
+	if _, err := service.GetReservationByID(ctx, userID, id); err != nil {
+		return err
+	}
+
+	// Only the request that flips the status releases the inventory, both in a single transaction
+	if err := service.repository.Cancel(ctx, id); err != nil {
+		if errors.Is(err, reservationsDAO.ErrNotConfirmed) {
+			return reservationsDomain.ErrNotCancellable
+		}
+		return fmt.Errorf("error cancelling reservation %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// stayNights returns the dates of every night between check in and check out
+func stayNights(checkIn time.Time, checkOut time.Time) []time.Time {
+	nights := make([]time.Time, 0)
+	for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night)
+	}
+	return nights
+}
+
+func toDomain(reservation reservationsDAO.Reservation) reservationsDomain.Reservation {
+	return reservationsDomain.Reservation{
+		ID:         reservation.ID,
+		UserID:     reservation.UserID,
+		HotelID:    reservation.HotelID,
+		RoomID:     reservation.RoomID,
+		CheckIn:    reservation.CheckIn.UTC().Format(reservationsDomain.DateLayout),
+		CheckOut:   reservation.CheckOut.UTC().Format(reservationsDomain.DateLayout),
+		Guests:     reservation.Guests,
+		Nights:     len(stayNights(reservation.CheckIn, reservation.CheckOut)),
+		TotalPrice: reservation.TotalPrice,
+		Status:     reservation.Status,
+		CreatedAt:  reservation.CreatedAt,
+	}
+}
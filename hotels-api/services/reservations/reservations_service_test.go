@@ -0,0 +1,114 @@
+package reservations_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	roomsDAO "hotels-api/dao/rooms"
+	reservationsDomain "hotels-api/domain/reservations"
+	repositories "hotels-api/repositories/reservations"
+	roomsRepositories "hotels-api/repositories/rooms"
+	services "hotels-api/services/reservations"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	roomsRepo := roomsRepositories.NewMock()
+	roomID, _ := roomsRepo.Create(ctx, roomsDAO.Room{HotelID: "hotel-1", Name: "Double", Capacity: 2, BasePrice: 100, Units: 2})
+	service := services.NewService(repositories.NewMock(), roomsRepo)
+
+	checkIn := time.Now().UTC().AddDate(0, 0, 10)
+	request := reservationsDomain.Reservation{
+		UserID:   1,
+		HotelID:  "hotel-1",
+		RoomID:   roomID,
+		CheckIn:  checkIn.Format(reservationsDomain.DateLayout),
+		CheckOut: checkIn.AddDate(0, 0, 3).Format(reservationsDomain.DateLayout),
+		Guests:   2,
+	}
+
+	t.Run("Create - Success", func(t *testing.T) {
+		id, err := service.Create(ctx, request)
+		assert.NoError(t, err)
+
+		reservation, err := service.GetReservationByID(ctx, 1, id)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, reservation.Nights)
+		assert.Equal(t, 300.0, reservation.TotalPrice)
+		assert.Equal(t, reservationsDomain.StatusConfirmed, reservation.Status)
+
+		_, err = service.GetReservationByID(ctx, 2, id)
+		assert.ErrorIs(t, err, reservationsDomain.ErrNotFound)
+
+		assert.NoError(t, service.Cancel(ctx, 1, id))
+	})
+
+	t.Run("Cancel - Already Cancelled", func(t *testing.T) {
+		id, err := service.Create(ctx, request)
+		assert.NoError(t, err)
+		assert.NoError(t, service.Cancel(ctx, 1, id))
+
+		err = service.Cancel(ctx, 1, id)
+		assert.ErrorIs(t, err, reservationsDomain.ErrNotCancellable)
+	})
+
+	t.Run("Create - Invalid", func(t *testing.T) {
+		invalid := request
+		invalid.Guests = 3
+		_, err := service.Create(ctx, invalid)
+		assert.ErrorIs(t, err, reservationsDomain.ErrInvalid)
+
+		invalid = request
+		invalid.CheckOut = invalid.CheckIn
+		_, err = service.Create(ctx, invalid)
+		assert.ErrorIs(t, err, reservationsDomain.ErrInvalid)
+	})
+
+	t.Run("Create - No Overbooking", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		created := 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := service.Create(ctx, request); err == nil {
+					mutex.Lock()
+					created++
+					mutex.Unlock()
+				} else {
+					assert.ErrorIs(t, err, reservationsDomain.ErrNotAvailable)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 2, created)
+	})
+
+	t.Run("ExportStays - Confirmed Only", func(t *testing.T) {
+		service := services.NewService(repositories.NewMock(), roomsRepo)
+		kept, err := service.Create(ctx, request)
+		assert.NoError(t, err)
+		cancelled, err := service.Create(ctx, request)
+		assert.NoError(t, err)
+		assert.NoError(t, service.Cancel(ctx, 1, cancelled))
+
+		stays := make([]reservationsDomain.Stay, 0)
+		err = service.ExportStays(ctx, func(stay reservationsDomain.Stay) error {
+			stays = append(stays, stay)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []reservationsDomain.Stay{{
+			ID:       kept,
+			HotelID:  "hotel-1",
+			RoomID:   roomID,
+			CheckIn:  request.CheckIn,
+			CheckOut: request.CheckOut,
+		}}, stays)
+	})
+}
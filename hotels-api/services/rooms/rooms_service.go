@@ -0,0 +1,172 @@
+package rooms
+
+import (
+	"context"
+	"fmt"
+	hotelsDAO "hotels-api/dao/hotels"
+	roomsDAO "hotels-api/dao/rooms"
+	roomsDomain "hotels-api/domain/rooms"
+)
+
+type Repository interface {
+	GetRoomByID(ctx context.Context, id string) (roomsDAO.Room, error)
+	ListByHotelID(ctx context.Context, hotelID string) ([]roomsDAO.Room, error)
+	Export(ctx context.Context, fn func(room roomsDAO.Room) error) error
+	Create(ctx context.Context, room roomsDAO.Room) (string, error)
+	Update(ctx context.Context, room roomsDAO.Room) error
+	Delete(ctx context.Context, id string) error
+}
+
+type HotelsRepository interface {
+	GetHotelByID(ctx context.Context, id string) (hotelsDAO.Hotel, error)
+}
+
+type Service struct {
+	mainRepository   Repository
+	cacheRepository  Repository
+	hotelsRepository HotelsRepository
+}
+
+func NewService(mainRepository Repository, cacheRepository Repository, hotelsRepository HotelsRepository) Service {
+	return Service{
+		mainRepository:   mainRepository,
+		cacheRepository:  cacheRepository,
+		hotelsRepository: hotelsRepository,
+	}
+}
+
+func (service Service) GetRoomByID(ctx context.Context, hotelID string, id string) (roomsDomain.Room, error) {
+	roomDAO, err := service.cacheRepository.GetRoomByID(ctx, id)
+	if err != nil {
+		// Get room from main repository
+		roomDAO, err = service.mainRepository.GetRoomByID(ctx, id)
+		if err != nil {
+			return roomsDomain.Room{}, fmt.Errorf("error getting room from repository: %w", err)
+		}
+		if _, err := service.cacheRepository.Create(ctx, roomDAO); err != nil {
+			return roomsDomain.Room{}, fmt.Errorf("error creating room in cache: %w", err)
+		}
+	}
+
+	// Rooms are only visible under their own hotel
+	if roomDAO.HotelID != hotelID {
+		return roomsDomain.Room{}, fmt.Errorf("room %s not found in hotel %s", id, hotelID)
+	}
+
+	return toDomain(roomDAO), nil
+}
+
+func (service Service) ListByHotelID(ctx context.Context, hotelID string) ([]roomsDomain.Room, error) {
+	roomsDAOList, err := service.mainRepository.ListByHotelID(ctx, hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing rooms from repository: %w", err)
+	}
+
+	rooms := make([]roomsDomain.Room, 0, len(roomsDAOList))
+	for _, roomDAO := range roomsDAOList {
+		rooms = append(rooms, toDomain(roomDAO))
+	}
+	return rooms, nil
+}
+
+// Export calls fn with every room of every hotel, straight from the main repository
+func (service Service) Export(ctx context.Context, fn func(room roomsDomain.Room) error) error {
+	if err := service.mainRepository.Export(ctx, func(roomDAO roomsDAO.Room) error {
+		return fn(toDomain(roomDAO))
+	}); err != nil {
+		return fmt.Errorf("error exporting rooms from repository: %w", err)
+	}
+	return nil
+}
+
+func (service Service) Create(ctx context.Context, room roomsDomain.Room) (string, error) {
+	// Make sure the hotel exists before adding rooms to it
+	if _, err := service.hotelsRepository.GetHotelByID(ctx, room.HotelID); err != nil {
+		return "", fmt.Errorf("error getting hotel %s: %w", room.HotelID, err)
+	}
+
+	record := toDAO(room)
+	record.ID = ""
+	id, err := service.mainRepository.Create(ctx, record)
+	if err != nil {
+		return "", fmt.Errorf("error creating room in main repository: %w", err)
+	}
+	// Set ID from main repository to use in the rest of the repositories
+	record.ID = id
+	if _, err := service.cacheRepository.Create(ctx, record); err != nil {
+		return "", fmt.Errorf("error creating room in cache: %w", err)
+	}
+
+	return id, nil
+}
+
+func (service Service) Update(ctx context.Context, room roomsDomain.Room) error {
+	// Make sure the room belongs to the hotel
+	if _, err := service.GetRoomByID(ctx, room.HotelID, room.ID); err != nil {
+		return err
+	}
+
+	// Update the room in the main repository
+	record := toDAO(room)
+	if err := service.mainRepository.Update(ctx, record); err != nil {
+		return fmt.Errorf("error updating room in main repository: %w", err)
+	}
+
+	// Try to update the room in the cache repository
+	if err := service.cacheRepository.Update(ctx, record); err != nil {
+		return fmt.Errorf("error updating room in cache: %w", err)
+	}
+
+	return nil
+}
+
+func (service Service) Delete(ctx context.Context, hotelID string, id string) error {
+	// Make sure the room belongs to the hotel
+	if _, err := service.GetRoomByID(ctx, hotelID, id); err != nil {
+		return err
+	}
+
+	// Delete the room from the main repository
+	if err := service.mainRepository.Delete(ctx, id); err != nil {
+		return fmt.Errorf("error deleting room from main repository: %w", err)
+	}
+
+	// Try to delete the room from the cache repository
+	if err := service.cacheRepository.Delete(ctx, id); err != nil {
+		return fmt.Errorf("error deleting room from cache: %w", err)
+	}
+
+	return nil
+}
+
+func toDomain(room roomsDAO.Room) roomsDomain.Room {
+	beds := make([]roomsDomain.Bed, 0, len(room.Beds))
+	for _, bed := range room.Beds {
+		beds = append(beds, roomsDomain.Bed{Type: bed.Type, Count: bed.Count})
+	}
+	return roomsDomain.Room{
+		ID:        room.ID,
+		HotelID:   room.HotelID,
+		Name:      room.Name,
+		Capacity:  room.Capacity,
+		Beds:      beds,
+		BasePrice: room.BasePrice,
+		Units:     room.Units,
+	}
+}
+
+func toDAO(room roomsDomain.Room) roomsDAO.Room {
+	var beds []roomsDAO.Bed
+	for _, bed := range room.Beds {
+		beds = append(beds, roomsDAO.Bed{Type: bed.Type, Count: bed.Count})
+	}
+	return roomsDAO.Room{
+		ID:        room.ID,
+		HotelID:   room.HotelID,
+		Name:      room.Name,
+		Capacity:  room.Capacity,
+		Beds:      beds,
+		BasePrice: room.BasePrice,
+		Units:     room.Units,
+	}
+}
@@ -0,0 +1,64 @@
+package rooms_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	hotelsDAO "hotels-api/dao/hotels"
+	roomsDomain "hotels-api/domain/rooms"
+	hotelsRepositories "hotels-api/repositories/hotels"
+	repositories "hotels-api/repositories/rooms"
+	services "hotels-api/services/rooms"
+	"testing"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	hotelsRepo := hotelsRepositories.NewMock()
+	hotelID, _ := hotelsRepo.Create(ctx, hotelsDAO.Hotel{Name: "Hotel A"})
+	service := services.NewService(repositories.NewMock(), repositories.NewMock(), hotelsRepo)
+
+	room := roomsDomain.Room{
+		HotelID:   hotelID,
+		Name:      "Double",
+		Capacity:  2,
+		Beds:      []roomsDomain.Bed{{Type: "queen", Count: 1}},
+		BasePrice: 100,
+		Units:     5,
+	}
+
+	t.Run("Create and Get - Success", func(t *testing.T) {
+		id, err := service.Create(ctx, room)
+		assert.NoError(t, err)
+
+		result, err := service.GetRoomByID(ctx, hotelID, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Double", result.Name)
+		assert.Equal(t, 5, result.Units)
+		assert.Equal(t, []roomsDomain.Bed{{Type: "queen", Count: 1}}, result.Beds)
+
+		rooms, err := service.ListByHotelID(ctx, hotelID)
+		assert.NoError(t, err)
+		assert.Len(t, rooms, 1)
+	})
+
+	t.Run("Get - Wrong Hotel", func(t *testing.T) {
+		id, err := service.Create(ctx, room)
+		assert.NoError(t, err)
+
+		_, err = service.GetRoomByID(ctx, "another-hotel", id)
+		assert.Error(t, err)
+	})
+
+	t.Run("Update - Success", func(t *testing.T) {
+		id, err := service.Create(ctx, room)
+		assert.NoError(t, err)
+
+		err = service.Update(ctx, roomsDomain.Room{ID: id, HotelID: hotelID, Units: 8})
+		assert.NoError(t, err)
+
+		result, err := service.GetRoomByID(ctx, hotelID, id)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, result.Units)
+		assert.Equal(t, "Double", result.Name)
+	})
+}
@@ -2,51 +2,129 @@ package queues
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/streadway/amqp"
+	"hash/fnv"
 	"log"
 	"search-api/domain/hotels"
+	"sync"
+	"time"
+)
+
+const (
+	// errorHeader carries the last handling error of a retried or dead-lettered message
+	errorHeader = "x-last-error"
+
+	// retriesHeader counts the times a message went through the retry queues
+	retriesHeader = "x-retries"
+
+	// retryQueueFormat names the retry queue of each attempt after the queue they go back to
+	retryQueueFormat = "%s.retry.%d"
 )
 
 type RabbitConfig struct {
-	Host      string
-	Port      string
-	Username  string
-	Password  string
-	QueueName string
+	Host            string
+	Port            string
+	Username        string
+	Password        string
+	QueueName       string
+	DeadLetterQueue string        // Queue receiving the messages that couldn't be handled
+	MaxRetries      int           // Handling attempts after the first failure, each through its own retry queue
+	RetryBackoff    time.Duration // Wait before the first retry, doubled on every attempt
+	MaxBackoff      time.Duration // Upper bound for the wait between retries
+	Prefetch        int           // Unacknowledged messages delivered at once
+	Workers         int           // Messages handled concurrently, each hotel's in order
+	ConfirmTimeout  time.Duration // How long a republish waits for the broker to confirm it
+	Exclusive       bool          // Refuse to start while another consumer is attached to the queue
 }
 
 type Rabbit struct {
 	connection *amqp.Connection
 	channel    *amqp.Channel
+	publisher  *amqp.Channel // Republishes the retried and dead-lettered messages, in confirm mode
 	queue      amqp.Queue
+	config     RabbitConfig
+	confirms   chan amqp.Confirmation
+	publishing *sync.Mutex
+	published  *uint64 // Delivery tag of the last message republished
 }
 
-// NewRabbit creates a new RabbitMQ connection and declares the queue
+// NewRabbit creates a new RabbitMQ connection and declares the queues
 func NewRabbit(config RabbitConfig) Rabbit {
 	connection, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%s/", config.Username, config.Password, config.Host, config.Port))
 	if err != nil {
-		log.Fatalf("error getting Rabbit connection: %w", err)
+		log.Fatalf("error getting Rabbit connection: %v", err)
 	}
 	channel, err := connection.Channel()
 	if err != nil {
-		log.Fatalf("error creating Rabbit channel: %w", err)
+		log.Fatalf("error creating Rabbit channel: %v", err)
+	}
+	// Durable, declared the same way as by hotels-api which publishes to it
+	queue, err := channel.QueueDeclare(config.QueueName, true, false, false, false, nil)
+	if err != nil {
+		log.Fatalf("error declaring Rabbit queue: %v", err)
+	}
+	if config.DeadLetterQueue != "" {
+		// Durable, dead letters are kept until someone looks at them
+		if _, err := channel.QueueDeclare(config.DeadLetterQueue, true, false, false, false, nil); err != nil {
+			log.Fatalf("error declaring Rabbit dead letter queue: %v", err)
+		}
+	}
+	// A retry queue per attempt, each holding the messages for that attempt's backoff and then
+	// dead-lettering them back to the queue. A single queue would hold the short waits behind
+	// the long ones, since messages only expire at its head
+	backoff := config.RetryBackoff
+	for attempt := 1; attempt <= config.MaxRetries; attempt++ {
+		if _, err := channel.QueueDeclare(fmt.Sprintf(retryQueueFormat, config.QueueName, attempt), true, false, false, false, amqp.Table{
+			"x-message-ttl":             backoff.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": config.QueueName,
+		}); err != nil {
+			log.Fatalf("error declaring Rabbit retry queue: %v", err)
+		}
+		backoff *= 2
+		if config.MaxBackoff > 0 {
+			backoff = min(backoff, config.MaxBackoff)
+		}
+	}
+	if config.Prefetch > 0 {
+		if err := channel.Qos(config.Prefetch, 0, false); err != nil {
+			log.Fatalf("error setting Rabbit prefetch: %v", err)
+		}
+	}
+	// A channel of its own, so the confirmations don't wait behind the deliveries
+	publisher, err := connection.Channel()
+	if err != nil {
+		log.Fatalf("error creating Rabbit publisher channel: %v", err)
+	}
+	if err := publisher.Confirm(false); err != nil {
+		log.Fatalf("error enabling Rabbit publisher confirms: %v", err)
 	}
-	queue, err := channel.QueueDeclare(config.QueueName, false, false, false, false, nil)
 	return Rabbit{
 		connection: connection,
 		channel:    channel,
+		publisher:  publisher,
 		queue:      queue,
+		config:     config,
+		confirms:   publisher.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		publishing: &sync.Mutex{},
+		published:  new(uint64),
 	}
 }
 
-// StartConsumer starts listening for messages on the RabbitMQ queue
-func (queue Rabbit) StartConsumer(handler func(hotels.HotelNew)) error {
+// StartConsumer starts listening for messages on the RabbitMQ queue, each message is
+// acknowledged once handled, moved to a retry queue while it fails and dead-lettered
+// when the retries run out. Messages are spread over the workers by hotel, so the
+// events of a hotel are handled one at a time and in order, except for the retried ones
+// which come back after the following events. That's safe since hotel events are
+// versioned and reservation events are applied once by ID
+func (queue Rabbit) StartConsumer(handler func(hotels.HotelNew) error) error {
 	messages, err := queue.channel.Consume(
 		queue.queue.Name,
 		"",
-		true, // Auto-acknowledge messages
-		false,
+		false, // Acknowledge manually once handled
+		queue.config.Exclusive,
 		false,
 		false,
 		nil,
@@ -55,23 +133,171 @@ func (queue Rabbit) StartConsumer(handler func(hotels.HotelNew)) error {
 		return fmt.Errorf("error registering consumer: %w", err)
 	}
 
+	workers := make([]chan delivery, max(queue.config.Workers, 1))
+	for i := range workers {
+		workers[i] = make(chan delivery)
+		go func(deliveries chan delivery) {
+			for delivery := range deliveries {
+				queue.handle(delivery.msg, delivery.hotelNew, handler)
+			}
+		}(workers[i])
+	}
+
 	go func() {
 		for msg := range messages {
-			var hotelUpdate hotels.HotelNew
-			if err := json.Unmarshal(msg.Body, &hotelUpdate); err != nil {
-				log.Printf("error unmarshaling message: %v", err)
+			var hotelNew hotels.HotelNew
+			if err := json.Unmarshal(msg.Body, &hotelNew); err != nil {
+				queue.deadLetter(msg, fmt.Errorf("%w: error unmarshaling message: %v", hotels.ErrInvalidEvent, err))
 				continue
 			}
-
-			handler(hotelUpdate)
+			partition := fnv.New32a()
+			partition.Write([]byte(hotelNew.HotelID))
+			workers[partition.Sum32()%uint32(len(workers))] <- delivery{msg: msg, hotelNew: hotelNew}
+		}
+		for _, deliveries := range workers {
+			close(deliveries)
 		}
+		log.Printf("consumer for queue %s stopped", queue.queue.Name)
 	}()
 
 	return nil
 }
 
+// delivery is a decoded message waiting for its worker
+type delivery struct {
+	msg      amqp.Delivery
+	hotelNew hotels.HotelNew
+}
+
+// handle runs the handler over a single message and settles it. A failed message is moved
+// out of the worker to wait for its retry, so it doesn't hold the other hotels' events
+func (queue Rabbit) handle(msg amqp.Delivery, hotelNew hotels.HotelNew, handler func(hotels.HotelNew) error) {
+	err := handler(hotelNew)
+	if err == nil {
+		if err := msg.Ack(false); err != nil {
+			log.Printf("error acknowledging message: %v", err)
+		}
+		return
+	}
+
+	// Invalid events fail the same way every time, so they aren't retried
+	retries := retryCount(msg)
+	if errors.Is(err, hotels.ErrInvalidEvent) || retries >= queue.config.MaxRetries {
+		queue.deadLetter(msg, err)
+		return
+	}
+
+	log.Printf("error handling %s event for hotel (%s), retry %d of %d: %v", hotelNew.Operation, hotelNew.HotelID, retries+1, queue.config.MaxRetries, err)
+	headers := copyHeaders(msg)
+	headers[retriesHeader] = int32(retries + 1)
+	headers[errorHeader] = err.Error()
+	queue.republish(msg, fmt.Sprintf(retryQueueFormat, queue.config.QueueName, retries+1), headers)
+}
+
+// deadLetter moves a message that couldn't be handled to the dead letter queue, when there's
+// none or it can't be published the message is requeued rather than lost
+func (queue Rabbit) deadLetter(msg amqp.Delivery, cause error) {
+	log.Printf("error handling message, dead-lettering it: %v", cause)
+	if queue.config.DeadLetterQueue == "" {
+		if err := msg.Nack(false, true); err != nil {
+			log.Printf("error requeuing message: %v", err)
+		}
+		return
+	}
+
+	headers := copyHeaders(msg)
+	headers[errorHeader] = cause.Error()
+	queue.republish(msg, queue.config.DeadLetterQueue, headers)
+}
+
+// republish moves a message to another queue, acknowledging it only once the broker confirms
+// it there so that it's requeued rather than lost when it can't be
+func (queue Rabbit) republish(msg amqp.Delivery, queueName string, headers amqp.Table) {
+	if err := queue.publish(msg, queueName, headers); err != nil {
+		log.Printf("error publishing to queue %s, requeuing message: %v", queueName, err)
+		if err := msg.Nack(false, true); err != nil {
+			log.Printf("error requeuing message: %v", err)
+		}
+		return
+	}
+	if err := msg.Ack(false); err != nil {
+		log.Printf("error acknowledging message: %v", err)
+	}
+}
+
+// publish sends a copy of the message to the queue and waits for the broker to confirm it
+func (queue Rabbit) publish(msg amqp.Delivery, queueName string, headers amqp.Table) error {
+	// Confirmations arrive in publishing order, one message is in flight at a time
+	queue.publishing.Lock()
+	defer queue.publishing.Unlock()
+	if err := queue.publisher.Publish(
+		"",
+		queueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Timestamp:    time.Now().UTC(),
+			Body:         msg.Body,
+		}); err != nil {
+		return fmt.Errorf("error publishing to Rabbit: %w", err)
+	}
+	*queue.published++
+	return queue.waitConfirm(*queue.published)
+}
+
+// waitConfirm waits for the broker to confirm the message with the given delivery tag,
+// skipping the late confirmations of the messages that timed out before it
+func (queue Rabbit) waitConfirm(tag uint64) error {
+	timeout := time.NewTimer(queue.config.ConfirmTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case confirmation, ok := <-queue.confirms:
+			if !ok {
+				return fmt.Errorf("error publishing to Rabbit: channel closed before the confirmation")
+			}
+			if confirmation.DeliveryTag < tag {
+				continue
+			}
+			if !confirmation.Ack {
+				return fmt.Errorf("error publishing to Rabbit: message rejected by the broker")
+			}
+			return nil
+		case <-timeout.C:
+			return fmt.Errorf("error publishing to Rabbit: no confirmation after %s", queue.config.ConfirmTimeout)
+		}
+	}
+}
+
+// copyHeaders returns a copy of the message headers to publish it again with
+func copyHeaders(msg amqp.Delivery) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	return headers
+}
+
+// retryCount returns how many times the message went through the retry queues
+func retryCount(msg amqp.Delivery) int {
+	switch retries := msg.Headers[retriesHeader].(type) {
+	case int32:
+		return int(retries)
+	case int64:
+		return int(retries)
+	default:
+		return 0
+	}
+}
+
 // Close cleans up the RabbitMQ resources
 func (queue Rabbit) Close() {
+	if err := queue.publisher.Close(); err != nil {
+		log.Printf("error closing Rabbit publisher channel: %v", err)
+	}
 	if err := queue.channel.Close(); err != nil {
 		log.Printf("error closing Rabbit channel: %v", err)
 	}
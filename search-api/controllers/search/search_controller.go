@@ -2,15 +2,43 @@ package users
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
 	hotelsDomain "search-api/domain/hotels"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+
+	// maxResultWindow is the deepest result paged to, Elasticsearch rejects deeper pages and
+	// Solr slows down with them
+	maxResultWindow = 10000
+
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 10
+
+	// maxNights is the longest stay searched, the same the hotels API takes reservations for
+	maxNights = 30
+)
+
+// searchParams are the URL parameters echoed back in the search response
+var searchParams = []string{
+	"q", "mode", "profile", "city", "state", "amenities", "amenities_match", "min_rating", "max_rating",
+	"lat", "lng", "radius_km", "sort", "check_in", "check_out", "guests", "offset", "limit",
+}
+
 type Service interface {
-	Search(ctx context.Context, query string, offset int, limit int) ([]hotelsDomain.Hotel, error)
+	Search(ctx context.Context, request hotelsDomain.SearchRequest) (hotelsDomain.SearchResponse, error)
+	Suggest(ctx context.Context, prefix string, limit int) ([]hotelsDomain.Suggestion, error)
+	Reindex(ctx context.Context) (hotelsDomain.ReindexResponse, error)
+	Reconcile(ctx context.Context, dryRun bool) (hotelsDomain.ReconcileResponse, error)
 }
 
 type Controller struct {
@@ -27,26 +55,202 @@ func (controller Controller) Search(c *gin.Context) {
 	// Parse query from URL
 	query := c.Query("q")
 
-	// Parse offset from URL
-	offset, err := strconv.Atoi(c.Query("offset"))
-	if err != nil {
+	// Parse offset from URL, defaults to the first page
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("invalid request: %s", err),
+			"error": fmt.Sprintf("invalid offset: %s", c.Query("offset")),
 		})
 		return
 	}
 
-	// Parse limit from URL
-	limit, err := strconv.Atoi(c.Query("limit"))
-	if err != nil {
+	// Parse limit from URL, capped to the maximum page size
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid limit: %s", c.Query("limit")),
+		})
+		return
+	}
+	limit = min(limit, maxLimit)
+	if offset > maxResultWindow-limit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid offset: %d, offset plus limit can't exceed %d", offset, maxResultWindow),
+		})
+		return
+	}
+
+	request := hotelsDomain.SearchRequest{
+		Query:          query,
+		Mode:           c.DefaultQuery("mode", hotelsDomain.ModeSimple),
+		Profile:        c.DefaultQuery("profile", hotelsDomain.ProfileDefault),
+		City:           strings.TrimSpace(c.Query("city")),
+		State:          strings.TrimSpace(c.Query("state")),
+		AmenitiesMatch: c.DefaultQuery("amenities_match", hotelsDomain.MatchAll),
+		Sort:           c.DefaultQuery("sort", hotelsDomain.SortRelevance),
+		Offset:         offset,
+		Limit:          limit,
+	}
+
+	// Validate query mode, advanced queries can't nest other parsers
+	switch request.Mode {
+	case hotelsDomain.ModeSimple:
+	case hotelsDomain.ModeAdvanced:
+		if strings.Contains(query, "{!") || strings.Contains(query, "_query_") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid q: local params and nested queries are not allowed",
+			})
+			return
+		}
+	default:
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("invalid request: %s", err),
+			"error": fmt.Sprintf("invalid mode: %s", request.Mode),
 		})
 		return
 	}
 
+	// Parse amenities from URL as a comma separated list
+	if amenities := c.Query("amenities"); amenities != "" {
+		for _, amenity := range strings.Split(amenities, ",") {
+			if amenity = strings.TrimSpace(amenity); amenity != "" {
+				request.Amenities = append(request.Amenities, amenity)
+			}
+		}
+	}
+	if request.AmenitiesMatch != hotelsDomain.MatchAll && request.AmenitiesMatch != hotelsDomain.MatchAny {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid amenities_match: %s", request.AmenitiesMatch),
+		})
+		return
+	}
+
+	// Parse rating range from URL
+	if minRating := c.Query("min_rating"); minRating != "" {
+		if request.MinRating, err = strconv.ParseFloat(minRating, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid min_rating: %s", err),
+			})
+			return
+		}
+	}
+	if maxRating := c.Query("max_rating"); maxRating != "" {
+		if request.MaxRating, err = strconv.ParseFloat(maxRating, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid max_rating: %s", err),
+			})
+			return
+		}
+	}
+	if request.MaxRating > 0 && request.MinRating > request.MaxRating {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: min_rating can't be greater than max_rating",
+		})
+		return
+	}
+
+	// Parse the point to search around from URL, both coordinates are required
+	lat, lng := c.Query("lat"), c.Query("lng")
+	if lat != "" || lng != "" {
+		if request.Latitude, err = strconv.ParseFloat(lat, 64); err != nil || request.Latitude < -90 || request.Latitude > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid lat: %s", lat),
+			})
+			return
+		}
+		if request.Longitude, err = strconv.ParseFloat(lng, 64); err != nil || request.Longitude < -180 || request.Longitude > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid lng: %s", lng),
+			})
+			return
+		}
+		request.Geo = true
+	}
+	if radius := c.Query("radius_km"); radius != "" {
+		if !request.Geo {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid request: radius_km requires lat and lng",
+			})
+			return
+		}
+		if request.RadiusKm, err = strconv.ParseFloat(radius, 64); err != nil || request.RadiusKm <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid radius_km: %s", radius),
+			})
+			return
+		}
+	}
+
+	// Validate sort
+	switch request.Sort {
+	case hotelsDomain.SortRelevance, hotelsDomain.SortRating, hotelsDomain.SortName:
+	case hotelsDomain.SortDistance:
+		if !request.Geo {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid request: sort by distance requires lat and lng",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid sort: %s", request.Sort),
+		})
+		return
+	}
+
+	// Parse stay from URL, only hotels with capacity for it are returned
+	checkIn, checkOut := c.Query("check_in"), c.Query("check_out")
+	if checkIn != "" || checkOut != "" {
+		if request.CheckIn, err = time.Parse(hotelsDomain.DateLayout, checkIn); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid check_in: %s", err),
+			})
+			return
+		}
+		if request.CheckOut, err = time.Parse(hotelsDomain.DateLayout, checkOut); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid check_out: %s", err),
+			})
+			return
+		}
+		if !request.CheckOut.After(request.CheckIn) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid request: check_out must be after check_in",
+			})
+			return
+		}
+		if request.CheckOut.After(request.CheckIn.AddDate(0, 0, maxNights)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid request: stays can't be longer than %d nights", maxNights),
+			})
+			return
+		}
+		if today := time.Now().UTC().Truncate(24 * time.Hour); request.CheckIn.Before(today) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid request: check_in can't be in the past",
+			})
+			return
+		}
+
+		// Parse guests from URL, defaults to one
+		request.Guests = 1
+		if guests := c.Query("guests"); guests != "" {
+			if request.Guests, err = strconv.Atoi(guests); err != nil || request.Guests <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("invalid guests: %s", guests),
+				})
+				return
+			}
+		}
+	}
+
 	// Invoke service
-	hotels, err := controller.service.Search(c.Request.Context(), query, offset, limit)
+	response, err := controller.service.Search(c.Request.Context(), request)
+	if errors.Is(err, hotelsDomain.ErrUnknownProfile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid profile: %s", request.Profile),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("error searching hotels: %s", err.Error()),
@@ -54,6 +258,112 @@ func (controller Controller) Search(c *gin.Context) {
 		return
 	}
 
+	// Echo the effective query, with defaults applied
+	params := c.Request.URL.Query()
+	params.Set("offset", strconv.Itoa(request.Offset))
+	params.Set("limit", strconv.Itoa(request.Limit))
+	params.Set("sort", request.Sort)
+	params.Set("mode", request.Mode)
+	params.Set("profile", request.Profile)
+	params.Set("amenities_match", request.AmenitiesMatch)
+	echo := url.Values{}
+	response.Query = make(map[string]string)
+	for _, param := range searchParams {
+		if value := params.Get(param); value != "" {
+			echo.Set(param, value)
+			response.Query[param] = value
+		}
+	}
+
+	// Link the next page while there are results left
+	if next := request.Offset + request.Limit; next < response.Total {
+		echo.Set("offset", strconv.Itoa(next))
+		response.Next = fmt.Sprintf("%s?%s", c.Request.URL.Path, echo.Encode())
+	}
+
+	// Send response
+	c.JSON(http.StatusOK, response)
+}
+
+func (controller Controller) Suggest(c *gin.Context) {
+	// Parse prefix from URL, nothing to suggest without it
+	prefix := strings.TrimSpace(c.Query("q"))
+	if prefix == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"query":       prefix,
+			"suggestions": make([]hotelsDomain.Suggestion, 0),
+		})
+		return
+	}
+
+	// Parse limit from URL, capped to the maximum suggestions
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSuggestLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid limit: %s", c.Query("limit")),
+		})
+		return
+	}
+	limit = min(limit, maxSuggestLimit)
+
+	// Invoke service
+	suggestions, err := controller.service.Suggest(c.Request.Context(), prefix, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("error getting suggestions: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response, clients may reuse it while the user keeps typing
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, gin.H{
+		"query":       prefix,
+		"suggestions": suggestions,
+	})
+}
+
+func (controller Controller) Reindex(c *gin.Context) {
+	// Invoke service
+	response, err := controller.service.Reindex(c.Request.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, hotelsDomain.ErrRebuildInProgress) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": fmt.Sprintf("error reindexing hotels: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send response
+	c.JSON(http.StatusOK, response)
+}
+
+func (controller Controller) Reconcile(c *gin.Context) {
+	// Parse dry run from URL, only counting the differences
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid dry_run: %s", c.Query("dry_run")),
+		})
+		return
+	}
+
+	// Invoke service
+	response, err := controller.service.Reconcile(c.Request.Context(), dryRun)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, hotelsDomain.ErrRebuildInProgress) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error": fmt.Sprintf("error reconciling hotels: %s", err.Error()),
+		})
+		return
+	}
+
 	// Send response
-	c.JSON(http.StatusOK, hotels)
+	c.JSON(http.StatusOK, response)
 }
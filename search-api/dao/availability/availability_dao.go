@@ -0,0 +1,17 @@
+package availability
+
+import "time"
+
+type Room struct {
+	ID       string
+	HotelID  string
+	Capacity int
+	Units    int
+}
+
+// Reservation is the nights a reservation holds a unit of a room
+type Reservation struct {
+	ID     string
+	RoomID string
+	Nights []time.Time
+}
@@ -1,5 +1,26 @@
 package hotels
 
+import "errors"
+
+// ErrUnknownProfile is returned when searching with a ranking profile that isn't configured
+var ErrUnknownProfile = errors.New("unknown ranking profile")
+
+const (
+	SortRelevance = "relevance"
+	SortRating    = "rating"
+	SortName      = "name"
+	SortDistance  = "distance"
+
+	MatchAll = "all"
+	MatchAny = "any"
+
+	ModeSimple   = "simple"
+	ModeAdvanced = "advanced"
+
+	SuggestionName = "name"
+	SuggestionCity = "city"
+)
+
 type Hotel struct {
 	ID        string   `json:"id"`
 	Name      string   `json:"name"`
@@ -8,4 +29,63 @@ type Hotel struct {
 	State     string   `json:"state"`
 	Rating    float64  `json:"rating"`
 	Amenities []string `json:"amenities"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Distance  *float64 `json:"distance,omitempty"`
+	Version   int64    `json:"version"`
+
+	// Highlights are the snippets of the fields matching the query, by field
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+type Query struct {
+	Text           string
+	Mode           string
+	Profile        string
+	City           string
+	State          string
+	Amenities      []string
+	AmenitiesMatch string
+	MinRating      float64
+	MaxRating      float64
+	HotelIDs       []string
+	Latitude       float64
+	Longitude      float64
+	RadiusKm       float64
+	Geo            bool
+	Sort           string
+	Offset         int
+	Limit          int
+}
+
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+type Facets struct {
+	City      []FacetCount
+	State     []FacetCount
+	Amenities []FacetCount
+	Rating    []FacetCount
+}
+
+type SearchResult struct {
+	Hotels    []Hotel
+	Total     int
+	Facets    Facets
+	Collation string // Query with the misspelled words corrected, if any
+}
+
+type Suggestion struct {
+	Text   string
+	Type   string
+	Weight int
+}
+
+// IndexedVersion is the version of a hotel document, tombstones included
+type IndexedVersion struct {
+	ID      string
+	Version int64
+	Deleted bool
 }
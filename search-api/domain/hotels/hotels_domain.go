@@ -1,16 +1,153 @@
 package hotels
 
+import (
+	"errors"
+	"time"
+)
+
+const (
+	DateLayout = "2006-01-02"
+
+	// EventSchemaVersion is the newest HotelNew envelope understood, events without one are
+	// the legacy operation and ID pair
+	EventSchemaVersion = 1
+
+	SortRelevance = "relevance"
+	SortRating    = "rating"
+	SortName      = "name"
+	SortDistance  = "distance"
+
+	MatchAll = "all"
+	MatchAny = "any"
+
+	// ModeSimple matches the words of the query over the hotel fields, ModeAdvanced takes
+	// the Lucene query syntax
+	ModeSimple   = "simple"
+	ModeAdvanced = "advanced"
+
+	// ProfileDefault is the ranking profile used unless another one is requested
+	ProfileDefault = "default"
+)
+
+var (
+	// ErrInvalidEvent marks the events that can never be handled, so they aren't retried
+	ErrInvalidEvent = errors.New("invalid event")
+
+	// ErrUnknownProfile is returned when searching with a ranking profile that isn't configured
+	ErrUnknownProfile = errors.New("unknown ranking profile")
+
+	// ErrRebuildInProgress is returned while a reindex or reconcile is already running
+	ErrRebuildInProgress = errors.New("a reindex or reconcile is already in progress")
+)
+
 type Hotel struct {
-	ID        string   `json:"id"`
-	Name      string   `json:"name"`
-	Address   string   `json:"address"`
-	City      string   `json:"city"`
-	State     string   `json:"state"`
-	Rating    float64  `json:"rating"`
-	Amenities []string `json:"amenities"`
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	City       string   `json:"city"`
+	State      string   `json:"state"`
+	Rating     float64  `json:"rating"`
+	Amenities  []string `json:"amenities"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	Version    int64    `json:"version,omitempty"` // Only set by the hotels API export
+
+	// Highlights are the snippets of the fields matching the query, by field
+	Highlights map[string][]string `json:"highlights,omitempty"`
 }
 
 type HotelNew struct {
-	Operation string `json:"operation"`
-	HotelID   string `json:"hotel_id"`
+	SchemaVersion int       `json:"schema_version"`
+	EventID       string    `json:"event_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Operation     string    `json:"operation"`
+	HotelID       string    `json:"hotel_id"`
+	Version       int64     `json:"version,omitempty"` // Hotel version after the change
+	Hotel         *Hotel    `json:"hotel,omitempty"`   // Hotel snapshot after the change, none on delete
+	RoomID        string    `json:"room_id,omitempty"`
+	ReservationID string    `json:"reservation_id,omitempty"`
+	CheckIn       string    `json:"check_in,omitempty"`
+	CheckOut      string    `json:"check_out,omitempty"`
+}
+
+type Room struct {
+	ID       string `json:"id"`
+	HotelID  string `json:"hotel_id"`
+	Capacity int    `json:"capacity"`
+	Units    int    `json:"units"`
+}
+
+// Stay is the nights a confirmed reservation holds a room, as exported by the hotels API
+type Stay struct {
+	ID       string `json:"id"`
+	HotelID  string `json:"hotel_id"`
+	RoomID   string `json:"room_id"`
+	CheckIn  string `json:"check_in"`
+	CheckOut string `json:"check_out"`
+}
+
+type SearchRequest struct {
+	Query          string
+	Mode           string
+	Profile        string
+	City           string
+	State          string
+	Amenities      []string
+	AmenitiesMatch string
+	MinRating      float64
+	MaxRating      float64
+	Latitude       float64
+	Longitude      float64
+	RadiusKm       float64
+	Geo            bool
+	Sort           string
+	Offset         int
+	Limit          int
+	CheckIn        time.Time
+	CheckOut       time.Time
+	Guests         int
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	City      []FacetCount `json:"city"`
+	State     []FacetCount `json:"state"`
+	Amenities []FacetCount `json:"amenities"`
+	Rating    []FacetCount `json:"rating"`
+}
+
+type SearchResponse struct {
+	Results []Hotel           `json:"results"`
+	Total   int               `json:"total"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+	Next    string            `json:"next,omitempty"`
+	Query   map[string]string `json:"query"`
+	Facets  Facets            `json:"facets"`
+
+	// DidYouMean is the corrected query, suggested when the query has few results
+	DidYouMean string `json:"did_you_mean,omitempty"`
+}
+
+type Suggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type ReconcileResponse struct {
+	DryRun   bool `json:"dry_run"`
+	Checked  int  `json:"checked"`  // Hotels in the hotels API
+	Missing  int  `json:"missing"`  // Hotels not indexed, or indexed as deleted
+	Stale    int  `json:"stale"`    // Hotels indexed with an older version
+	Orphaned int  `json:"orphaned"` // Indexed hotels no longer in the hotels API
+}
+
+type ReindexResponse struct {
+	Indexed   int               `json:"indexed"`
+	Reconcile ReconcileResponse `json:"reconcile"` // Changes made while the collection was rebuilt
 }
@@ -0,0 +1,155 @@
+package tokenizers
+
+import (
+	"crypto"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// jwksTimeout bounds each request for the keys
+	jwksTimeout = 5 * time.Second
+)
+
+type JWTConfig struct {
+	JWKSURL            string        // users-api endpoint publishing the public keys of the tokens
+	RefreshInterval    time.Duration // The cached keys are fetched again after this long
+	MinRefreshInterval time.Duration // Unknown key IDs fetch the keys again at most this often
+	Issuer             string        // Only tokens with this iss claim are accepted
+	Audience           string        // Only tokens whose aud claim includes this audience are accepted
+	Leeway             time.Duration // Clock skew tolerated when checking exp, nbf and iat
+}
+
+// Claims identify the user a token was issued to
+type Claims struct {
+	UserID   int64
+	Username string
+	Roles    []string // Roles granted to the user, empty unless the token carries a roles claim
+}
+
+// jwtClaims are the registered claims along with the user ones
+type jwtClaims struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWT verifies the tokens issued by users-api with the public keys it publishes, so no secret
+// is shared and tokens are verified without calling users-api on each request
+type JWT struct {
+	config JWTConfig
+	client *http.Client
+	keys   *keySet
+}
+
+func NewTokenizer(config JWTConfig) JWT {
+	return JWT{
+		config: config,
+		client: &http.Client{Timeout: jwksTimeout},
+		keys:   &keySet{keys: make(map[string]crypto.PublicKey)},
+	}
+}
+
+// ValidateToken verifies a token issued by users-api and returns its claims
+func (tokenizer JWT) ValidateToken(value string) (Claims, error) {
+	claims := jwtClaims{}
+	_, err := jwt.ParseWithClaims(value, &claims, tokenizer.verificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(tokenizer.config.Issuer),
+		jwt.WithAudience(tokenizer.config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenizer.config.Leeway),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error parsing JWT token: %w", err)
+	}
+	return parseClaims(claims)
+}
+
+// verificationKey picks the public key named by the kid header of the token, the keys are fetched
+// again when they are stale or the key is unknown, which is the case right after a rotation
+func (tokenizer JWT) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+
+	set := tokenizer.keys
+	set.mutex.Lock()
+	key, ok := set.keys[keyID]
+	var fetching chan struct{}
+	if !ok || time.Since(set.fetched) >= tokenizer.config.RefreshInterval {
+		fetching = tokenizer.refreshKeys()
+	}
+	set.mutex.Unlock()
+
+	// Known keys are served from the cache while the stale keys are fetched, unknown ones wait
+	// for the fetch to find out whether they were just published
+	if ok {
+		return key, nil
+	}
+	if fetching != nil {
+		<-fetching
+		set.mutex.Lock()
+		key, ok = set.keys[keyID]
+		set.mutex.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", keyID)
+	}
+	return key, nil
+}
+
+// refreshKeys fetches the keys in the background unless they were fetched less than the minimum
+// refresh interval ago, and returns the channel closed once the fetch in flight is done, or nil
+// when there's none. The key set must be locked, it isn't while fetching
+func (tokenizer JWT) refreshKeys() chan struct{} {
+	set := tokenizer.keys
+	if set.fetching != nil {
+		return set.fetching
+	}
+	if time.Since(set.attempted) < tokenizer.config.MinRefreshInterval {
+		return nil
+	}
+	set.attempted = time.Now()
+	fetching := make(chan struct{})
+	set.fetching = fetching
+
+	go func() {
+		keys, err := tokenizer.fetchKeys()
+
+		set.mutex.Lock()
+		defer set.mutex.Unlock()
+		if err != nil {
+			// The cached keys are still used until the keys can be fetched again
+			log.Printf("error refreshing JWT verification keys: %v", err)
+		} else {
+			set.keys = keys
+			set.fetched = time.Now()
+		}
+		set.fetching = nil
+		close(fetching)
+	}()
+	return fetching
+}
+
+// parseClaims extracts the user from the token claims
+func parseClaims(claims jwtClaims) (Claims, error) {
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid sub claim: %w", err)
+	}
+
+	roles := claims.Roles
+	if roles == nil {
+		roles = make([]string, 0)
+	}
+
+	return Claims{
+		UserID:   userID,
+		Username: claims.Username,
+		Roles:    roles,
+	}, nil
+}
@@ -1,51 +1,175 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"log"
+	"os"
 	"search-api/clients/queues"
 	controllers "search-api/controllers/search"
+	hotelsDomain "search-api/domain/hotels"
+	"search-api/internal/tokenizers"
+	"search-api/middlewares/auth"
+	availabilityRepositories "search-api/repositories/availability"
 	repositories "search-api/repositories/hotels"
 	services "search-api/services/search"
+	"time"
 )
 
 func main() {
-	// Solr
-	solrRepo := repositories.NewSolr(repositories.SolrConfig{
-		Host:       "solr",   // Solr host
-		Port:       "8983",   // Solr port
-		Collection: "hotels", // Collection name
-	})
+	// Ranking profiles for simple queries
+	profiles := map[string]repositories.RankingProfile{
+		// Balanced, names weigh the most and better rated hotels rank a bit higher
+		"default": {
+			Fields: []repositories.FieldBoost{
+				{Field: "name", Boost: 3},
+				{Field: "city", Boost: 2},
+				{Field: "state", Boost: 1},
+				{Field: "address", Boost: 1},
+				{Field: "amenities", Boost: 1.5},
+			},
+			PhraseFields: []repositories.FieldBoost{{Field: "name", Boost: 5}},
+			MinimumMatch: "3<75%",
+			Boost:        "sum(1,div(rating,5))",
+		},
+		// Best rated first among the matching hotels
+		"rating": {
+			Fields: []repositories.FieldBoost{
+				{Field: "name", Boost: 2},
+				{Field: "city", Boost: 2},
+				{Field: "state", Boost: 1},
+				{Field: "address", Boost: 1},
+				{Field: "amenities", Boost: 1},
+			},
+			MinimumMatch: "3<75%",
+			Boost:        "pow(sum(1,rating),2)",
+		},
+		// Looking up a hotel by name
+		"name": {
+			Fields: []repositories.FieldBoost{
+				{Field: "name", Boost: 10},
+				{Field: "city", Boost: 0.5},
+				{Field: "address", Boost: 0.5},
+			},
+			PhraseFields: []repositories.FieldBoost{{Field: "name", Boost: 20}},
+			MinimumMatch: "100%",
+		},
+	}
+
+	// Search engine, Solr unless SEARCH_ENGINE asks for Elasticsearch or the embedded one
+	var searchEngine services.Repository
+	switch engine := os.Getenv("SEARCH_ENGINE"); engine {
+	case "", "solr":
+		solrRepo := repositories.NewSolr(repositories.SolrConfig{
+			Host:       "solr",   // Solr host
+			Port:       "8983",   // Solr port
+			Collection: "hotels", // Collection name
+			ConfigSet:  "hotels", // Configset for rebuilt collections
+			Profiles:   profiles,
+		})
+
+		// Batching indexer, documents become searchable within a second
+		searchEngine = repositories.NewSolrIndexer(solrRepo, repositories.IndexerConfig{
+			BatchSize:     100,
+			FlushInterval: 200 * time.Millisecond,
+			CommitWithin:  time.Second,
+		})
+	case "elasticsearch":
+		// Elasticsearch or OpenSearch, refreshed on every write
+		searchEngine = repositories.NewElasticsearch(repositories.ElasticsearchConfig{
+			Host:     "elasticsearch", // Elasticsearch host
+			Port:     "9200",          // Elasticsearch port
+			Index:    "hotels",        // Alias of the live index
+			Profiles: profiles,
+		})
+	case "memory":
+		searchEngine = repositories.NewMemory(repositories.MemoryConfig{
+			Collection: "hotels",
+			Profiles:   profiles,
+		})
+	default:
+		log.Fatalf("Unknown search engine: %s", engine)
+	}
 
 	// Rabbit
 	eventsQueue := queues.NewRabbit(queues.RabbitConfig{
-		Host:      "rabbitmq",
-		Port:      "5672",
-		Username:  "root",
-		Password:  "root",
-		QueueName: "hotels-news",
+		Host:            "rabbitmq",
+		Port:            "5672",
+		Username:        "root",
+		Password:        "root",
+		QueueName:       "hotels-news",
+		DeadLetterQueue: "hotels-news.dlq",
+		MaxRetries:      5,
+		RetryBackoff:    500 * time.Millisecond,
+		MaxBackoff:      30 * time.Second,
+		Prefetch:        100,
+		Workers:         50,
+		ConfirmTimeout:  5 * time.Second,
+		Exclusive:       true, // The availability projection needs every event, see below
 	})
 
 	// Hotels API
 	hotelsAPI := repositories.NewHTTP(repositories.HTTPConfig{
-		Host: "hotels-api",
-		Port: "8081",
+		Host:  "hotels-api",
+		Port:  "8081",
+		Token: os.Getenv("SERVICE_TOKEN"),
+	})
+
+	// Availability projection
+	availability := availabilityRepositories.NewMemory()
+
+	// Tokenizer, verifies the tokens with the public keys published by users-api
+	jwtTokenizer := tokenizers.NewTokenizer(tokenizers.JWTConfig{
+		JWKSURL:            "http://users-api:8080/.well-known/jwks.json",
+		RefreshInterval:    5 * time.Minute,
+		MinRefreshInterval: 10 * time.Second,
+		Issuer:             "users-api",
+		Audience:           "hotels",
+		Leeway:             30 * time.Second,
 	})
 
 	// Services
-	service := services.NewService(solrRepo, hotelsAPI)
+	service := services.NewService(searchEngine, hotelsAPI, availability)
 
 	// Controllers
 	controller := controllers.NewController(service)
 
-	// Launch rabbit consumer
-	if err := eventsQueue.StartConsumer(service.HandleHotelNew); err != nil {
+	// Middlewares
+	authMiddleware := auth.NewMiddleware(jwtTokenizer)
+	requireAdmin := authMiddleware.RequireRole(auth.RoleAdmin)
+
+	// The availability projection lives in memory, so search-api runs as a single instance. The
+	// exclusive consumer is taken before the export, which is the checkpoint: every event acked by
+	// a previous instance is in the export, and the rest are delivered here. They wait until the
+	// export is loaded, retrying until the hotels API is up, and are applied once on top of it
+	loaded := make(chan struct{})
+	if err := eventsQueue.StartConsumer(func(hotelNew hotelsDomain.HotelNew) error {
+		<-loaded
+		return service.HandleHotelNew(hotelNew)
+	}); err != nil {
 		log.Fatalf("Error running consumer: %v", err)
 	}
+	go func() {
+		for {
+			err := service.LoadAvailability(context.Background())
+			if err == nil {
+				break
+			}
+			log.Printf("Error loading availability, retrying: %v", err)
+			time.Sleep(5 * time.Second)
+		}
+		close(loaded)
+	}()
+
+	// Launch the suggestions rebuilds
+	go service.RunSuggestionBuilds(context.Background(), 5*time.Minute)
 
 	// Create router
 	router := gin.Default()
 	router.GET("/search", controller.Search)
+	router.GET("/search/suggest", controller.Suggest)
+	router.POST("/admin/reindex", authMiddleware.Authenticate, requireAdmin, controller.Reindex)
+	router.POST("/admin/reconcile", authMiddleware.Authenticate, requireAdmin, controller.Reconcile)
 	if err := router.Run(":8082"); err != nil {
 		log.Fatalf("Error running application: %v", err)
 	}
@@ -0,0 +1,63 @@
+package auth_test
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"search-api/internal/tokenizers"
+	"search-api/middlewares/auth"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenizer := tokenizers.NewMock()
+	tokenizer.On("ValidateToken", "admin").Return(tokenizers.Claims{UserID: 1, Username: "admin1", Roles: []string{auth.RoleAdmin}}, nil)
+	tokenizer.On("ValidateToken", "user").Return(tokenizers.Claims{UserID: 2, Username: "user1", Roles: []string{}}, nil)
+	tokenizer.On("ValidateToken", "expired").Return(tokenizers.Claims{}, errors.New("token has invalid claims: token is expired"))
+
+	middleware := auth.NewMiddleware(tokenizer)
+	router := gin.New()
+	router.POST("/admin", middleware.Authenticate, middleware.RequireRole(auth.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.POST("/me", middleware.Authenticate, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": auth.UserID(c.Request.Context())})
+	})
+	router.POST("/unauthenticated", middleware.RequireRole(auth.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	serve := func(path string, token string) int {
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	t.Run("Authenticate - Valid Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/me", "user"))
+	})
+
+	t.Run("Authenticate - Invalid Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/me", "expired"))
+	})
+
+	t.Run("Authenticate - Missing Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/me", ""))
+	})
+
+	t.Run("RequireRole - Granted", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve("/admin", "admin"))
+	})
+
+	t.Run("RequireRole - Missing Role", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve("/admin", "user"))
+	})
+
+	t.Run("RequireRole - Not Authenticated", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("/unauthenticated", "admin"))
+	})
+}
@@ -0,0 +1,151 @@
+package availability
+
+import (
+	"context"
+	availabilityDAO "search-api/dao/availability"
+	"sync"
+	"time"
+)
+
+// record is a reservation applied to the projection. Cancelled ones are kept until their
+// stay is over, so that a redelivered or late create can't take the nights again
+type record struct {
+	availabilityDAO.Reservation
+	cancelled bool
+}
+
+// Memory keeps the per-night availability projection of every room in memory, loaded from
+// the hotels API on startup and fed by the room and reservation events published by it. Each
+// instance needs every event, so search-api runs as a single consumer of the queue
+type Memory struct {
+	mutex        *sync.RWMutex
+	rooms        map[string]availabilityDAO.Room
+	reserved     map[string]map[string]int
+	reservations map[string]*record
+	sweptOn      *string
+}
+
+func NewMemory() Memory {
+	return Memory{
+		mutex:        &sync.RWMutex{},
+		rooms:        make(map[string]availabilityDAO.Room),
+		reserved:     make(map[string]map[string]int),
+		reservations: make(map[string]*record),
+		sweptOn:      new(string),
+	}
+}
+
+func (repository Memory) UpsertRoom(ctx context.Context, room availabilityDAO.Room) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.rooms[room.ID] = room
+	return nil
+}
+
+func (repository Memory) DeleteRoom(ctx context.Context, roomID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	delete(repository.rooms, roomID)
+	delete(repository.reserved, roomID)
+	return nil
+}
+
+// Reserve takes the nights of the reservation, unless it was already applied or cancelled
+func (repository Memory) Reserve(ctx context.Context, reservation availabilityDAO.Reservation) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.sweep()
+	if _, exists := repository.reservations[reservation.ID]; exists {
+		return nil
+	}
+	repository.reservations[reservation.ID] = &record{Reservation: reservation}
+
+	counts, ok := repository.reserved[reservation.RoomID]
+	if !ok {
+		counts = make(map[string]int)
+		repository.reserved[reservation.RoomID] = counts
+	}
+	for _, night := range reservation.Nights {
+		counts[night.Format(time.DateOnly)]++
+	}
+	return nil
+}
+
+// Release gives back the nights of the reservation once, and remembers it's cancelled
+func (repository Memory) Release(ctx context.Context, reservation availabilityDAO.Reservation) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.sweep()
+	current, exists := repository.reservations[reservation.ID]
+	if !exists {
+		repository.reservations[reservation.ID] = &record{Reservation: reservation, cancelled: true}
+		return nil
+	}
+	if current.cancelled {
+		return nil
+	}
+	current.cancelled = true
+
+	counts := repository.reserved[current.RoomID]
+	for _, night := range current.Nights {
+		key := night.Format(time.DateOnly)
+		if counts[key] > 1 {
+			counts[key]--
+		} else {
+			delete(counts, key)
+		}
+	}
+	return nil
+}
+
+func (repository Memory) AvailableHotels(ctx context.Context, nights []time.Time, guests int) ([]string, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	// A hotel is available if any of its rooms fits the guests and has a free unit every night
+	available := make(map[string]bool)
+	for _, room := range repository.rooms {
+		if available[room.HotelID] || room.Capacity < guests {
+			continue
+		}
+		free := true
+		for _, night := range nights {
+			if repository.reserved[room.ID][night.Format(time.DateOnly)] >= room.Units {
+				free = false
+				break
+			}
+		}
+		if free {
+			available[room.HotelID] = true
+		}
+	}
+
+	hotelIDs := make([]string, 0, len(available))
+	for hotelID := range available {
+		hotelIDs = append(hotelIDs, hotelID)
+	}
+	return hotelIDs, nil
+}
+
+// sweep forgets the reservations and nights already past, once a day. It must be called
+// holding the lock
+func (repository Memory) sweep() {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if *repository.sweptOn == today.Format(time.DateOnly) {
+		return
+	}
+	*repository.sweptOn = today.Format(time.DateOnly)
+
+	for id, record := range repository.reservations {
+		if len(record.Nights) == 0 || record.Nights[len(record.Nights)-1].Before(today) {
+			delete(repository.reservations, id)
+		}
+	}
+	for _, counts := range repository.reserved {
+		for key := range counts {
+			if night, err := time.Parse(time.DateOnly, key); err == nil && night.Before(today) {
+				delete(counts, key)
+			}
+		}
+	}
+}
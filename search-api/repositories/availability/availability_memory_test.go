@@ -0,0 +1,61 @@
+package availability_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	availabilityDAO "search-api/dao/availability"
+	repositories "search-api/repositories/availability"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	night := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 7)
+	nights := []time.Time{night, night.AddDate(0, 0, 1)}
+	reservation := availabilityDAO.Reservation{ID: "reservation-1", RoomID: "room-1", Nights: nights}
+
+	newRepository := func() repositories.Memory {
+		repository := repositories.NewMemory()
+		assert.NoError(t, repository.UpsertRoom(ctx, availabilityDAO.Room{ID: "room-1", HotelID: "hotel-1", Capacity: 2, Units: 1}))
+		return repository
+	}
+	available := func(repository repositories.Memory) []string {
+		hotelIDs, err := repository.AvailableHotels(ctx, nights, 2)
+		assert.NoError(t, err)
+		return hotelIDs
+	}
+
+	t.Run("Reserve - Redelivered", func(t *testing.T) {
+		repository := newRepository()
+		assert.NoError(t, repository.Reserve(ctx, reservation))
+		assert.NoError(t, repository.Reserve(ctx, reservation))
+		assert.Empty(t, available(repository))
+
+		// A single cancel frees the unit even though the create was delivered twice
+		assert.NoError(t, repository.Release(ctx, reservation))
+		assert.Equal(t, []string{"hotel-1"}, available(repository))
+	})
+
+	t.Run("Release - Redelivered", func(t *testing.T) {
+		repository := newRepository()
+		other := availabilityDAO.Reservation{ID: "reservation-2", RoomID: "room-1", Nights: nights}
+		assert.NoError(t, repository.UpsertRoom(ctx, availabilityDAO.Room{ID: "room-1", HotelID: "hotel-1", Capacity: 2, Units: 2}))
+		assert.NoError(t, repository.Reserve(ctx, reservation))
+		assert.NoError(t, repository.Reserve(ctx, other))
+
+		// Cancelling one reservation twice doesn't free the unit held by the other
+		assert.NoError(t, repository.Release(ctx, reservation))
+		assert.NoError(t, repository.Release(ctx, reservation))
+		assert.NoError(t, repository.UpsertRoom(ctx, availabilityDAO.Room{ID: "room-1", HotelID: "hotel-1", Capacity: 2, Units: 1}))
+		assert.Empty(t, available(repository))
+	})
+
+	t.Run("Reserve - After Cancel", func(t *testing.T) {
+		repository := newRepository()
+		assert.NoError(t, repository.Release(ctx, reservation))
+		assert.NoError(t, repository.Reserve(ctx, reservation))
+
+		assert.Equal(t, []string{"hotel-1"}, available(repository))
+	})
+}
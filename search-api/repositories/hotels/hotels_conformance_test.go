@@ -0,0 +1,390 @@
+package hotels_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"os"
+	hotelsDAO "search-api/dao/hotels"
+	repositories "search-api/repositories/hotels"
+	services "search-api/services/search"
+	"testing"
+	"time"
+)
+
+// testProfiles requires every word, so the matches don't depend on how each engine scores
+var testProfiles = map[string]repositories.RankingProfile{
+	"default": {
+		Fields: []repositories.FieldBoost{
+			{Field: "name", Boost: 3},
+			{Field: "city", Boost: 2},
+			{Field: "state", Boost: 1},
+			{Field: "address", Boost: 1},
+			{Field: "amenities", Boost: 1},
+		},
+		PhraseFields: []repositories.FieldBoost{{Field: "name", Boost: 5}},
+		MinimumMatch: "100%",
+	},
+}
+
+var testHotels = []hotelsDAO.Hotel{
+	{ID: "h1", Name: "Grand Plaza Hotel", Address: "1 Main Street", City: "New York", State: "NY", Rating: 4.5, Amenities: []string{"wifi", "pool"}, Latitude: 40.7128, Longitude: -74.0060, Version: 1},
+	{ID: "h2", Name: "Harbor Inn", Address: "5 Ocean Drive", City: "Miami", State: "FL", Rating: 3.5, Amenities: []string{"wifi", "parking"}, Latitude: 25.7617, Longitude: -80.1918, Version: 1},
+	{ID: "h3", Name: "Plaza Suites", Address: "20 Park Avenue", City: "New York", State: "NY", Rating: 3.0, Amenities: []string{"pool", "gym"}, Latitude: 40.7306, Longitude: -73.9866, Version: 1},
+	{ID: "h4", Name: "Mountain Lodge", Address: "7 Pine Road", City: "Denver", State: "CO", Rating: 4.0, Amenities: []string{"parking"}, Latitude: 39.7392, Longitude: -104.9903, Version: 1},
+	{ID: "h5", Name: "City Hostel", Address: "9 Broad Street", City: "York", State: "PA", Rating: 2.0, Amenities: []string{"wifi"}, Latitude: 39.9626, Longitude: -76.7277, Version: 1},
+}
+
+func TestMemoryConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) services.Repository {
+		return repositories.NewMemory(repositories.MemoryConfig{
+			Collection: "hotels",
+			Profiles:   testProfiles,
+		})
+	})
+}
+
+// TestSolrConformance runs against the Solr at SEARCH_TEST_SOLR_URL, e.g. http://localhost:8983,
+// each test gets its own core created from the hotels configset
+func TestSolrConformance(t *testing.T) {
+	parsed := solrTestURL(t)
+
+	runConformance(t, func(t *testing.T) services.Repository {
+		solrRepo := newSolrCore(t, parsed)
+		return committed{Repository: solrRepo, solr: solrRepo}
+	})
+}
+
+// TestSolrIndexerConformance runs the batching indexer main uses against the same Solr
+func TestSolrIndexerConformance(t *testing.T) {
+	parsed := solrTestURL(t)
+
+	runConformance(t, func(t *testing.T) services.Repository {
+		solrRepo := newSolrCore(t, parsed)
+		indexer := repositories.NewSolrIndexer(solrRepo, repositories.IndexerConfig{
+			BatchSize:     100,
+			FlushInterval: 10 * time.Millisecond,
+			CommitWithin:  time.Minute,
+		})
+		return committed{Repository: indexer, solr: solrRepo}
+	})
+}
+
+// solrTestURL returns SEARCH_TEST_SOLR_URL, skipping the test when it isn't set
+func solrTestURL(t *testing.T) *url.URL {
+	solrURL := os.Getenv("SEARCH_TEST_SOLR_URL")
+	if solrURL == "" {
+		t.Skip("SEARCH_TEST_SOLR_URL not set")
+	}
+	parsed, err := url.Parse(solrURL)
+	require.NoError(t, err)
+	return parsed
+}
+
+// newSolrCore creates a core from the hotels configset, dropped when the test ends
+func newSolrCore(t *testing.T, parsed *url.URL) repositories.Solr {
+	config := repositories.SolrConfig{
+		Host:       parsed.Hostname(),
+		Port:       parsed.Port(),
+		Collection: "hotels",
+		ConfigSet:  "hotels",
+		Profiles:   testProfiles,
+	}
+	collection, err := repositories.NewSolr(config).CreateCollection(context.Background())
+	require.NoError(t, err)
+
+	config.Collection = collection
+	solrRepo := repositories.NewSolr(config)
+	t.Cleanup(func() {
+		_ = solrRepo.DropCollection(context.Background(), collection)
+	})
+	return solrRepo
+}
+
+// committed hard commits after every write, which the repositories leave to commitWithin, so
+// the assertions see the writes right away. The indexer writes return once flushed
+type committed struct {
+	services.Repository
+	solr repositories.Solr
+}
+
+func (repository committed) Index(ctx context.Context, hotel hotelsDAO.Hotel) (string, error) {
+	id, err := repository.Repository.Index(ctx, hotel)
+	if err != nil {
+		return "", err
+	}
+	return id, repository.solr.Client.Commit(ctx, repository.solr.Collection)
+}
+
+func (repository committed) Update(ctx context.Context, hotel hotelsDAO.Hotel) error {
+	if err := repository.Repository.Update(ctx, hotel); err != nil {
+		return err
+	}
+	return repository.solr.Client.Commit(ctx, repository.solr.Collection)
+}
+
+func (repository committed) Delete(ctx context.Context, id string, version int64) error {
+	if err := repository.Repository.Delete(ctx, id, version); err != nil {
+		return err
+	}
+	return repository.solr.Client.Commit(ctx, repository.solr.Collection)
+}
+
+// TestElasticsearchConformance runs against the Elasticsearch or OpenSearch at
+// SEARCH_TEST_ELASTICSEARCH_URL, e.g. http://localhost:9200, each test gets its own index alias
+func TestElasticsearchConformance(t *testing.T) {
+	elasticsearchURL := os.Getenv("SEARCH_TEST_ELASTICSEARCH_URL")
+	if elasticsearchURL == "" {
+		t.Skip("SEARCH_TEST_ELASTICSEARCH_URL not set")
+	}
+	parsed, err := url.Parse(elasticsearchURL)
+	require.NoError(t, err)
+
+	runConformance(t, func(t *testing.T) services.Repository {
+		index := fmt.Sprintf("hotels_test_%d", time.Now().UnixNano())
+		t.Cleanup(func() {
+			// Delete the indices behind the alias
+			resp, err := http.Get(fmt.Sprintf("%s/_alias/%s", elasticsearchURL, index))
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			indices := make(map[string]interface{})
+			_ = json.NewDecoder(resp.Body).Decode(&indices)
+			for name := range indices {
+				req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", elasticsearchURL, name), nil)
+				if resp, err := http.DefaultClient.Do(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+		})
+		return repositories.NewElasticsearch(repositories.ElasticsearchConfig{
+			Host:     parsed.Hostname(),
+			Port:     parsed.Port(),
+			Index:    index,
+			Profiles: testProfiles,
+		})
+	})
+}
+
+// runConformance checks the behavior every Repository implementation must share
+func runConformance(t *testing.T, newRepository func(t *testing.T) services.Repository) {
+	ctx := context.Background()
+
+	// seed returns a repository holding the test hotels
+	seed := func(t *testing.T) services.Repository {
+		repository := newRepository(t)
+		for _, hotel := range testHotels {
+			_, err := repository.Index(ctx, hotel)
+			require.NoError(t, err)
+		}
+		return repository
+	}
+
+	search := func(t *testing.T, repository services.Repository, query hotelsDAO.Query) hotelsDAO.SearchResult {
+		query.Mode = hotelsDAO.ModeSimple
+		query.Profile = "default"
+		if query.Limit == 0 {
+			query.Limit = 10
+		}
+		result, err := repository.Search(ctx, query)
+		require.NoError(t, err)
+		return result
+	}
+
+	ids := func(result hotelsDAO.SearchResult) []string {
+		ids := make([]string, 0, len(result.Hotels))
+		for _, hotel := range result.Hotels {
+			ids = append(ids, hotel.ID)
+		}
+		return ids
+	}
+
+	t.Run("Search - Text", func(t *testing.T) {
+		repository := seed(t)
+
+		result := search(t, repository, hotelsDAO.Query{Text: "plaza"})
+		assert.Equal(t, 2, result.Total)
+		assert.ElementsMatch(t, []string{"h1", "h3"}, ids(result))
+		for _, hotel := range result.Hotels {
+			assert.Contains(t, hotel.Highlights["name"][0], "<em>Plaza</em>")
+		}
+
+		// Every word is required by the test profile
+		result = search(t, repository, hotelsDAO.Query{Text: "Plaza WIFI"})
+		assert.Equal(t, []string{"h1"}, ids(result))
+
+		// Query syntax is taken as words
+		result = search(t, repository, hotelsDAO.Query{Text: "name:plaza (city:miami"})
+		assert.Equal(t, 0, result.Total)
+
+		// Advanced queries search the name unless they say otherwise
+		result, err := repository.Search(ctx, hotelsDAO.Query{Text: "plaza -suites", Mode: hotelsDAO.ModeAdvanced, Profile: "default", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"h1"}, ids(result))
+
+		result, err = repository.Search(ctx, hotelsDAO.Query{Text: `city:"new york" AND amenities:gym`, Mode: hotelsDAO.ModeAdvanced, Profile: "default", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"h3"}, ids(result))
+	})
+
+	t.Run("Search - Filters", func(t *testing.T) {
+		repository := seed(t)
+
+		result := search(t, repository, hotelsDAO.Query{City: "New York", Sort: hotelsDAO.SortName})
+		assert.Equal(t, []string{"h1", "h3"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{State: "fl"})
+		assert.Equal(t, []string{"h2"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{Amenities: []string{"wifi", "pool"}})
+		assert.Equal(t, []string{"h1"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{Amenities: []string{"pool", "parking"}, AmenitiesMatch: hotelsDAO.MatchAny})
+		assert.Equal(t, []string{"h1", "h2", "h3", "h4"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{MinRating: 3.5, MaxRating: 4.5, Sort: hotelsDAO.SortRating})
+		assert.Equal(t, []string{"h1", "h4", "h2"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{HotelIDs: []string{"h4", "h2"}})
+		assert.Equal(t, []string{"h2", "h4"}, ids(result))
+	})
+
+	t.Run("Search - Geo", func(t *testing.T) {
+		repository := seed(t)
+
+		result := search(t, repository, hotelsDAO.Query{
+			Latitude:  40.7128,
+			Longitude: -74.0060,
+			RadiusKm:  10,
+			Geo:       true,
+			Sort:      hotelsDAO.SortDistance,
+		})
+		assert.Equal(t, []string{"h1", "h3"}, ids(result))
+		require.NotNil(t, result.Hotels[0].Distance)
+		require.NotNil(t, result.Hotels[1].Distance)
+		assert.InDelta(t, 0, *result.Hotels[0].Distance, 0.1)
+		assert.InDelta(t, 2.6, *result.Hotels[1].Distance, 0.2)
+		assert.InDelta(t, 40.7306, result.Hotels[1].Latitude, 0.0001)
+	})
+
+	t.Run("Search - Sort and Pagination", func(t *testing.T) {
+		repository := seed(t)
+
+		result := search(t, repository, hotelsDAO.Query{Sort: hotelsDAO.SortName, Offset: 1, Limit: 2})
+		assert.Equal(t, 5, result.Total)
+		assert.Equal(t, []string{"h1", "h2"}, ids(result))
+
+		result = search(t, repository, hotelsDAO.Query{Sort: hotelsDAO.SortName, Offset: 4, Limit: 2})
+		assert.Equal(t, []string{"h3"}, ids(result))
+	})
+
+	t.Run("Search - Facets", func(t *testing.T) {
+		repository := seed(t)
+
+		// Each facet ignores its own filter
+		result := search(t, repository, hotelsDAO.Query{City: "New York"})
+		assert.Equal(t, []hotelsDAO.FacetCount{
+			{Value: "New York", Count: 2},
+			{Value: "Denver", Count: 1},
+			{Value: "Miami", Count: 1},
+			{Value: "York", Count: 1},
+		}, result.Facets.City)
+		assert.Equal(t, []hotelsDAO.FacetCount{{Value: "NY", Count: 2}}, result.Facets.State)
+		assert.Equal(t, []hotelsDAO.FacetCount{
+			{Value: "pool", Count: 2},
+			{Value: "gym", Count: 1},
+			{Value: "wifi", Count: 1},
+		}, result.Facets.Amenities)
+		assert.Equal(t, []hotelsDAO.FacetCount{
+			{Value: "4-5", Count: 1},
+			{Value: "3-4", Count: 1},
+			{Value: "2-3", Count: 0},
+			{Value: "0-2", Count: 0},
+		}, result.Facets.Rating)
+	})
+
+	t.Run("Search - Unknown Profile", func(t *testing.T) {
+		repository := newRepository(t)
+
+		_, err := repository.Search(ctx, hotelsDAO.Query{Profile: "missing", Limit: 10})
+		assert.ErrorIs(t, err, hotelsDAO.ErrUnknownProfile)
+	})
+
+	t.Run("Update and Delete", func(t *testing.T) {
+		repository := seed(t)
+
+		updated := testHotels[1]
+		updated.Name = "Harbor View Resort"
+		updated.Version = 2
+		require.NoError(t, repository.Update(ctx, updated))
+		result := search(t, repository, hotelsDAO.Query{Text: "resort"})
+		assert.Equal(t, []string{"h2"}, ids(result))
+		assert.Equal(t, "Harbor View Resort", result.Hotels[0].Name)
+		assert.Equal(t, int64(2), result.Hotels[0].Version)
+
+		// Deleted hotels are kept as tombstones, never returned
+		require.NoError(t, repository.Delete(ctx, "h5", 2))
+		result = search(t, repository, hotelsDAO.Query{})
+		assert.Equal(t, 4, result.Total)
+		assert.NotContains(t, ids(result), "h5")
+
+		version, found, err := repository.GetVersion(ctx, "h5")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(2), version)
+
+		_, found, err = repository.GetVersion(ctx, "missing")
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		versions := make([]hotelsDAO.IndexedVersion, 0)
+		require.NoError(t, repository.ScanVersions(ctx, func(version hotelsDAO.IndexedVersion) error {
+			versions = append(versions, version)
+			return nil
+		}))
+		assert.Equal(t, []hotelsDAO.IndexedVersion{
+			{ID: "h1", Version: 1},
+			{ID: "h2", Version: 2},
+			{ID: "h3", Version: 1},
+			{ID: "h4", Version: 1},
+			{ID: "h5", Version: 2, Deleted: true},
+		}, versions)
+	})
+
+	t.Run("Suggest", func(t *testing.T) {
+		repository := seed(t)
+		require.NoError(t, repository.BuildSuggestions(ctx))
+
+		suggestions, err := repository.Suggest(ctx, "pla", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, []hotelsDAO.Suggestion{
+			{Text: "Grand Plaza Hotel", Type: hotelsDAO.SuggestionName, Weight: 4},
+			{Text: "Plaza Suites", Type: hotelsDAO.SuggestionName, Weight: 3},
+		}, suggestions)
+	})
+
+	t.Run("Rebuild Collection", func(t *testing.T) {
+		repository := seed(t)
+
+		collection, err := repository.CreateCollection(ctx)
+		require.NoError(t, err)
+		require.NoError(t, repository.IndexInto(ctx, collection, testHotels[3:4]))
+
+		// The live collection is searched until the swap
+		result := search(t, repository, hotelsDAO.Query{})
+		assert.Equal(t, 5, result.Total)
+
+		require.NoError(t, repository.SwapCollection(ctx, collection))
+		result = search(t, repository, hotelsDAO.Query{})
+		assert.Equal(t, []string{"h4"}, ids(result))
+
+		dropped, err := repository.CreateCollection(ctx)
+		require.NoError(t, err)
+		assert.NoError(t, repository.DropCollection(ctx, dropped))
+	})
+}
@@ -0,0 +1,819 @@
+package hotels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"search-api/dao/hotels"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// elasticsearchTimeout bounds each request to the cluster
+	elasticsearchTimeout = 30 * time.Second
+)
+
+// errNotFound is returned by request when the index or document doesn't exist
+var errNotFound = errors.New("not found")
+
+// elasticsearchMapping mirrors the Solr schema: text fields for matching, keyword subfields
+// for sorting and facets, and search_as_you_type subfields for the suggestions
+var elasticsearchMapping = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "keyword"},
+			"name": map[string]interface{}{
+				"type":    "text",
+				"copy_to": "spell",
+				"fields": map[string]interface{}{
+					"sort":    map[string]interface{}{"type": "keyword"},
+					"suggest": map[string]interface{}{"type": "search_as_you_type"},
+				},
+			},
+			"address": map[string]interface{}{"type": "text"},
+			"city": map[string]interface{}{
+				"type":    "text",
+				"copy_to": "spell",
+				"fields": map[string]interface{}{
+					"facet":   map[string]interface{}{"type": "keyword"},
+					"suggest": map[string]interface{}{"type": "search_as_you_type"},
+				},
+			},
+			"state": map[string]interface{}{
+				"type":    "text",
+				"copy_to": "spell",
+				"fields": map[string]interface{}{
+					"facet": map[string]interface{}{"type": "keyword"},
+				},
+			},
+			"amenities": map[string]interface{}{
+				"type":    "text",
+				"copy_to": "spell",
+				"fields": map[string]interface{}{
+					"facet": map[string]interface{}{"type": "keyword"},
+				},
+			},
+			"rating":   map[string]interface{}{"type": "float"},
+			"location": map[string]interface{}{"type": "geo_point"},
+			"version":  map[string]interface{}{"type": "long"},
+			"deleted":  map[string]interface{}{"type": "boolean"},
+			"spell":    map[string]interface{}{"type": "text"},
+		},
+	},
+}
+
+type ElasticsearchConfig struct {
+	Host     string                    // Elasticsearch or OpenSearch host
+	Port     string                    // Elasticsearch or OpenSearch port
+	Username string                    // Basic auth username, if any
+	Password string                    // Basic auth password
+	Index    string                    // Alias of the live index
+	Profiles map[string]RankingProfile // Ranking profiles for simple queries, by name
+}
+
+// Elasticsearch searches the hotels in Elasticsearch or OpenSearch through their REST API.
+// Searches go through an alias, so the index can be rebuilt and swapped like the Solr cores.
+// Profile boost functions use the Solr function syntax, so they aren't applied here
+type Elasticsearch struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+	index    string
+	profiles map[string]RankingProfile
+}
+
+// elasticsearchDocument is the indexed hotel
+type elasticsearchDocument struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name,omitempty"`
+	Address   string                 `json:"address,omitempty"`
+	City      string                 `json:"city,omitempty"`
+	State     string                 `json:"state,omitempty"`
+	Rating    float64                `json:"rating"`
+	Amenities []string               `json:"amenities,omitempty"`
+	Location  *elasticsearchLocation `json:"location,omitempty"`
+	Version   int64                  `json:"version"`
+	Deleted   bool                   `json:"deleted"`
+}
+
+type elasticsearchLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type elasticsearchHit struct {
+	Source    elasticsearchDocument    `json:"_source"`
+	Fields    map[string][]interface{} `json:"fields"`
+	Highlight map[string][]string      `json:"highlight"`
+	Sort      []interface{}            `json:"sort"`
+}
+
+type elasticsearchSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []elasticsearchHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]struct {
+		Values struct {
+			Buckets []struct {
+				Key      interface{} `json:"key"`
+				DocCount int         `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"values"`
+	} `json:"aggregations"`
+	Suggest map[string][]struct {
+		Text    string `json:"text"`
+		Offset  int    `json:"offset"`
+		Length  int    `json:"length"`
+		Options []struct {
+			Text string `json:"text"`
+		} `json:"options"`
+	} `json:"suggest"`
+}
+
+// NewElasticsearch initializes a new Elasticsearch client, creating the index on first run
+func NewElasticsearch(config ElasticsearchConfig) Elasticsearch {
+	searchEngine := Elasticsearch{
+		client:   &http.Client{Timeout: elasticsearchTimeout},
+		baseURL:  fmt.Sprintf("http://%s:%s", config.Host, config.Port),
+		username: config.Username,
+		password: config.Password,
+		index:    config.Index,
+		profiles: config.Profiles,
+	}
+
+	// The alias is created along with its first index, as solr-create does for the core
+	ctx := context.Background()
+	err := searchEngine.request(ctx, http.MethodHead, "/_alias/"+url.PathEscape(config.Index), nil, nil)
+	if errors.Is(err, errNotFound) {
+		name, err := searchEngine.CreateCollection(ctx)
+		if err != nil {
+			log.Printf("error creating elasticsearch index: %v", err)
+			return searchEngine
+		}
+		if err := searchEngine.request(ctx, http.MethodPut, fmt.Sprintf("/%s/_alias/%s", url.PathEscape(name), url.PathEscape(config.Index)), nil, nil); err != nil {
+			log.Printf("error creating elasticsearch alias: %v", err)
+		}
+	} else if err != nil {
+		log.Printf("error checking elasticsearch alias: %v", err)
+	}
+	return searchEngine
+}
+
+// Index adds a new hotel document, searchable once it returns
+func (searchEngine Elasticsearch) Index(ctx context.Context, hotel hotels.Hotel) (string, error) {
+	if err := searchEngine.put(ctx, hotel.ID, elasticsearchHotelDocument(hotel)); err != nil {
+		return "", fmt.Errorf("error indexing hotel: %w", err)
+	}
+	return hotel.ID, nil
+}
+
+// Update replaces the hotel document, searchable once it returns
+func (searchEngine Elasticsearch) Update(ctx context.Context, hotel hotels.Hotel) error {
+	if err := searchEngine.put(ctx, hotel.ID, elasticsearchHotelDocument(hotel)); err != nil {
+		return fmt.Errorf("error updating hotel: %w", err)
+	}
+	return nil
+}
+
+// Delete replaces the hotel document with a tombstone holding the version of the delete,
+// tombstones are never returned by searches
+func (searchEngine Elasticsearch) Delete(ctx context.Context, id string, version int64) error {
+	if err := searchEngine.put(ctx, id, elasticsearchDocument{ID: id, Version: version, Deleted: true}); err != nil {
+		return fmt.Errorf("error deleting hotel: %w", err)
+	}
+	return nil
+}
+
+func (searchEngine Elasticsearch) put(ctx context.Context, id string, doc elasticsearchDocument) error {
+	path := fmt.Sprintf("/%s/_doc/%s?refresh=wait_for", url.PathEscape(searchEngine.index), url.PathEscape(id))
+	return searchEngine.request(ctx, http.MethodPut, path, doc, nil)
+}
+
+// GetVersion returns the indexed version of a hotel, tombstones included, and whether it's indexed at all
+func (searchEngine Elasticsearch) GetVersion(ctx context.Context, id string) (int64, bool, error) {
+	var resp struct {
+		Found  bool                  `json:"found"`
+		Source elasticsearchDocument `json:"_source"`
+	}
+	path := fmt.Sprintf("/%s/_doc/%s?_source_includes=version", url.PathEscape(searchEngine.index), url.PathEscape(id))
+	err := searchEngine.request(ctx, http.MethodGet, path, nil, &resp)
+	if errors.Is(err, errNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error getting hotel version: %w", err)
+	}
+	return resp.Source.Version, resp.Found, nil
+}
+
+// ScanVersions calls fn with the version of every document in the index, tombstones included
+func (searchEngine Elasticsearch) ScanVersions(ctx context.Context, fn func(version hotels.IndexedVersion) error) error {
+	var after []interface{}
+	for {
+		body := map[string]interface{}{
+			"size":    scanPageSize,
+			"_source": []string{"id", "version", "deleted"},
+			"query":   map[string]interface{}{"match_all": map[string]interface{}{}},
+			"sort":    []interface{}{map[string]interface{}{"id": "asc"}},
+		}
+		if after != nil {
+			body["search_after"] = after
+		}
+		var resp elasticsearchSearchResponse
+		if err := searchEngine.request(ctx, http.MethodPost, fmt.Sprintf("/%s/_search", url.PathEscape(searchEngine.index)), body, &resp); err != nil {
+			return fmt.Errorf("error executing scan query: %w", err)
+		}
+		for _, hit := range resp.Hits.Hits {
+			if err := fn(hotels.IndexedVersion{
+				ID:      hit.Source.ID,
+				Version: hit.Source.Version,
+				Deleted: hit.Source.Deleted,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(resp.Hits.Hits) < scanPageSize {
+			return nil
+		}
+		after = resp.Hits.Hits[len(resp.Hits.Hits)-1].Sort
+	}
+}
+
+// CreateCollection creates an empty index to rebuild the hotels into
+func (searchEngine Elasticsearch) CreateCollection(ctx context.Context) (string, error) {
+	name := fmt.Sprintf("%s_%d", searchEngine.index, time.Now().UnixNano())
+	if err := searchEngine.request(ctx, http.MethodPut, "/"+url.PathEscape(name), elasticsearchMapping, nil); err != nil {
+		return "", fmt.Errorf("error creating index %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// IndexInto adds a batch of hotels to an index being rebuilt, they're refreshed on swap
+func (searchEngine Elasticsearch) IndexInto(ctx context.Context, collection string, hotelsList []hotels.Hotel) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, hotel := range hotelsList {
+		action := map[string]interface{}{"index": map[string]interface{}{"_id": hotel.ID}}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("error marshaling bulk action: %w", err)
+		}
+		if err := encoder.Encode(elasticsearchHotelDocument(hotel)); err != nil {
+			return fmt.Errorf("error marshaling hotel document: %w", err)
+		}
+	}
+
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := searchEngine.request(ctx, http.MethodPost, fmt.Sprintf("/%s/_bulk", url.PathEscape(collection)), body.Bytes(), &resp); err != nil {
+		return fmt.Errorf("error indexing hotels into %s: %w", collection, err)
+	}
+	if resp.Errors {
+		for _, item := range resp.Items {
+			for _, result := range item {
+				if len(result.Error) > 0 {
+					return fmt.Errorf("failed to index hotel %s into %s: %s", result.ID, collection, result.Error)
+				}
+			}
+		}
+		return fmt.Errorf("failed to index hotels into %s", collection)
+	}
+	return nil
+}
+
+// SwapCollection refreshes a rebuilt index and atomically points the alias to it, then
+// deletes the previous indices
+func (searchEngine Elasticsearch) SwapCollection(ctx context.Context, collection string) error {
+	if err := searchEngine.request(ctx, http.MethodPost, fmt.Sprintf("/%s/_refresh", url.PathEscape(collection)), nil, nil); err != nil {
+		return fmt.Errorf("error refreshing index %s: %w", collection, err)
+	}
+
+	// The indices behind the alias, keyed by name
+	previous := make(map[string]interface{})
+	err := searchEngine.request(ctx, http.MethodGet, "/_alias/"+url.PathEscape(searchEngine.index), nil, &previous)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return fmt.Errorf("error getting the indices of %s: %w", searchEngine.index, err)
+	}
+
+	actions := make([]interface{}, 0, len(previous)+1)
+	names := make([]string, 0, len(previous))
+	for name := range previous {
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": name, "alias": searchEngine.index}})
+		names = append(names, url.PathEscape(name))
+	}
+	actions = append(actions, map[string]interface{}{"add": map[string]interface{}{"index": collection, "alias": searchEngine.index}})
+	if err := searchEngine.request(ctx, http.MethodPost, "/_aliases", map[string]interface{}{"actions": actions}, nil); err != nil {
+		return fmt.Errorf("error swapping indices: %w", err)
+	}
+
+	if len(names) > 0 {
+		sort.Strings(names)
+		if err := searchEngine.request(ctx, http.MethodDelete, "/"+strings.Join(names, ","), nil, nil); err != nil {
+			return fmt.Errorf("error deleting previous indices: %w", err)
+		}
+	}
+	return nil
+}
+
+// DropCollection removes an index that was being rebuilt
+func (searchEngine Elasticsearch) DropCollection(ctx context.Context, collection string) error {
+	if err := searchEngine.request(ctx, http.MethodDelete, "/"+url.PathEscape(collection), nil, nil); err != nil {
+		return fmt.Errorf("error deleting index %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (searchEngine Elasticsearch) Search(ctx context.Context, query hotels.Query) (hotels.SearchResult, error) {
+	profile, ok := searchEngine.profiles[query.Profile]
+	if !ok {
+		return hotels.SearchResult{}, fmt.Errorf("%w: %s", hotels.ErrUnknownProfile, query.Profile)
+	}
+
+	var resp elasticsearchSearchResponse
+	if err := searchEngine.request(ctx, http.MethodPost, fmt.Sprintf("/%s/_search", url.PathEscape(searchEngine.index)), buildElasticsearchSearch(query, profile), &resp); err != nil {
+		return hotels.SearchResult{}, fmt.Errorf("error executing search query: %w", err)
+	}
+
+	hotelsList := make([]hotels.Hotel, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		hotel := hotels.Hotel{
+			ID:         hit.Source.ID,
+			Name:       hit.Source.Name,
+			Address:    hit.Source.Address,
+			City:       hit.Source.City,
+			State:      hit.Source.State,
+			Rating:     hit.Source.Rating,
+			Amenities:  hit.Source.Amenities,
+			Version:    hit.Source.Version,
+			Highlights: parseHighlights(hit.Highlight),
+		}
+		if hit.Source.Location != nil {
+			hotel.Latitude, hotel.Longitude = hit.Source.Location.Lat, hit.Source.Location.Lon
+		}
+		if values := hit.Fields["distance"]; len(values) > 0 {
+			if distance, ok := values[0].(float64); ok {
+				hotel.Distance = &distance
+			}
+		}
+		hotelsList = append(hotelsList, hotel)
+	}
+
+	return hotels.SearchResult{
+		Hotels:    hotelsList,
+		Total:     resp.Hits.Total.Value,
+		Facets:    parseElasticsearchFacets(resp),
+		Collation: parseElasticsearchCollation(query.Text, resp),
+	}, nil
+}
+
+// BuildSuggestions does nothing, the suggestions are served from the live index
+func (searchEngine Elasticsearch) BuildSuggestions(ctx context.Context) error {
+	return nil
+}
+
+// Suggest returns the hotel names and cities completing the given prefix, best rated first
+func (searchEngine Elasticsearch) Suggest(ctx context.Context, prefix string, limit int) ([]hotels.Suggestion, error) {
+	// One search per field, collapsed so each name or city is returned once
+	fields := map[string]string{
+		hotels.SuggestionName: "name",
+		hotels.SuggestionCity: "city",
+	}
+	collapse := map[string]string{
+		hotels.SuggestionName: "name.sort",
+		hotels.SuggestionCity: "city.facet",
+	}
+
+	suggestions := make([]hotels.Suggestion, 0)
+	seen := make(map[string]bool)
+	for suggestionType, field := range fields {
+		body := map[string]interface{}{
+			"size":    limit,
+			"_source": []string{field, "rating"},
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must": map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":    prefix,
+							"type":     "bool_prefix",
+							"operator": "and",
+							"fields":   []string{field + ".suggest", field + ".suggest._2gram", field + ".suggest._3gram"},
+						},
+					},
+					"filter": elasticsearchNotDeleted(),
+				},
+			},
+			"collapse": map[string]interface{}{"field": collapse[suggestionType]},
+			"sort":     []interface{}{map[string]interface{}{"rating": "desc"}, map[string]interface{}{"id": "asc"}},
+		}
+		var resp elasticsearchSearchResponse
+		if err := searchEngine.request(ctx, http.MethodPost, fmt.Sprintf("/%s/_search", url.PathEscape(searchEngine.index)), body, &resp); err != nil {
+			return nil, fmt.Errorf("error executing suggest query: %w", err)
+		}
+
+		// Many hotels share the same city, duplicates are dropped
+		for _, hit := range resp.Hits.Hits {
+			text := hit.Source.Name
+			if suggestionType == hotels.SuggestionCity {
+				text = hit.Source.City
+			}
+			key := suggestionType + ":" + strings.ToLower(text)
+			if text == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			suggestions = append(suggestions, hotels.Suggestion{
+				Text:   text,
+				Type:   suggestionType,
+				Weight: int(hit.Source.Rating),
+			})
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Weight != suggestions[j].Weight {
+			return suggestions[i].Weight > suggestions[j].Weight
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// request sends a JSON body, or an NDJSON one when given bytes, and decodes the response into
+// result when given
+func (searchEngine Elasticsearch) request(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	contentType := "application/json"
+	switch value := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(value)
+		contentType = "application/x-ndjson"
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, searchEngine.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if searchEngine.username != "" {
+		req.SetBasicAuth(searchEngine.username, searchEngine.password)
+	}
+	resp, err := searchEngine.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("received status code %d: %s", resp.StatusCode, message)
+	}
+	if result == nil || method == http.MethodHead {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// elasticsearchHotelDocument builds the indexed document of a hotel
+func elasticsearchHotelDocument(hotel hotels.Hotel) elasticsearchDocument {
+	doc := elasticsearchDocument{
+		ID:        hotel.ID,
+		Name:      hotel.Name,
+		Address:   hotel.Address,
+		City:      hotel.City,
+		State:     hotel.State,
+		Rating:    hotel.Rating,
+		Amenities: hotel.Amenities,
+		Version:   hotel.Version,
+	}
+	if hasLocation(hotel) {
+		doc.Location = &elasticsearchLocation{Lat: hotel.Latitude, Lon: hotel.Longitude}
+	}
+	return doc
+}
+
+// buildElasticsearchSearch translates the query to a search request. The faceted filters go
+// in the post filter, so each facet can leave its own filter out as the tagged Solr facets do
+func buildElasticsearchSearch(query hotels.Query, profile RankingProfile) map[string]interface{} {
+	filters := []interface{}{elasticsearchNotDeleted()}
+	if query.HotelIDs != nil {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"id": query.HotelIDs}})
+	}
+	if query.Geo && query.RadiusKm > 0 {
+		filters = append(filters, map[string]interface{}{
+			"geo_distance": map[string]interface{}{
+				"distance": fmt.Sprintf("%gkm", query.RadiusKm),
+				"location": elasticsearchLocation{Lat: query.Latitude, Lon: query.Longitude},
+			},
+		})
+	}
+
+	facetFilters := buildElasticsearchFacetFilters(query)
+	body := map[string]interface{}{
+		"from":             query.Offset,
+		"size":             query.Limit,
+		"track_total_hits": true,
+		"_source":          true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   buildElasticsearchText(query, profile),
+				"filter": filters,
+			},
+		},
+		"post_filter": elasticsearchAllOf(facetFilters, ""),
+		"aggs":        buildElasticsearchFacets(facetFilters),
+		"sort":        buildElasticsearchSort(query),
+	}
+	if query.Geo {
+		// Return the distance to the given point along with each hotel
+		body["script_fields"] = map[string]interface{}{
+			"distance": map[string]interface{}{
+				"script": map[string]interface{}{
+					"source": "doc['location'].size() == 0 ? null : doc['location'].arcDistance(params.lat, params.lon) / 1000",
+					"params": map[string]interface{}{"lat": query.Latitude, "lon": query.Longitude},
+				},
+			},
+		}
+	}
+
+	text := strings.TrimSpace(query.Text)
+	if text != "" {
+		highlightFieldsConfig := make(map[string]interface{}, len(highlightFields))
+		for _, field := range highlightFields {
+			highlightFieldsConfig[field] = map[string]interface{}{}
+		}
+		body["highlight"] = map[string]interface{}{
+			"pre_tags":            []string{highlightPre},
+			"post_tags":           []string{highlightPost},
+			"number_of_fragments": 2,
+			"fragment_size":       100,
+			"fields":              highlightFieldsConfig,
+		}
+		// Advanced queries aren't spellchecked, their syntax would be taken for words
+		if query.Mode != hotels.ModeAdvanced {
+			body["suggest"] = map[string]interface{}{
+				"spelling": map[string]interface{}{
+					"text": text,
+					"term": map[string]interface{}{
+						"field":        "spell",
+						"suggest_mode": "missing",
+						"size":         1,
+					},
+				},
+			}
+		}
+	}
+	return body
+}
+
+// buildElasticsearchText matches simple queries over the profile fields like edismax, and
+// parses advanced ones as Lucene syntax
+func buildElasticsearchText(query hotels.Query, profile RankingProfile) interface{} {
+	text := strings.TrimSpace(query.Text)
+	if text == "" {
+		return map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	if query.Mode == hotels.ModeAdvanced {
+		return map[string]interface{}{
+			"query_string": map[string]interface{}{
+				"query":         text,
+				"default_field": advancedDefaultField,
+			},
+		}
+	}
+
+	// multi_match doesn't parse any syntax, the text is only split into words
+	match := map[string]interface{}{
+		"query":  text,
+		"type":   "best_fields",
+		"fields": formatElasticsearchFields(profile.Fields),
+	}
+	if profile.MinimumMatch != "" {
+		match["minimum_should_match"] = profile.MinimumMatch
+	}
+	phrases := make([]interface{}, 0, len(profile.PhraseFields))
+	for _, field := range profile.PhraseFields {
+		phrases = append(phrases, map[string]interface{}{
+			"match_phrase": map[string]interface{}{
+				field.Field: map[string]interface{}{"query": text, "boost": field.Boost},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   map[string]interface{}{"multi_match": match},
+			"should": phrases,
+		},
+	}
+}
+
+// formatElasticsearchFields formats fields the way multi_match expects them, e.g. "name^3"
+func formatElasticsearchFields(fields []FieldBoost) []string {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, fmt.Sprintf("%s^%g", field.Field, field.Boost))
+	}
+	return values
+}
+
+// buildElasticsearchFacetFilters translates the faceted filters, by facet
+func buildElasticsearchFacetFilters(query hotels.Query) map[string][]interface{} {
+	filters := make(map[string][]interface{})
+	if query.City != "" {
+		filters["city"] = []interface{}{elasticsearchPhrase("city", query.City)}
+	}
+	if query.State != "" {
+		filters["state"] = []interface{}{elasticsearchPhrase("state", query.State)}
+	}
+	if len(query.Amenities) > 0 {
+		amenities := make([]interface{}, 0, len(query.Amenities))
+		for _, amenity := range query.Amenities {
+			amenities = append(amenities, elasticsearchPhrase("amenities", amenity))
+		}
+		if query.AmenitiesMatch == hotels.MatchAny {
+			amenities = []interface{}{map[string]interface{}{
+				"bool": map[string]interface{}{"should": amenities, "minimum_should_match": 1},
+			}}
+		}
+		filters["amenities"] = amenities
+	}
+	if query.MinRating > 0 || query.MaxRating > 0 {
+		rating := make(map[string]interface{})
+		if query.MinRating > 0 {
+			rating["gte"] = query.MinRating
+		}
+		if query.MaxRating > 0 {
+			rating["lte"] = query.MaxRating
+		}
+		filters["rating"] = []interface{}{map[string]interface{}{"range": map[string]interface{}{"rating": rating}}}
+	}
+	return filters
+}
+
+// elasticsearchAllOf combines the faceted filters but the excluded facet's
+func elasticsearchAllOf(filters map[string][]interface{}, exclude string) map[string]interface{} {
+	all := make([]interface{}, 0)
+	for _, facet := range []string{"city", "state", "amenities", "rating"} {
+		if facet != exclude {
+			all = append(all, filters[facet]...)
+		}
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": all}}
+}
+
+// buildElasticsearchFacets requests the counts for the filters sidebar
+func buildElasticsearchFacets(filters map[string][]interface{}) map[string]interface{} {
+	terms := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": field,
+				"size":  facetLimit,
+				"order": []interface{}{map[string]interface{}{"_count": "desc"}, map[string]interface{}{"_key": "asc"}},
+			},
+		}
+	}
+	ranges := make([]interface{}, 0, len(ratingBuckets))
+	for _, bucket := range ratingBuckets {
+		rangeBucket := map[string]interface{}{"key": bucket.name}
+		if !math.IsInf(bucket.min, -1) {
+			rangeBucket["from"] = bucket.min
+		}
+		if !math.IsInf(bucket.max, 1) {
+			rangeBucket["to"] = bucket.max
+		}
+		ranges = append(ranges, rangeBucket)
+	}
+
+	aggregations := map[string]interface{}{
+		"city":      terms("city.facet"),
+		"state":     terms("state.facet"),
+		"amenities": terms("amenities.facet"),
+		"rating":    map[string]interface{}{"range": map[string]interface{}{"field": "rating", "ranges": ranges}},
+	}
+	facets := make(map[string]interface{}, len(aggregations))
+	for facet, aggregation := range aggregations {
+		facets[facet] = map[string]interface{}{
+			"filter": elasticsearchAllOf(filters, facet),
+			"aggs":   map[string]interface{}{"values": aggregation},
+		}
+	}
+	return facets
+}
+
+// parseElasticsearchFacets extracts the facet counts from the aggregations
+func parseElasticsearchFacets(resp elasticsearchSearchResponse) hotels.Facets {
+	terms := func(facet string) []hotels.FacetCount {
+		counts := make([]hotels.FacetCount, 0)
+		for _, bucket := range resp.Aggregations[facet].Values.Buckets {
+			counts = append(counts, hotels.FacetCount{Value: fmt.Sprint(bucket.Key), Count: bucket.DocCount})
+		}
+		return counts
+	}
+	result := hotels.Facets{
+		City:      terms("city"),
+		State:     terms("state"),
+		Amenities: terms("amenities"),
+		Rating:    make([]hotels.FacetCount, 0, len(ratingBuckets)),
+	}
+	ratings := make(map[string]int)
+	for _, bucket := range resp.Aggregations["rating"].Values.Buckets {
+		ratings[fmt.Sprint(bucket.Key)] = bucket.DocCount
+	}
+	for _, bucket := range ratingBuckets {
+		result.Rating = append(result.Rating, hotels.FacetCount{Value: bucket.name, Count: ratings[bucket.name]})
+	}
+	return result
+}
+
+// parseElasticsearchCollation replaces the misspelled words of the text with their best
+// suggestion, empty when every word is known
+func parseElasticsearchCollation(text string, resp elasticsearchSearchResponse) string {
+	text = strings.TrimSpace(text)
+	var collation strings.Builder
+	position, corrected := 0, false
+	for _, entry := range resp.Suggest["spelling"] {
+		if len(entry.Options) == 0 || entry.Offset < position || entry.Offset+entry.Length > len(text) {
+			continue
+		}
+		collation.WriteString(text[position:entry.Offset])
+		collation.WriteString(entry.Options[0].Text)
+		position = entry.Offset + entry.Length
+		corrected = true
+	}
+	if !corrected {
+		return ""
+	}
+	collation.WriteString(text[position:])
+	return collation.String()
+}
+
+// buildElasticsearchSort translates the query sort like buildSort, using the ID as tiebreaker
+func buildElasticsearchSort(query hotels.Query) []interface{} {
+	byID := map[string]interface{}{"id": "asc"}
+	switch query.Sort {
+	case hotels.SortDistance:
+		return []interface{}{
+			map[string]interface{}{
+				"_geo_distance": map[string]interface{}{
+					"location": elasticsearchLocation{Lat: query.Latitude, Lon: query.Longitude},
+					"order":    "asc",
+					"unit":     "km",
+				},
+			},
+			byID,
+		}
+	case hotels.SortRating:
+		return []interface{}{map[string]interface{}{"rating": "desc"}, map[string]interface{}{"_score": "desc"}, byID}
+	case hotels.SortName:
+		return []interface{}{map[string]interface{}{"name.sort": "asc"}, byID}
+	default:
+		return []interface{}{map[string]interface{}{"_score": "desc"}, byID}
+	}
+}
+
+// elasticsearchPhrase matches the words of the value in a row, like the quoted Solr filters
+func elasticsearchPhrase(field string, value string) map[string]interface{} {
+	return map[string]interface{}{"match_phrase": map[string]interface{}{field: value}}
+}
+
+// elasticsearchNotDeleted leaves the tombstones of deleted hotels out
+func elasticsearchNotDeleted() map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": map[string]interface{}{"term": map[string]interface{}{"deleted": true}},
+		},
+	}
+}
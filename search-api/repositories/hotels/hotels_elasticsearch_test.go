@@ -0,0 +1,331 @@
+package hotels_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	hotelsDAO "search-api/dao/hotels"
+	repositories "search-api/repositories/hotels"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedRequest is a request received by the stand-in
+type recordedRequest struct {
+	Method string
+	Path   string // Path along with the query string
+	Body   string
+}
+
+// standIn plays the search engine REST API, answering with respond and recording the requests
+type standIn struct {
+	mutex    sync.Mutex
+	requests []recordedRequest
+	respond  func(method string, path string) (int, string)
+}
+
+func (stand *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := r.URL.Path
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+
+	stand.mutex.Lock()
+	stand.requests = append(stand.requests, recordedRequest{Method: r.Method, Path: path, Body: string(body)})
+	stand.mutex.Unlock()
+
+	status, response := http.StatusOK, `{}`
+	if stand.respond != nil {
+		status, response = stand.respond(r.Method, path)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(response))
+}
+
+// newStandIn starts a stand-in whose hotels alias already exists, and a client pointed to it
+func newStandIn(t *testing.T) (*standIn, repositories.Elasticsearch) {
+	stand := &standIn{}
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	searchEngine := repositories.NewElasticsearch(repositories.ElasticsearchConfig{
+		Host:     parsed.Hostname(),
+		Port:     parsed.Port(),
+		Index:    "hotels",
+		Profiles: testProfiles,
+	})
+	stand.requests = nil
+	return stand, searchEngine
+}
+
+// decode unmarshals a recorded JSON body
+func decode(t *testing.T, body string) map[string]interface{} {
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &value))
+	return value
+}
+
+// lookup follows the keys, or indexes for arrays, down a decoded JSON value
+func lookup(t *testing.T, value interface{}, keys ...interface{}) interface{} {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			require.True(t, ok, "expected an object at %v", k)
+			value = object[k]
+		case int:
+			array, ok := value.([]interface{})
+			require.True(t, ok, "expected an array at %v", k)
+			require.Less(t, k, len(array))
+			value = array[k]
+		}
+	}
+	return value
+}
+
+func TestElasticsearch_CreatesIndex(t *testing.T) {
+	stand := &standIn{respond: func(method string, path string) (int, string) {
+		if method == http.MethodHead {
+			return http.StatusNotFound, ``
+		}
+		return http.StatusOK, `{"acknowledged":true}`
+	}}
+	server := httptest.NewServer(stand)
+	defer server.Close()
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	repositories.NewElasticsearch(repositories.ElasticsearchConfig{
+		Host:  parsed.Hostname(),
+		Port:  parsed.Port(),
+		Index: "hotels",
+	})
+
+	require.Len(t, stand.requests, 3)
+	assert.Equal(t, recordedRequest{Method: http.MethodHead, Path: "/_alias/hotels"}, stand.requests[0])
+
+	create := stand.requests[1]
+	assert.Equal(t, http.MethodPut, create.Method)
+	assert.True(t, strings.HasPrefix(create.Path, "/hotels_"))
+	mapping := decode(t, create.Body)
+	assert.Equal(t, "geo_point", lookup(t, mapping, "mappings", "properties", "location", "type"))
+	assert.Equal(t, "keyword", lookup(t, mapping, "mappings", "properties", "city", "fields", "facet", "type"))
+
+	assert.Equal(t, http.MethodPut, stand.requests[2].Method)
+	assert.Equal(t, create.Path+"/_alias/hotels", stand.requests[2].Path)
+}
+
+func TestElasticsearch_Writes(t *testing.T) {
+	ctx := context.Background()
+	stand, searchEngine := newStandIn(t)
+	stand.respond = func(method string, path string) (int, string) {
+		switch {
+		case method == http.MethodGet && strings.HasPrefix(path, "/hotels/_doc/h1"):
+			return http.StatusOK, `{"_id":"h1","found":true,"_source":{"version":3}}`
+		case method == http.MethodGet:
+			return http.StatusNotFound, `{"_id":"missing","found":false}`
+		}
+		return http.StatusOK, `{"result":"created"}`
+	}
+
+	_, err := searchEngine.Index(ctx, testHotels[0])
+	require.NoError(t, err)
+	require.NoError(t, searchEngine.Delete(ctx, "h2", 4))
+
+	require.Len(t, stand.requests, 2)
+	assert.Equal(t, "/hotels/_doc/h1?refresh=wait_for", stand.requests[0].Path)
+	assert.JSONEq(t, `{
+		"id": "h1", "name": "Grand Plaza Hotel", "address": "1 Main Street", "city": "New York",
+		"state": "NY", "rating": 4.5, "amenities": ["wifi", "pool"],
+		"location": {"lat": 40.7128, "lon": -74.006}, "version": 1, "deleted": false
+	}`, stand.requests[0].Body)
+	assert.Equal(t, "/hotels/_doc/h2?refresh=wait_for", stand.requests[1].Path)
+	assert.JSONEq(t, `{"id": "h2", "rating": 0, "version": 4, "deleted": true}`, stand.requests[1].Body)
+
+	version, found, err := searchEngine.GetVersion(ctx, "h1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(3), version)
+
+	_, found, err = searchEngine.GetVersion(ctx, "missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	stand.respond = func(method string, path string) (int, string) {
+		return http.StatusServiceUnavailable, `{"error":"unavailable"}`
+	}
+	_, err = searchEngine.Index(ctx, testHotels[0])
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestElasticsearch_Search(t *testing.T) {
+	ctx := context.Background()
+	stand, searchEngine := newStandIn(t)
+	stand.respond = func(method string, path string) (int, string) {
+		return http.StatusOK, `{
+			"hits": {
+				"total": {"value": 1},
+				"hits": [{
+					"_source": {"id": "h1", "name": "Grand Plaza Hotel", "city": "New York", "rating": 4.5,
+						"amenities": ["wifi"], "location": {"lat": 40.7128, "lon": -74.006}, "version": 2},
+					"fields": {"distance": [1.5]},
+					"highlight": {"name": ["Grand <em>Plaza</em> Hotel"]}
+				}]
+			},
+			"aggregations": {
+				"city": {"doc_count": 2, "values": {"buckets": [{"key": "New York", "doc_count": 1}, {"key": "Miami", "doc_count": 1}]}},
+				"state": {"doc_count": 1, "values": {"buckets": [{"key": "NY", "doc_count": 1}]}},
+				"amenities": {"doc_count": 1, "values": {"buckets": [{"key": "wifi", "doc_count": 1}]}},
+				"rating": {"doc_count": 1, "values": {"buckets": [{"key": "4-5", "from": 4, "doc_count": 1}, {"key": "0-2", "to": 2, "doc_count": 0}]}}
+			},
+			"suggest": {
+				"spelling": [
+					{"text": "plaaza", "offset": 0, "length": 6, "options": [{"text": "plaza", "score": 0.8, "freq": 2}]},
+					{"text": "hotel", "offset": 7, "length": 5, "options": []}
+				]
+			}
+		}`
+	}
+
+	result, err := searchEngine.Search(ctx, hotelsDAO.Query{
+		Text:      "plaaza hotel",
+		Mode:      hotelsDAO.ModeSimple,
+		Profile:   "default",
+		City:      "New York",
+		State:     "NY",
+		Latitude:  40.7,
+		Longitude: -74,
+		Geo:       true,
+		Sort:      hotelsDAO.SortDistance,
+		Offset:    10,
+		Limit:     5,
+	})
+	require.NoError(t, err)
+
+	// Request
+	require.Len(t, stand.requests, 1)
+	assert.Equal(t, "/hotels/_search", stand.requests[0].Path)
+	body := decode(t, stand.requests[0].Body)
+	assert.Equal(t, float64(10), body["from"])
+	assert.Equal(t, float64(5), body["size"])
+	match := lookup(t, body, "query", "bool", "must", "bool", "must", "multi_match")
+	assert.Equal(t, "plaaza hotel", lookup(t, match, "query"))
+	assert.Equal(t, []interface{}{"name^3", "city^2", "state^1", "address^1", "amenities^1"}, lookup(t, match, "fields"))
+	assert.Equal(t, "100%", lookup(t, match, "minimum_should_match"))
+	assert.Equal(t, float64(5), lookup(t, body, "query", "bool", "must", "bool", "should", 0, "match_phrase", "name", "boost"))
+	assert.Equal(t, true, lookup(t, body, "query", "bool", "filter", 0, "bool", "must_not", "term", "deleted"))
+
+	// Every faceted filter is a post filter, and each facet leaves its own out
+	assert.Equal(t, "New York", lookup(t, body, "post_filter", "bool", "filter", 0, "match_phrase", "city"))
+	assert.Equal(t, "NY", lookup(t, body, "post_filter", "bool", "filter", 1, "match_phrase", "state"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"match_phrase": map[string]interface{}{"state": "NY"}}},
+		lookup(t, body, "aggs", "city", "filter", "bool", "filter"))
+	assert.Equal(t, "city.facet", lookup(t, body, "aggs", "city", "aggs", "values", "terms", "field"))
+
+	assert.Equal(t, "asc", lookup(t, body, "sort", 0, "_geo_distance", "order"))
+	assert.Equal(t, "asc", lookup(t, body, "sort", 1, "id"))
+	assert.Equal(t, 40.7, lookup(t, body, "script_fields", "distance", "script", "params", "lat"))
+	assert.Equal(t, "<em>", lookup(t, body, "highlight", "pre_tags", 0))
+	assert.Equal(t, "spell", lookup(t, body, "suggest", "spelling", "term", "field"))
+
+	// Response
+	assert.Equal(t, 1, result.Total)
+	require.Len(t, result.Hotels, 1)
+	hotel := result.Hotels[0]
+	assert.Equal(t, "Grand Plaza Hotel", hotel.Name)
+	assert.Equal(t, int64(2), hotel.Version)
+	assert.Equal(t, 40.7128, hotel.Latitude)
+	require.NotNil(t, hotel.Distance)
+	assert.Equal(t, 1.5, *hotel.Distance)
+	assert.Equal(t, map[string][]string{"name": {"Grand <em>Plaza</em> Hotel"}}, hotel.Highlights)
+	assert.Equal(t, []hotelsDAO.FacetCount{{Value: "New York", Count: 1}, {Value: "Miami", Count: 1}}, result.Facets.City)
+	assert.Equal(t, []hotelsDAO.FacetCount{
+		{Value: "4-5", Count: 1},
+		{Value: "3-4", Count: 0},
+		{Value: "2-3", Count: 0},
+		{Value: "0-2", Count: 0},
+	}, result.Facets.Rating)
+	assert.Equal(t, "plaza hotel", result.Collation)
+}
+
+func TestElasticsearch_AdvancedSearch(t *testing.T) {
+	stand, searchEngine := newStandIn(t)
+
+	_, err := searchEngine.Search(context.Background(), hotelsDAO.Query{
+		Text:      "name:plaza AND amenities:pool",
+		Mode:      hotelsDAO.ModeAdvanced,
+		Profile:   "default",
+		Amenities: []string{"wifi", "gym"},
+		Sort:      hotelsDAO.SortRating,
+		Limit:     10,
+	})
+	require.NoError(t, err)
+
+	body := decode(t, stand.requests[0].Body)
+	assert.Equal(t, "name", lookup(t, body, "query", "bool", "must", "query_string", "default_field"))
+	assert.Equal(t, "name:plaza AND amenities:pool", lookup(t, body, "query", "bool", "must", "query_string", "query"))
+	assert.Len(t, lookup(t, body, "post_filter", "bool", "filter"), 2)
+	assert.Equal(t, "desc", lookup(t, body, "sort", 0, "rating"))
+	assert.Nil(t, body["suggest"])
+	assert.Nil(t, body["script_fields"])
+
+	_, err = searchEngine.Search(context.Background(), hotelsDAO.Query{Profile: "missing", Limit: 10})
+	assert.ErrorIs(t, err, hotelsDAO.ErrUnknownProfile)
+}
+
+func TestElasticsearch_Rebuild(t *testing.T) {
+	ctx := context.Background()
+	stand, searchEngine := newStandIn(t)
+	stand.respond = func(method string, path string) (int, string) {
+		switch {
+		case strings.HasSuffix(path, "/_bulk"):
+			return http.StatusOK, `{"errors":false,"items":[{"index":{"_id":"h1","status":201}},{"index":{"_id":"h2","status":201}}]}`
+		case method == http.MethodGet && path == "/_alias/hotels":
+			return http.StatusOK, `{"hotels_1":{"aliases":{"hotels":{}}}}`
+		}
+		return http.StatusOK, `{"acknowledged":true}`
+	}
+
+	require.NoError(t, searchEngine.IndexInto(ctx, "hotels_2", testHotels[:2]))
+	require.NoError(t, searchEngine.SwapCollection(ctx, "hotels_2"))
+
+	require.Len(t, stand.requests, 5)
+	bulk := stand.requests[0]
+	assert.Equal(t, "/hotels_2/_bulk", bulk.Path)
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(bulk.Body))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 4)
+	assert.JSONEq(t, `{"index":{"_id":"h1"}}`, lines[0])
+	assert.Equal(t, "Grand Plaza Hotel", decode(t, lines[1])["name"])
+	assert.JSONEq(t, `{"index":{"_id":"h2"}}`, lines[2])
+
+	assert.Equal(t, recordedRequest{Method: http.MethodPost, Path: "/hotels_2/_refresh"}, stand.requests[1])
+	assert.Equal(t, recordedRequest{Method: http.MethodGet, Path: "/_alias/hotels"}, stand.requests[2])
+	assert.Equal(t, "/_aliases", stand.requests[3].Path)
+	assert.JSONEq(t, `{"actions":[
+		{"remove":{"index":"hotels_1","alias":"hotels"}},
+		{"add":{"index":"hotels_2","alias":"hotels"}}
+	]}`, stand.requests[3].Body)
+	assert.Equal(t, recordedRequest{Method: http.MethodDelete, Path: "/hotels_1"}, stand.requests[4])
+
+	// A bulk request is accepted even when some of its documents are rejected
+	stand.respond = func(method string, path string) (int, string) {
+		return http.StatusOK, `{"errors":true,"items":[{"index":{"_id":"h1","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`
+	}
+	err := searchEngine.IndexInto(ctx, "hotels_3", testHotels[:1])
+	assert.ErrorContains(t, err, "mapper_parsing_exception")
+}
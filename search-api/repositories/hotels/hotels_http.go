@@ -10,19 +10,32 @@ import (
 )
 
 type HTTPConfig struct {
-	Host string
-	Port string
+	Host  string
+	Port  string
+	Token string // Service token, required by the reservations export
 }
 
 type HTTP struct {
-	baseURL func(hotelID string) string
+	exportURL      string
+	roomsExportURL string
+	staysExportURL string
+	token          string
+	baseURL        func(hotelID string) string
+	roomURL        func(hotelID string, roomID string) string
 }
 
 func NewHTTP(config HTTPConfig) HTTP {
 	return HTTP{
+		exportURL:      fmt.Sprintf("http://%s:%s/hotels/export", config.Host, config.Port),
+		roomsExportURL: fmt.Sprintf("http://%s:%s/rooms/export", config.Host, config.Port),
+		staysExportURL: fmt.Sprintf("http://%s:%s/reservations/export", config.Host, config.Port),
+		token:          config.Token,
 		baseURL: func(hotelID string) string {
 			return fmt.Sprintf("http://%s:%s/hotels/%s", config.Host, config.Port, hotelID)
 		},
+		roomURL: func(hotelID string, roomID string) string {
+			return fmt.Sprintf("http://%s:%s/hotels/%s/rooms/%s", config.Host, config.Port, hotelID, roomID)
+		},
 	}
 }
 
@@ -51,3 +64,99 @@ func (repository HTTP) GetHotelByID(ctx context.Context, id string) (hotelsDomai
 
 	return hotel, nil
 }
+
+func (repository HTTP) GetRoomByID(ctx context.Context, hotelID string, roomID string) (hotelsDomain.Room, error) {
+	resp, err := http.Get(repository.roomURL(hotelID, roomID))
+	if err != nil {
+		return hotelsDomain.Room{}, fmt.Errorf("Error fetching room (%s): %w\n", roomID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return hotelsDomain.Room{}, fmt.Errorf("Failed to fetch room (%s): received status code %d\n", roomID, resp.StatusCode)
+	}
+
+	// Unmarshal the room details into the room struct
+	var room hotelsDomain.Room
+	if err := json.NewDecoder(resp.Body).Decode(&room); err != nil {
+		return hotelsDomain.Room{}, fmt.Errorf("Error unmarshaling room data (%s): %w\n", roomID, err)
+	}
+
+	return room, nil
+}
+
+// exportError is the last line of an export that failed halfway, holding only the error
+type exportError struct {
+	Error string `json:"error"`
+}
+
+// ExportHotels streams every hotel from the hotels API, calling fn with each one
+func (repository HTTP) ExportHotels(ctx context.Context, fn func(hotel hotelsDomain.Hotel) error) error {
+	return repository.export(ctx, repository.exportURL, "hotels", func(line json.RawMessage) error {
+		var hotel hotelsDomain.Hotel
+		if err := json.Unmarshal(line, &hotel); err != nil {
+			return fmt.Errorf("error decoding hotel: %w", err)
+		}
+		return fn(hotel)
+	})
+}
+
+// ExportRooms streams every room from the hotels API, calling fn with each one
+func (repository HTTP) ExportRooms(ctx context.Context, fn func(room hotelsDomain.Room) error) error {
+	return repository.export(ctx, repository.roomsExportURL, "rooms", func(line json.RawMessage) error {
+		var room hotelsDomain.Room
+		if err := json.Unmarshal(line, &room); err != nil {
+			return fmt.Errorf("error decoding room: %w", err)
+		}
+		return fn(room)
+	})
+}
+
+// ExportStays streams the stay of every confirmed reservation that hasn't checked out yet
+// from the hotels API, calling fn with each one
+func (repository HTTP) ExportStays(ctx context.Context, fn func(stay hotelsDomain.Stay) error) error {
+	return repository.export(ctx, repository.staysExportURL, "reservations", func(line json.RawMessage) error {
+		var stay hotelsDomain.Stay
+		if err := json.Unmarshal(line, &stay); err != nil {
+			return fmt.Errorf("error decoding stay: %w", err)
+		}
+		return fn(stay)
+	})
+}
+
+// export streams a newline delimited JSON export of the hotels API, calling fn with each line
+func (repository HTTP) export(ctx context.Context, url string, name string, fn func(line json.RawMessage) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating %s export request: %w", name, err)
+	}
+	if repository.token != "" {
+		req.Header.Set("Authorization", "Bearer "+repository.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s export: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s export: received status code %d", name, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line json.RawMessage
+		if err := decoder.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error decoding %s export: %w", name, err)
+		}
+		var failure exportError
+		if err := json.Unmarshal(line, &failure); err == nil && failure.Error != "" {
+			return fmt.Errorf("%s export failed: %s", name, failure.Error)
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,788 @@
+package hotels
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"search-api/dao/hotels"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// earthRadiusKm is the mean radius Solr uses for geodist
+	earthRadiusKm = 6371.0087714
+
+	highlightPre  = "<em>"
+	highlightPost = "</em>"
+)
+
+// highlightFields are the fields highlighted in the results, as in the /query handler
+var highlightFields = []string{"name", "address", "city", "state", "amenities"}
+
+type MemoryConfig struct {
+	Collection string                    // Name of the live collection
+	Profiles   map[string]RankingProfile // Ranking profiles for simple queries, by name
+}
+
+// Memory is an in-process search engine for local development and tests. It follows the
+// Solr collection: text fields are split into lowercase words, the city, state and amenities
+// filters match whole phrases and deleted hotels are kept as tombstones. Profile boost
+// functions and spellchecking aren't supported, advanced queries support terms, field:term,
+// quoted phrases, trailing wildcards and the +, -, AND and NOT operators
+type Memory struct {
+	mutex       *sync.RWMutex
+	collection  string
+	collections map[string]map[string]memoryDocument
+	profiles    map[string]RankingProfile
+}
+
+type memoryDocument struct {
+	hotel   hotels.Hotel
+	deleted bool
+}
+
+// memoryMatch is a hotel matching the query along with its score
+type memoryMatch struct {
+	hotel    hotels.Hotel
+	score    float64
+	distance *float64
+}
+
+func NewMemory(config MemoryConfig) Memory {
+	return Memory{
+		mutex:       &sync.RWMutex{},
+		collection:  config.Collection,
+		collections: map[string]map[string]memoryDocument{config.Collection: make(map[string]memoryDocument)},
+		profiles:    config.Profiles,
+	}
+}
+
+func (repository Memory) Index(ctx context.Context, hotel hotels.Hotel) (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.collections[repository.collection][hotel.ID] = memoryDocument{hotel: hotel}
+	return hotel.ID, nil
+}
+
+func (repository Memory) Update(ctx context.Context, hotel hotels.Hotel) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.collections[repository.collection][hotel.ID] = memoryDocument{hotel: hotel}
+	return nil
+}
+
+// Delete replaces the hotel with a tombstone holding the version of the delete
+func (repository Memory) Delete(ctx context.Context, id string, version int64) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	repository.collections[repository.collection][id] = memoryDocument{
+		hotel:   hotels.Hotel{ID: id, Version: version},
+		deleted: true,
+	}
+	return nil
+}
+
+func (repository Memory) GetVersion(ctx context.Context, id string) (int64, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+	doc, ok := repository.collections[repository.collection][id]
+	if !ok {
+		return 0, false, nil
+	}
+	return doc.hotel.Version, true, nil
+}
+
+// ScanVersions calls fn with the version of every hotel by ID, tombstones included
+func (repository Memory) ScanVersions(ctx context.Context, fn func(version hotels.IndexedVersion) error) error {
+	// Copy the versions first, fn may write to the repository
+	repository.mutex.RLock()
+	versions := make([]hotels.IndexedVersion, 0, len(repository.collections[repository.collection]))
+	for id, doc := range repository.collections[repository.collection] {
+		versions = append(versions, hotels.IndexedVersion{
+			ID:      id,
+			Version: doc.hotel.Version,
+			Deleted: doc.deleted,
+		})
+	}
+	repository.mutex.RUnlock()
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID < versions[j].ID
+	})
+	for _, version := range versions {
+		if err := fn(version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository Memory) CreateCollection(ctx context.Context) (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	name := fmt.Sprintf("%s_%d", repository.collection, time.Now().UnixNano())
+	repository.collections[name] = make(map[string]memoryDocument)
+	return name, nil
+}
+
+func (repository Memory) IndexInto(ctx context.Context, collection string, hotelsList []hotels.Hotel) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	docs, ok := repository.collections[collection]
+	if !ok {
+		return fmt.Errorf("collection %s not found", collection)
+	}
+	for _, hotel := range hotelsList {
+		docs[hotel.ID] = memoryDocument{hotel: hotel}
+	}
+	return nil
+}
+
+// SwapCollection makes the rebuilt collection the live one and drops the previous one
+func (repository Memory) SwapCollection(ctx context.Context, collection string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	docs, ok := repository.collections[collection]
+	if !ok {
+		return fmt.Errorf("collection %s not found", collection)
+	}
+	repository.collections[repository.collection] = docs
+	delete(repository.collections, collection)
+	return nil
+}
+
+func (repository Memory) DropCollection(ctx context.Context, collection string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	delete(repository.collections, collection)
+	return nil
+}
+
+func (repository Memory) Search(ctx context.Context, query hotels.Query) (hotels.SearchResult, error) {
+	profile, ok := repository.profiles[query.Profile]
+	if !ok {
+		return hotels.SearchResult{}, fmt.Errorf("%w: %s", hotels.ErrUnknownProfile, query.Profile)
+	}
+	matcher := newMemoryMatcher(query, profile)
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	// Each facet counts the hotels failing no filter but its own, as the tagged Solr facets do
+	matches := make([]memoryMatch, 0)
+	facets := newMemoryFacets()
+	for _, doc := range repository.collections[repository.collection] {
+		if doc.deleted {
+			continue
+		}
+		score, ok := matcher.match(doc.hotel)
+		if !ok {
+			continue
+		}
+		failed := failedFilters(query, doc.hotel)
+		facets.count(doc.hotel, failed)
+		if len(failed) > 0 {
+			continue
+		}
+		match := memoryMatch{hotel: doc.hotel, score: score}
+		if query.Geo && hasLocation(doc.hotel) {
+			distance := haversine(query.Latitude, query.Longitude, doc.hotel.Latitude, doc.hotel.Longitude)
+			match.distance = &distance
+		}
+		matches = append(matches, match)
+	}
+	sortMatches(matches, query)
+
+	// Apply offset and limit
+	start := min(query.Offset, len(matches))
+	end := min(start+query.Limit, len(matches))
+	hotelsList := make([]hotels.Hotel, 0, end-start)
+	for _, match := range matches[start:end] {
+		hotel := match.hotel
+		if query.Geo {
+			hotel.Distance = match.distance
+		}
+		hotel.Highlights = highlight(hotel, matcher.terms)
+		hotelsList = append(hotelsList, hotel)
+	}
+
+	return hotels.SearchResult{
+		Hotels: hotelsList,
+		Total:  len(matches),
+		Facets: facets.result(),
+	}, nil
+}
+
+// BuildSuggestions does nothing, the suggestions are computed on every request
+func (repository Memory) BuildSuggestions(ctx context.Context) error {
+	return nil
+}
+
+// Suggest completes the words of the hotel names and cities, every word but the last must
+// match a whole word like Solr's infix suggester does
+func (repository Memory) Suggest(ctx context.Context, prefix string, limit int) ([]hotels.Suggestion, error) {
+	words := tokenize(prefix)
+	if len(words) == 0 {
+		return make([]hotels.Suggestion, 0), nil
+	}
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	suggestions := make([]hotels.Suggestion, 0)
+	seen := make(map[string]bool)
+	for _, doc := range repository.collections[repository.collection] {
+		if doc.deleted {
+			continue
+		}
+		for suggestionType, text := range map[string]string{
+			hotels.SuggestionName: doc.hotel.Name,
+			hotels.SuggestionCity: doc.hotel.City,
+		} {
+			key := suggestionType + ":" + strings.ToLower(text)
+			if seen[key] || !completes(tokenize(text), words) {
+				continue
+			}
+			seen[key] = true
+			suggestions = append(suggestions, hotels.Suggestion{
+				Text:   text,
+				Type:   suggestionType,
+				Weight: int(doc.hotel.Rating),
+			})
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Weight != suggestions[j].Weight {
+			return suggestions[i].Weight > suggestions[j].Weight
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// completes tells whether the words of a field complete the typed words
+func completes(fieldWords []string, words []string) bool {
+	for i, word := range words {
+		found := false
+		for _, fieldWord := range fieldWords {
+			if fieldWord == word || (i == len(words)-1 && strings.HasPrefix(fieldWord, word)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryClause is a part of the query matched against the hotel fields
+type memoryClause struct {
+	fields     []FieldBoost // Fields searched, with their weights
+	words      []string     // Words matched as a phrase
+	prefix     bool         // Whether the last word is a prefix
+	required   bool
+	prohibited bool
+}
+
+// memoryMatcher scores the hotels against the query text
+type memoryMatcher struct {
+	all          bool // No text, every hotel matches
+	clauses      []memoryClause
+	phraseFields []FieldBoost
+	phrase       []string
+	minimumMatch int
+	terms        map[string]bool // Words to highlight
+}
+
+func newMemoryMatcher(query hotels.Query, profile RankingProfile) memoryMatcher {
+	text := strings.TrimSpace(query.Text)
+	if text == "" {
+		return memoryMatcher{all: true}
+	}
+	if query.Mode == hotels.ModeAdvanced {
+		return parseAdvancedQuery(text)
+	}
+
+	// Every word is searched over the profile fields, like edismax does
+	words := tokenize(text)
+	matcher := memoryMatcher{
+		clauses:      make([]memoryClause, 0, len(words)),
+		phraseFields: profile.PhraseFields,
+		phrase:       words,
+		minimumMatch: minimumMatch(profile.MinimumMatch, len(words)),
+		terms:        make(map[string]bool),
+	}
+	for _, word := range words {
+		matcher.clauses = append(matcher.clauses, memoryClause{fields: profile.Fields, words: []string{word}})
+		matcher.terms[word] = true
+	}
+	return matcher
+}
+
+// parseAdvancedQuery parses the supported subset of the Lucene syntax, terms without a field
+// search the name as the Solr query does
+func parseAdvancedQuery(text string) memoryMatcher {
+	matcher := memoryMatcher{
+		clauses:      make([]memoryClause, 0),
+		minimumMatch: 1,
+		terms:        make(map[string]bool),
+	}
+	required, prohibited := false, false
+	for _, token := range splitAdvancedQuery(text) {
+		switch token {
+		case "AND":
+			// Both sides of an AND are required
+			if len(matcher.clauses) > 0 && !matcher.clauses[len(matcher.clauses)-1].prohibited {
+				matcher.clauses[len(matcher.clauses)-1].required = true
+			}
+			required = true
+			continue
+		case "OR":
+			continue
+		case "NOT":
+			prohibited = true
+			continue
+		}
+
+		clause := memoryClause{fields: []FieldBoost{{Field: advancedDefaultField, Boost: 1}}}
+		if strings.HasPrefix(token, "+") {
+			required = true
+			token = token[1:]
+		} else if strings.HasPrefix(token, "-") {
+			prohibited = true
+			token = token[1:]
+		}
+		if field, value, ok := strings.Cut(token, ":"); ok && field != "" {
+			clause.fields = []FieldBoost{{Field: field, Boost: 1}}
+			token = value
+		}
+		token = strings.Trim(token, `"`)
+		if strings.HasSuffix(token, "*") {
+			clause.prefix = true
+			token = strings.TrimSuffix(token, "*")
+		}
+		clause.words = tokenize(token)
+		clause.required, clause.prohibited = required && !prohibited, prohibited
+		required, prohibited = false, false
+		if len(clause.words) == 0 {
+			continue
+		}
+		if !clause.prefix && !clause.prohibited {
+			for _, word := range clause.words {
+				matcher.terms[word] = true
+			}
+		}
+		matcher.clauses = append(matcher.clauses, clause)
+	}
+	return matcher
+}
+
+// splitAdvancedQuery splits a query on the whitespace outside quotes, grouping is flattened
+func splitAdvancedQuery(text string) []string {
+	tokens := make([]string, 0)
+	var token strings.Builder
+	quoted := false
+	for _, char := range text {
+		switch {
+		case char == '"':
+			quoted = !quoted
+			token.WriteRune(char)
+		case !quoted && (unicode.IsSpace(char) || char == '(' || char == ')'):
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(char)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// match scores the hotel, as the sum of the best weighted field of each matching clause
+func (matcher memoryMatcher) match(hotel hotels.Hotel) (float64, bool) {
+	if matcher.all {
+		return 1, true
+	}
+
+	score, matched, optional, required := 0.0, 0, 0, 0
+	for _, clause := range matcher.clauses {
+		clauseScore := 0.0
+		for _, field := range clause.fields {
+			count := 0
+			for _, value := range fieldValues(hotel, field.Field) {
+				count += countPhrase(tokenize(value), clause.words, clause.prefix)
+			}
+			clauseScore = math.Max(clauseScore, float64(count)*field.Boost)
+		}
+		switch {
+		case clause.prohibited:
+			if clauseScore > 0 {
+				return 0, false
+			}
+		case clause.required:
+			if clauseScore == 0 {
+				return 0, false
+			}
+			required++
+		default:
+			optional++
+			if clauseScore > 0 {
+				matched++
+			}
+		}
+		score += clauseScore
+	}
+	switch {
+	case required == 0 && optional == 0:
+		// Only prohibited clauses, they're subtracted from every hotel
+		score = 1
+	case required == 0 && matched < min(matcher.minimumMatch, optional):
+		// Optional clauses only matter when nothing is required
+		return 0, false
+	}
+
+	// Hotels with the whole query as a phrase rank higher
+	if len(matcher.phrase) > 1 {
+		for _, field := range matcher.phraseFields {
+			for _, value := range fieldValues(hotel, field.Field) {
+				if countPhrase(tokenize(value), matcher.phrase, false) > 0 {
+					score += field.Boost
+				}
+			}
+		}
+	}
+	return score, true
+}
+
+// minimumMatch resolves a Solr mm spec, e.g. "2", "75%", "-1" or "3<75%", to how many of
+// the given words must match
+func minimumMatch(spec string, words int) int {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 1
+	}
+
+	value := spec
+	if strings.Contains(spec, "<") {
+		// Conditions apply above their word count, all the words are required below them
+		value = "100%"
+		for _, condition := range strings.Fields(spec) {
+			threshold, conditionValue, ok := strings.Cut(condition, "<")
+			if !ok {
+				continue
+			}
+			var count int
+			if _, err := fmt.Sscanf(threshold, "%d", &count); err == nil && words > count {
+				value = conditionValue
+			}
+		}
+	}
+
+	required := words
+	if strings.HasSuffix(value, "%") {
+		var percent int
+		if _, err := fmt.Sscanf(strings.TrimSuffix(value, "%"), "%d", &percent); err == nil {
+			if percent < 0 {
+				required = words - (words*-percent)/100
+			} else {
+				required = (words * percent) / 100
+			}
+		}
+	} else {
+		var count int
+		if _, err := fmt.Sscanf(value, "%d", &count); err == nil {
+			if count < 0 {
+				required = words + count
+			} else {
+				required = count
+			}
+		}
+	}
+	return max(1, min(required, words))
+}
+
+// countPhrase counts the occurrences of the words in a row, the last one may be a prefix
+func countPhrase(fieldWords []string, words []string, prefix bool) int {
+	count := 0
+	for i := 0; i+len(words) <= len(fieldWords); i++ {
+		found := true
+		for j, word := range words {
+			fieldWord := fieldWords[i+j]
+			if fieldWord != word && !(prefix && j == len(words)-1 && strings.HasPrefix(fieldWord, word)) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+// failedFilters returns the tags of the query filters the hotel doesn't pass
+func failedFilters(query hotels.Query, hotel hotels.Hotel) []string {
+	failed := make([]string, 0)
+	if query.City != "" && !matchesPhrase(hotel.City, query.City) {
+		failed = append(failed, "city")
+	}
+	if query.State != "" && !matchesPhrase(hotel.State, query.State) {
+		failed = append(failed, "state")
+	}
+	if len(query.Amenities) > 0 {
+		matched := 0
+		for _, amenity := range query.Amenities {
+			for _, value := range hotel.Amenities {
+				if matchesPhrase(value, amenity) {
+					matched++
+					break
+				}
+			}
+		}
+		if matched == 0 || (query.AmenitiesMatch != hotels.MatchAny && matched < len(query.Amenities)) {
+			failed = append(failed, "amenities")
+		}
+	}
+	if (query.MinRating > 0 && hotel.Rating < query.MinRating) || (query.MaxRating > 0 && hotel.Rating > query.MaxRating) {
+		failed = append(failed, "rating")
+	}
+	if query.HotelIDs != nil && !contains(query.HotelIDs, hotel.ID) {
+		failed = append(failed, "id")
+	}
+	if query.Geo && query.RadiusKm > 0 {
+		if !hasLocation(hotel) || haversine(query.Latitude, query.Longitude, hotel.Latitude, hotel.Longitude) > query.RadiusKm {
+			failed = append(failed, "location")
+		}
+	}
+	return failed
+}
+
+// matchesPhrase tells whether the words of the value appear in a row in the field
+func matchesPhrase(field string, value string) bool {
+	words := tokenize(value)
+	return len(words) > 0 && countPhrase(tokenize(field), words, false) > 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryFacets counts the facet values of the hotels
+type memoryFacets struct {
+	city      map[string]int
+	state     map[string]int
+	amenities map[string]int
+	rating    []int
+}
+
+func newMemoryFacets() memoryFacets {
+	return memoryFacets{
+		city:      make(map[string]int),
+		state:     make(map[string]int),
+		amenities: make(map[string]int),
+		rating:    make([]int, len(ratingBuckets)),
+	}
+}
+
+// count adds the hotel to the facets whose own filter is the only one it fails, if any
+func (facets memoryFacets) count(hotel hotels.Hotel, failed []string) {
+	if onlyFails(failed, "city") && hotel.City != "" {
+		facets.city[hotel.City]++
+	}
+	if onlyFails(failed, "state") && hotel.State != "" {
+		facets.state[hotel.State]++
+	}
+	if onlyFails(failed, "amenities") {
+		seen := make(map[string]bool)
+		for _, amenity := range hotel.Amenities {
+			if amenity != "" && !seen[amenity] {
+				seen[amenity] = true
+				facets.amenities[amenity]++
+			}
+		}
+	}
+	if onlyFails(failed, "rating") {
+		for i, bucket := range ratingBuckets {
+			if hotel.Rating >= bucket.min && hotel.Rating < bucket.max {
+				facets.rating[i]++
+			}
+		}
+	}
+}
+
+func onlyFails(failed []string, tag string) bool {
+	return len(failed) == 0 || (len(failed) == 1 && failed[0] == tag)
+}
+
+func (facets memoryFacets) result() hotels.Facets {
+	result := hotels.Facets{
+		City:      sortFacetCounts(facets.city),
+		State:     sortFacetCounts(facets.state),
+		Amenities: sortFacetCounts(facets.amenities),
+		Rating:    make([]hotels.FacetCount, 0, len(ratingBuckets)),
+	}
+	for i, bucket := range ratingBuckets {
+		result.Rating = append(result.Rating, hotels.FacetCount{Value: bucket.name, Count: facets.rating[i]})
+	}
+	return result
+}
+
+// sortFacetCounts sorts the values by count and then value, keeping the top ones like Solr
+func sortFacetCounts(counts map[string]int) []hotels.FacetCount {
+	result := make([]hotels.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, hotels.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > facetLimit {
+		result = result[:facetLimit]
+	}
+	return result
+}
+
+// sortMatches sorts the hotels like buildSort, using the ID as tiebreaker
+func sortMatches(matches []memoryMatch, query hotels.Query) {
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch query.Sort {
+		case hotels.SortDistance:
+			// Hotels without a location go last
+			if (a.distance == nil) != (b.distance == nil) {
+				return a.distance != nil
+			}
+			if a.distance != nil && *a.distance != *b.distance {
+				return *a.distance < *b.distance
+			}
+		case hotels.SortRating:
+			if a.hotel.Rating != b.hotel.Rating {
+				return a.hotel.Rating > b.hotel.Rating
+			}
+			if a.score != b.score {
+				return a.score > b.score
+			}
+		case hotels.SortName:
+			if a.hotel.Name != b.hotel.Name {
+				return a.hotel.Name < b.hotel.Name
+			}
+		default:
+			if a.score != b.score {
+				return a.score > b.score
+			}
+		}
+		return a.hotel.ID < b.hotel.ID
+	})
+}
+
+// highlight wraps the query words found in each field, fields without any are left out
+func highlight(hotel hotels.Hotel, terms map[string]bool) map[string][]string {
+	if len(terms) == 0 {
+		return nil
+	}
+	highlights := make(map[string][]string)
+	for _, field := range highlightFields {
+		for _, value := range fieldValues(hotel, field) {
+			if snippet, ok := highlightValue(value, terms); ok {
+				highlights[field] = append(highlights[field], snippet)
+			}
+		}
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
+
+func highlightValue(value string, terms map[string]bool) (string, bool) {
+	var snippet strings.Builder
+	found := false
+	runes := []rune(value)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			snippet.WriteRune(runes[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := string(runes[i:end])
+		if terms[strings.ToLower(word)] {
+			found = true
+			snippet.WriteString(highlightPre + word + highlightPost)
+		} else {
+			snippet.WriteString(word)
+		}
+		i = end
+	}
+	return snippet.String(), found
+}
+
+// fieldValues returns the values of a hotel field by its Solr name
+func fieldValues(hotel hotels.Hotel, field string) []string {
+	switch field {
+	case "id":
+		return []string{hotel.ID}
+	case "name":
+		return []string{hotel.Name}
+	case "address":
+		return []string{hotel.Address}
+	case "city":
+		return []string{hotel.City}
+	case "state":
+		return []string{hotel.State}
+	case "amenities":
+		return hotel.Amenities
+	default:
+		return nil
+	}
+}
+
+// tokenize splits a text into lowercase words, like the text_general field type
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(char rune) bool {
+		return !isWordRune(char)
+	})
+}
+
+func isWordRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char)
+}
+
+// hasLocation tells whether the hotel has a location, formatLocation leaves 0,0 unset
+func hasLocation(hotel hotels.Hotel) bool {
+	return hotel.Latitude != 0 || hotel.Longitude != 0
+}
+
+// haversine returns the great-circle distance in km between two points
+func haversine(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	deltaLatitude := toRadians(latitude2 - latitude1)
+	deltaLongitude := toRadians(longitude2 - longitude1)
+	a := math.Sin(deltaLatitude/2)*math.Sin(deltaLatitude/2) +
+		math.Cos(toRadians(latitude1))*math.Cos(toRadians(latitude2))*math.Sin(deltaLongitude/2)*math.Sin(deltaLongitude/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -6,18 +6,78 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/stevenferrer/solr-go"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
 	"search-api/dao/hotels"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	facetLimit = 20
+
+	// advancedDefaultField is the field matched by the terms of advanced queries without one
+	advancedDefaultField = "name"
+
+	// scanPageSize is how many documents are read per request when scanning the collection
+	scanPageSize = 1000
+
+	// defaultCommitWithin is how soon single writes become searchable when not configured
+	defaultCommitWithin = time.Second
+)
+
+// ratingBuckets are the rating ranges counted in the facets, from min inclusive to max exclusive
+var ratingBuckets = []struct {
+	name  string
+	query string
+	min   float64
+	max   float64
+}{
+	{name: "4-5", query: "rating:[4 TO *]", min: 4, max: math.Inf(1)},
+	{name: "3-4", query: "rating:[3 TO 4}", min: 3, max: 4},
+	{name: "2-3", query: "rating:[2 TO 3}", min: 2, max: 3},
+	{name: "0-2", query: "rating:[* TO 2}", min: math.Inf(-1), max: 2},
+}
+
+// suggesters maps each suggestion type to its dictionary in solrconfig.xml
+var suggesters = map[string]string{
+	hotels.SuggestionName: "nameSuggester",
+	hotels.SuggestionCity: "citySuggester",
+}
+
 type SolrConfig struct {
-	Host       string // Solr host
-	Port       string // Solr port
-	Collection string // Solr collection name
+	Host         string                    // Solr host
+	Port         string                    // Solr port
+	Collection   string                    // Solr collection name
+	ConfigSet    string                    // Solr configset the rebuilt collections are created from
+	Profiles     map[string]RankingProfile // Ranking profiles for simple queries, by name
+	CommitWithin time.Duration             // Solr makes single writes searchable within this time
+}
+
+// RankingProfile is how simple queries are matched and scored
+type RankingProfile struct {
+	Fields       []FieldBoost // Fields matched by the words of the query, with their weights
+	PhraseFields []FieldBoost // Fields boosting the hotels matching the whole query as a phrase
+	MinimumMatch string       // How many of the words must match, in Solr mm syntax
+	Boost        string       // Function multiplying the score, e.g. to favor the best rated
+}
+
+type FieldBoost struct {
+	Field string
+	Boost float64
 }
 
 type Solr struct {
-	Client     *solr.JSONClient
-	Collection string
+	Client       *solr.JSONClient
+	Collection   string
+	ConfigSet    string
+	BaseURL      string
+	Profiles     map[string]RankingProfile
+	CommitWithin time.Duration
 }
 
 // NewSolr initializes a new Solr client
@@ -25,30 +85,28 @@ func NewSolr(config SolrConfig) Solr {
 	// Construct the BaseURL using the provided host and port
 	baseURL := fmt.Sprintf("http://%s:%s", config.Host, config.Port)
 	client := solr.NewJSONClient(baseURL)
+	commitWithin := config.CommitWithin
+	if commitWithin <= 0 {
+		commitWithin = defaultCommitWithin
+	}
 
 	return Solr{
-		Client:     client,
-		Collection: config.Collection,
+		Client:       client,
+		Collection:   config.Collection,
+		ConfigSet:    config.ConfigSet,
+		BaseURL:      baseURL,
+		Profiles:     config.Profiles,
+		CommitWithin: commitWithin,
 	}
 }
 
 // Index adds a new hotel document to the Solr collection
 func (searchEngine Solr) Index(ctx context.Context, hotel hotels.Hotel) (string, error) {
 	// Prepare the document for Solr
-	doc := map[string]interface{}{
-		"id":        hotel.ID,
-		"name":      hotel.Name,
-		"address":   hotel.Address,
-		"city":      hotel.City,
-		"state":     hotel.State,
-		"rating":    hotel.Rating,
-		"amenities": hotel.Amenities,
-	}
+	doc := hotelDocument(hotel)
 
-	// Prepare the index request
-	indexRequest := map[string]interface{}{
-		"add": []interface{}{doc}, // Use "add" with a list of documents
-	}
+	// Prepare the index request, searchable within the commit window
+	indexRequest := searchEngine.addCommand(doc)
 
 	// Index the document in Solr
 	body, err := json.Marshal(indexRequest)
@@ -65,31 +123,16 @@ func (searchEngine Solr) Index(ctx context.Context, hotel hotels.Hotel) (string,
 		return "", fmt.Errorf("failed to index hotel: %v", resp.Error)
 	}
 
-	// Commit the changes
-	if err := searchEngine.Client.Commit(ctx, searchEngine.Collection); err != nil {
-		return "", fmt.Errorf("error committing changes to Solr: %w", err)
-	}
-
 	return hotel.ID, nil
 }
 
 // Update modifies an existing hotel document in the Solr collection
 func (searchEngine Solr) Update(ctx context.Context, hotel hotels.Hotel) error {
 	// Prepare the document for Solr
-	doc := map[string]interface{}{
-		"id":        hotel.ID,
-		"name":      hotel.Name,
-		"address":   hotel.Address,
-		"city":      hotel.City,
-		"state":     hotel.State,
-		"rating":    hotel.Rating,
-		"amenities": hotel.Amenities,
-	}
+	doc := hotelDocument(hotel)
 
-	// Prepare the update request
-	updateRequest := map[string]interface{}{
-		"add": []interface{}{doc}, // Use "add" with a list of documents
-	}
+	// Prepare the update request, searchable within the commit window
+	updateRequest := searchEngine.addCommand(doc)
 
 	// Update the document in Solr
 	body, err := json.Marshal(updateRequest)
@@ -106,21 +149,14 @@ func (searchEngine Solr) Update(ctx context.Context, hotel hotels.Hotel) error {
 		return fmt.Errorf("failed to update hotel: %v", resp.Error)
 	}
 
-	// Commit the changes
-	if err := searchEngine.Client.Commit(ctx, searchEngine.Collection); err != nil {
-		return fmt.Errorf("error committing changes to Solr: %w", err)
-	}
-
 	return nil
 }
 
-func (searchEngine Solr) Delete(ctx context.Context, id string) error {
+// Delete replaces the hotel document with a tombstone holding the version of the delete,
+// tombstones are never returned by searches
+func (searchEngine Solr) Delete(ctx context.Context, id string, version int64) error {
 	// Prepare the delete request
-	docToDelete := map[string]interface{}{
-		"delete": map[string]interface{}{
-			"id": id,
-		},
-	}
+	docToDelete := searchEngine.addCommand(tombstoneDocument(id, version))
 
 	// Update the document in Solr
 	body, err := json.Marshal(docToDelete)
@@ -137,29 +173,67 @@ func (searchEngine Solr) Delete(ctx context.Context, id string) error {
 		return fmt.Errorf("failed to index hotel: %v", resp.Error)
 	}
 
-	// Commit the changes
-	if err := searchEngine.Client.Commit(ctx, searchEngine.Collection); err != nil {
-		return fmt.Errorf("error committing changes to Solr: %w", err)
+	return nil
+}
+
+// addCommand adds a document to be committed within the configured time, a hard commit per
+// document would open a new searcher on every write
+func (searchEngine Solr) addCommand(doc map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"add": map[string]interface{}{
+			"doc":          doc,
+			"commitWithin": searchEngine.CommitWithin.Milliseconds(),
+		},
 	}
+}
 
-	return nil
+// GetVersion returns the indexed version of a hotel, tombstones included, and whether it's indexed at all
+func (searchEngine Solr) GetVersion(ctx context.Context, id string) (int64, bool, error) {
+	solrQuery := solr.NewQuery("*:*").
+		Filters(fmt.Sprintf("{!terms f=id}%s", id)).
+		Fields("id", "version").
+		Limit(1)
+	resp, err := searchEngine.Client.Query(ctx, searchEngine.Collection, solrQuery)
+	if err != nil {
+		return 0, false, fmt.Errorf("error executing version query: %w", err)
+	}
+	if resp.Error != nil {
+		return 0, false, fmt.Errorf("failed to execute version query: %v", resp.Error)
+	}
+	if len(resp.Response.Documents) == 0 {
+		return 0, false, nil
+	}
+	return int64(getFloatField(resp.Response.Documents[0], "version")), true, nil
 }
 
-func (searchEngine Solr) Search(ctx context.Context, query string, limit int, offset int) ([]hotels.Hotel, error) {
+func (searchEngine Solr) Search(ctx context.Context, query hotels.Query) (hotels.SearchResult, error) {
 	// Prepare the Solr query with limit and offset
-	solrQuery := fmt.Sprintf("q=(name:%s)&rows=%d&start=%d", query, limit, offset)
+	profile, ok := searchEngine.Profiles[query.Profile]
+	if !ok {
+		return hotels.SearchResult{}, fmt.Errorf("%w: %s", hotels.ErrUnknownProfile, query.Profile)
+	}
+	solrQuery := solr.NewQuery(buildQuery(query, profile)).
+		Filters(buildFilters(query)...).
+		Sort(buildSort(query)).
+		Offset(query.Offset).
+		Limit(query.Limit).
+		Facets(buildFacets()...)
+	if query.Geo {
+		// Return the distance to the given point along with each hotel
+		solrQuery = solrQuery.Fields("*", "score", fmt.Sprintf("distance:%s", geodist(query)))
+	}
 
-	// Execute the search request
-	resp, err := searchEngine.Client.Query(ctx, searchEngine.Collection, solr.NewQuery(solrQuery))
+	// Execute the search request, highlighting the matches and checking the spelling of the words
+	resp, err := searchEngine.query(ctx, solrQuery, buildTextParams(query))
 	if err != nil {
-		return nil, fmt.Errorf("error executing search query: %w", err)
+		return hotels.SearchResult{}, fmt.Errorf("error executing search query: %w", err)
 	}
 	if resp.Error != nil {
-		return nil, fmt.Errorf("failed to execute search query: %v", resp.Error)
+		return hotels.SearchResult{}, fmt.Errorf("failed to execute search query: %v", resp.Error)
 	}
 
 	// Parse the response and extract hotel documents
-	var hotelsList []hotels.Hotel
+	hotelsList := make([]hotels.Hotel, 0, len(resp.Response.Documents))
 	for _, doc := range resp.Response.Documents {
 		// Initialize amenities slice
 		var amenities []string
@@ -183,10 +257,550 @@ func (searchEngine Solr) Search(ctx context.Context, query string, limit int, of
 			Rating:    getFloatField(doc, "rating"),
 			Amenities: amenities,
 		}
+		hotel.Version = int64(getFloatField(doc, "version"))
+		hotel.Latitude, hotel.Longitude = parseLocation(getStringField(doc, "location"))
+		if distance, ok := doc["distance"].(float64); ok {
+			hotel.Distance = &distance
+		}
+		hotel.Highlights = parseHighlights(resp.Highlighting[hotel.ID])
 		hotelsList = append(hotelsList, hotel)
 	}
 
-	return hotelsList, nil
+	return hotels.SearchResult{
+		Hotels:    hotelsList,
+		Total:     resp.Response.NumFound,
+		Facets:    parseFacets(resp.Facets),
+		Collation: resp.Spellcheck.collation(),
+	}, nil
+}
+
+// searchResponse is a query response along with the highlighting and spellcheck sections,
+// which solr-go doesn't parse
+type searchResponse struct {
+	solr.QueryResponse
+	Highlighting map[string]map[string][]string `json:"highlighting"`
+	Spellcheck   spellcheckResponse             `json:"spellcheck"`
+}
+
+type spellcheckResponse struct {
+	CorrectlySpelled bool          `json:"correctlySpelled"`
+	Collations       []interface{} `json:"collations"`
+}
+
+// collation returns the best corrected query, collations are a flat list of
+// "collation" and query pairs
+func (spellcheck spellcheckResponse) collation() string {
+	if spellcheck.CorrectlySpelled {
+		return ""
+	}
+	for i := 0; i+1 < len(spellcheck.Collations); i += 2 {
+		if name, _ := spellcheck.Collations[i].(string); name != "collation" {
+			continue
+		}
+		if collation, ok := spellcheck.Collations[i+1].(string); ok {
+			return collation
+		}
+	}
+	return ""
+}
+
+// parseHighlights drops the fields without snippets, the unified highlighter lists every
+// requested field
+func parseHighlights(fields map[string][]string) map[string][]string {
+	highlights := make(map[string][]string)
+	for field, snippets := range fields {
+		if len(snippets) > 0 {
+			highlights[field] = snippets
+		}
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
+
+// query runs a JSON request with the given request params, which solr-go's query can't carry
+func (searchEngine Solr) query(ctx context.Context, solrQuery *solr.Query, params solr.M) (searchResponse, error) {
+	request := solrQuery.BuildQuery()
+	if len(params) > 0 {
+		request["params"] = params
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return searchResponse{}, fmt.Errorf("error marshaling query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/solr/%s/query", searchEngine.BaseURL, searchEngine.Collection), bytes.NewReader(body))
+	if err != nil {
+		return searchResponse{}, fmt.Errorf("error creating query request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return searchResponse{}, fmt.Errorf("error sending query: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	// Solr reports query errors in the body, which is decoded whatever the status code
+	var resp searchResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return searchResponse{}, fmt.Errorf("error decoding query response (status code %d): %w", httpResp.StatusCode, err)
+	}
+	if resp.BaseResponse == nil {
+		return searchResponse{}, fmt.Errorf("unexpected query response: received status code %d", httpResp.StatusCode)
+	}
+	return resp, nil
+}
+
+// buildTextParams enables highlighting and spellchecking for queries with text, both are
+// configured in the /query handler in solrconfig.xml. Advanced queries aren't spellchecked,
+// their syntax would be taken for words
+func buildTextParams(query hotels.Query) solr.M {
+	text := strings.TrimSpace(query.Text)
+	if text == "" {
+		return nil
+	}
+	params := solr.M{"hl": true}
+	if query.Mode != hotels.ModeAdvanced {
+		params["spellcheck"] = true
+		params["spellcheck.q"] = text
+	}
+	return params
+}
+
+// Suggest returns the hotel names and cities completing the given prefix, heaviest first
+func (searchEngine Solr) Suggest(ctx context.Context, prefix string, limit int) ([]hotels.Suggestion, error) {
+	// Ask both suggesters at once
+	params := solr.NewSuggesterParams("suggest").
+		Dictionaries(suggesters[hotels.SuggestionName], suggesters[hotels.SuggestionCity]).
+		Query(prefix).
+		Count(limit)
+	resp, err := searchEngine.Client.Suggest(ctx, searchEngine.Collection, params)
+	if err != nil {
+		return nil, fmt.Errorf("error executing suggest query: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to execute suggest query: %v", resp.Error)
+	}
+	if resp.Suggest == nil {
+		return make([]hotels.Suggestion, 0), nil
+	}
+
+	// Merge both dictionaries, many hotels share the same city so duplicates are dropped
+	suggestions := make([]hotels.Suggestion, 0)
+	seen := make(map[string]bool)
+	for suggestionType, dictionary := range suggesters {
+		for _, term := range (*resp.Suggest)[dictionary] {
+			for _, suggestion := range term.Suggestions {
+				key := suggestionType + ":" + strings.ToLower(suggestion.Term)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				suggestions = append(suggestions, hotels.Suggestion{
+					Text:   suggestion.Term,
+					Type:   suggestionType,
+					Weight: suggestion.Weight,
+				})
+			}
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Weight != suggestions[j].Weight {
+			return suggestions[i].Weight > suggestions[j].Weight
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+// ScanVersions calls fn with the version of every document in the collection, tombstones included
+func (searchEngine Solr) ScanVersions(ctx context.Context, fn func(version hotels.IndexedVersion) error) error {
+	for offset := 0; ; offset += scanPageSize {
+		solrQuery := solr.NewQuery("*:*").
+			Fields("id", "version", "deleted").
+			Sort("id asc").
+			Offset(offset).
+			Limit(scanPageSize)
+		resp, err := searchEngine.Client.Query(ctx, searchEngine.Collection, solrQuery)
+		if err != nil {
+			return fmt.Errorf("error executing scan query: %w", err)
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("failed to execute scan query: %v", resp.Error)
+		}
+		for _, doc := range resp.Response.Documents {
+			deleted, _ := doc["deleted"].(bool)
+			if err := fn(hotels.IndexedVersion{
+				ID:      getStringField(doc, "id"),
+				Version: int64(getFloatField(doc, "version")),
+				Deleted: deleted,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(resp.Response.Documents) < scanPageSize {
+			return nil
+		}
+	}
+}
+
+// CreateCollection creates an empty core to rebuild the collection into
+func (searchEngine Solr) CreateCollection(ctx context.Context) (string, error) {
+	name := fmt.Sprintf("%s_%d", searchEngine.Collection, time.Now().UnixNano())
+	if err := searchEngine.Client.CreateCore(ctx, solr.NewCreateCoreParams(name).ConfigSet(searchEngine.ConfigSet)); err != nil {
+		return "", fmt.Errorf("error creating core %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// IndexInto adds a batch of hotels to a collection being rebuilt, they're committed on swap
+func (searchEngine Solr) IndexInto(ctx context.Context, collection string, hotelsList []hotels.Hotel) error {
+	docs := make([]interface{}, 0, len(hotelsList))
+	for _, hotel := range hotelsList {
+		docs = append(docs, hotelDocument(hotel))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"add": docs})
+	if err != nil {
+		return fmt.Errorf("error marshaling hotel documents: %w", err)
+	}
+	resp, err := searchEngine.Client.Update(ctx, collection, solr.JSON, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error indexing hotels: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("failed to index hotels: %v", resp.Error)
+	}
+	return nil
+}
+
+// BuildSuggestions rebuilds the suggester dictionaries from the committed documents, they
+// aren't built on every commit since that would rebuild them about once a second
+func (searchEngine Solr) BuildSuggestions(ctx context.Context) error {
+	params := solr.NewSuggesterParams("suggest").
+		Dictionaries(suggesters[hotels.SuggestionName], suggesters[hotels.SuggestionCity]).
+		Build()
+	resp, err := searchEngine.Client.Suggest(ctx, searchEngine.Collection, params)
+	if err != nil {
+		return fmt.Errorf("error building suggesters: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("failed to build suggesters: %v", resp.Error)
+	}
+	return nil
+}
+
+// SwapCollection commits a rebuilt core and atomically swaps it with the live one, then
+// drops the previous index
+func (searchEngine Solr) SwapCollection(ctx context.Context, collection string) error {
+	if err := searchEngine.Client.Commit(ctx, collection); err != nil {
+		return fmt.Errorf("error committing changes to Solr: %w", err)
+	}
+
+	// solr-go has no SWAP action, so the core admin API is called directly
+	params := url.Values{}
+	params.Set("action", "SWAP")
+	params.Set("core", searchEngine.Collection)
+	params.Set("other", collection)
+	params.Set("wt", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/solr/admin/cores?%s", searchEngine.BaseURL, params.Encode()), nil)
+	if err != nil {
+		return fmt.Errorf("error creating swap request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error swapping cores: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to swap cores: received status code %d: %s", resp.StatusCode, body)
+	}
+
+	// The rebuilt core's name now holds the previous index, whose instance dir may be the
+	// mounted config, so only the index is deleted
+	if err := searchEngine.Client.UnloadCore(ctx, solr.NewCoreParams(collection).DeleteIndex(true).DeleteDataDir(true)); err != nil {
+		return fmt.Errorf("error unloading previous core: %w", err)
+	}
+	return nil
+}
+
+// DropCollection removes a core that was being rebuilt
+func (searchEngine Solr) DropCollection(ctx context.Context, collection string) error {
+	if err := searchEngine.Client.UnloadCore(ctx, solr.NewCoreParams(collection).DeleteInstanceDir(true)); err != nil {
+		return fmt.Errorf("error unloading core %s: %w", collection, err)
+	}
+	return nil
+}
+
+// hotelDocument builds the Solr document of a hotel
+func hotelDocument(hotel hotels.Hotel) map[string]interface{} {
+	doc := map[string]interface{}{
+		"id":        hotel.ID,
+		"name":      hotel.Name,
+		"address":   hotel.Address,
+		"city":      hotel.City,
+		"state":     hotel.State,
+		"rating":    hotel.Rating,
+		"amenities": hotel.Amenities,
+		"version":   hotel.Version,
+		"deleted":   false,
+	}
+	if location := formatLocation(hotel.Latitude, hotel.Longitude); location != "" {
+		doc["location"] = location
+	}
+	return doc
+}
+
+// tombstoneDocument builds the document replacing a deleted hotel
+func tombstoneDocument(id string, version int64) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      id,
+		"version": version,
+		"deleted": true,
+	}
+}
+
+// buildQuery translates the query text to a Solr query. Simple queries escape every special
+// character and go through edismax ranked by the profile, advanced ones are parsed as Lucene
+// syntax as they are. The text is always passed as a quoted local param value, so it can't
+// add other params
+func buildQuery(query hotels.Query, profile RankingProfile) string {
+	text := strings.TrimSpace(query.Text)
+	if text == "" {
+		return "*:*"
+	}
+	if query.Mode == hotels.ModeAdvanced {
+		return localParams("lucene", [][2]string{
+			{"df", advancedDefaultField},
+			{"v", text},
+		})
+	}
+	params := [][2]string{
+		{"qf", formatFieldBoosts(profile.Fields)},
+		{"uf", "-*"}, // No field queries
+	}
+	if len(profile.PhraseFields) > 0 {
+		params = append(params, [2]string{"pf", formatFieldBoosts(profile.PhraseFields)})
+	}
+	if profile.MinimumMatch != "" {
+		params = append(params, [2]string{"mm", profile.MinimumMatch})
+	}
+	if profile.Boost != "" {
+		params = append(params, [2]string{"boost", profile.Boost})
+	}
+	params = append(params, [2]string{"v", escapeQueryChars(text)})
+	return localParams("edismax", params)
+}
+
+// formatFieldBoosts formats fields the way qf and pf expect them, e.g. "name^3 city^2"
+func formatFieldBoosts(fields []FieldBoost) string {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, fmt.Sprintf("%s^%s", field.Field, strconv.FormatFloat(field.Boost, 'f', -1, 64)))
+	}
+	return strings.Join(values, " ")
+}
+
+// localParams builds a {!parser key='value'} query with the values quoted
+func localParams(parser string, params [][2]string) string {
+	values := make([]string, 0, len(params)+1)
+	values = append(values, parser)
+	for _, param := range params {
+		value := strings.ReplaceAll(param[1], `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `\'`)
+		values = append(values, fmt.Sprintf("%s='%s'", param[0], value))
+	}
+	return fmt.Sprintf("{!%s}", strings.Join(values, " "))
+}
+
+// escapeQueryChars escapes the characters with a meaning in the Lucene query syntax, keeping
+// the whitespace that splits the words
+func escapeQueryChars(value string) string {
+	var escaped strings.Builder
+	for _, char := range value {
+		if strings.ContainsRune(`\+-!():^[]"{}~*?|&;/`, char) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(char)
+	}
+	return escaped.String()
+}
+
+// buildFilters translates the query filters to Solr filter queries
+func buildFilters(query hotels.Query) []string {
+	// Tombstones of deleted hotels are never returned
+	filters := []string{"-deleted:true"}
+	if query.City != "" {
+		filters = append(filters, fmt.Sprintf("{!tag=city}city:%s", quote(query.City)))
+	}
+	if query.State != "" {
+		filters = append(filters, fmt.Sprintf("{!tag=state}state:%s", quote(query.State)))
+	}
+	if len(query.Amenities) > 0 {
+		if query.AmenitiesMatch == hotels.MatchAny {
+			values := make([]string, 0, len(query.Amenities))
+			for _, amenity := range query.Amenities {
+				values = append(values, quote(amenity))
+			}
+			filters = append(filters, fmt.Sprintf("{!tag=amenities}amenities:(%s)", strings.Join(values, " OR ")))
+		} else {
+			// One filter per amenity, so each one is cached on its own
+			for _, amenity := range query.Amenities {
+				filters = append(filters, fmt.Sprintf("{!tag=amenities}amenities:%s", quote(amenity)))
+			}
+		}
+	}
+	if query.MinRating > 0 || query.MaxRating > 0 {
+		minRating, maxRating := "*", "*"
+		if query.MinRating > 0 {
+			minRating = strconv.FormatFloat(query.MinRating, 'f', -1, 64)
+		}
+		if query.MaxRating > 0 {
+			maxRating = strconv.FormatFloat(query.MaxRating, 'f', -1, 64)
+		}
+		filters = append(filters, fmt.Sprintf("{!tag=rating}rating:[%s TO %s]", minRating, maxRating))
+	}
+	if query.HotelIDs != nil {
+		filters = append(filters, fmt.Sprintf("{!terms f=id}%s", strings.Join(query.HotelIDs, ",")))
+	}
+	if query.Geo && query.RadiusKm > 0 {
+		filters = append(filters, fmt.Sprintf("{!geofilt sfield=location pt=%s d=%s}",
+			formatLocation(query.Latitude, query.Longitude), strconv.FormatFloat(query.RadiusKm, 'f', -1, 64)))
+	}
+	return filters
+}
+
+// buildFacets requests the counts for the filters sidebar, each facet ignores its own
+// filter so the other values of the same field keep their counts
+func buildFacets() []solr.Faceter {
+	facets := []solr.Faceter{
+		solr.NewTermsFacet("city").Field("city_facet").Limit(facetLimit).MinCount(1).AddToDomain("excludeTags", "city"),
+		solr.NewTermsFacet("state").Field("state_facet").Limit(facetLimit).MinCount(1).AddToDomain("excludeTags", "state"),
+		solr.NewTermsFacet("amenities").Field("amenities_facet").Limit(facetLimit).MinCount(1).AddToDomain("excludeTags", "amenities"),
+	}
+	for i, bucket := range ratingBuckets {
+		facets = append(facets, taggedQueryFacet{
+			name:       fmt.Sprintf("rating_%d", i),
+			query:      bucket.query,
+			excludeTag: "rating",
+		})
+	}
+	return facets
+}
+
+// parseFacets extracts the facet counts from the JSON facet response
+func parseFacets(facets solr.M) hotels.Facets {
+	result := hotels.Facets{
+		City:      parseTermsFacet(facets, "city"),
+		State:     parseTermsFacet(facets, "state"),
+		Amenities: parseTermsFacet(facets, "amenities"),
+		Rating:    make([]hotels.FacetCount, 0, len(ratingBuckets)),
+	}
+	for i, bucket := range ratingBuckets {
+		count := 0
+		if facet, ok := facets[fmt.Sprintf("rating_%d", i)].(map[string]interface{}); ok {
+			if value, ok := facet["count"].(float64); ok {
+				count = int(value)
+			}
+		}
+		result.Rating = append(result.Rating, hotels.FacetCount{Value: bucket.name, Count: count})
+	}
+	return result
+}
+
+func parseTermsFacet(facets solr.M, name string) []hotels.FacetCount {
+	counts := make([]hotels.FacetCount, 0)
+	facet, ok := facets[name].(map[string]interface{})
+	if !ok {
+		return counts
+	}
+	buckets, _ := facet["buckets"].([]interface{})
+	for _, bucket := range buckets {
+		values, ok := bucket.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		count, _ := values["count"].(float64)
+		counts = append(counts, hotels.FacetCount{Value: fmt.Sprint(values["val"]), Count: int(count)})
+	}
+	return counts
+}
+
+// taggedQueryFacet is a query facet that ignores the filters with the given tag,
+// which solr.QueryFacet can't express
+type taggedQueryFacet struct {
+	name       string
+	query      string
+	excludeTag string
+}
+
+func (facet taggedQueryFacet) BuildFacet() solr.M {
+	return solr.M{
+		"type":   "query",
+		"q":      facet.query,
+		"domain": solr.M{"excludeTags": facet.excludeTag},
+	}
+}
+
+func (facet taggedQueryFacet) Name() string {
+	return facet.name
+}
+
+// buildSort translates the query sort to a Solr sort, using the ID as tiebreaker
+func buildSort(query hotels.Query) string {
+	switch query.Sort {
+	case hotels.SortDistance:
+		return fmt.Sprintf("%s asc,id asc", geodist(query))
+	case hotels.SortRating:
+		return "rating desc,score desc,id asc"
+	case hotels.SortName:
+		return "name_sort asc,id asc"
+	default:
+		return "score desc,id asc"
+	}
+}
+
+// geodist is the function computing the distance in km from the query point to each hotel
+func geodist(query hotels.Query) string {
+	return fmt.Sprintf("geodist(location,%s)", formatLocation(query.Latitude, query.Longitude))
+}
+
+// formatLocation formats a point the way Solr spatial fields expect it, empty when unset
+func formatLocation(latitude float64, longitude float64) string {
+	if latitude == 0 && longitude == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s,%s", strconv.FormatFloat(latitude, 'f', -1, 64), strconv.FormatFloat(longitude, 'f', -1, 64))
+}
+
+// parseLocation reads back a "lat,lng" point stored in Solr
+func parseLocation(location string) (float64, float64) {
+	parts := strings.Split(location, ",")
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0
+	}
+	return latitude, longitude
+}
+
+// quote wraps a value in a Solr phrase, escaping the characters that would end it
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return fmt.Sprintf(`"%s"`, value)
 }
 
 // Helper function to safely get string fields from the document
@@ -0,0 +1,255 @@
+package hotels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"search-api/dao/hotels"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// indexerTimeout bounds each update request, a stuck flush would hold every writer
+	indexerTimeout = 30 * time.Second
+)
+
+type IndexerConfig struct {
+	BatchSize     int           // Flush once this many documents are buffered
+	FlushInterval time.Duration // Flush the buffered documents at least this often
+	CommitWithin  time.Duration // Solr makes the flushed documents searchable within this time
+}
+
+// SolrIndexer writes to Solr in batches relying on commitWithin instead of a hard commit per
+// document. Writes block until the batch holding them is accepted by Solr, which keeps them in
+// its transaction log, so callers can acknowledge their events once a write returns
+type SolrIndexer struct {
+	Solr
+	config IndexerConfig
+	client *http.Client
+	writes chan indexerWrite
+	recent *recentVersions
+}
+
+// indexerWrite is a buffered document along with the caller waiting for it
+type indexerWrite struct {
+	id      string
+	version int64
+	doc     map[string]interface{}
+	result  chan error
+}
+
+// NewSolrIndexer starts a batching indexer over the given Solr collection
+func NewSolrIndexer(solr Solr, config IndexerConfig) SolrIndexer {
+	indexer := SolrIndexer{
+		Solr:   solr,
+		config: config,
+		client: &http.Client{Timeout: indexerTimeout},
+		writes: make(chan indexerWrite, config.BatchSize),
+		recent: &recentVersions{versions: make(map[string]recentVersion)},
+	}
+	go indexer.run()
+	return indexer
+}
+
+// Index buffers the hotel document and waits until it's flushed
+func (indexer SolrIndexer) Index(ctx context.Context, hotel hotels.Hotel) (string, error) {
+	if err := indexer.write(ctx, hotel.ID, hotel.Version, hotelDocument(hotel)); err != nil {
+		return "", fmt.Errorf("error indexing hotel: %w", err)
+	}
+	return hotel.ID, nil
+}
+
+// Update buffers the hotel document and waits until it's flushed
+func (indexer SolrIndexer) Update(ctx context.Context, hotel hotels.Hotel) error {
+	if err := indexer.write(ctx, hotel.ID, hotel.Version, hotelDocument(hotel)); err != nil {
+		return fmt.Errorf("error updating hotel: %w", err)
+	}
+	return nil
+}
+
+// Delete buffers the tombstone of the hotel and waits until it's flushed
+func (indexer SolrIndexer) Delete(ctx context.Context, id string, version int64) error {
+	if err := indexer.write(ctx, id, version, tombstoneDocument(id, version)); err != nil {
+		return fmt.Errorf("error deleting hotel: %w", err)
+	}
+	return nil
+}
+
+// GetVersion returns the indexed version of a hotel, including the versions flushed but
+// not searchable yet
+func (indexer SolrIndexer) GetVersion(ctx context.Context, id string) (int64, bool, error) {
+	if version, ok := indexer.recent.get(id); ok {
+		return version, true, nil
+	}
+	return indexer.Solr.GetVersion(ctx, id)
+}
+
+func (indexer SolrIndexer) write(ctx context.Context, id string, version int64, doc map[string]interface{}) error {
+	write := indexerWrite{
+		id:      id,
+		version: version,
+		doc:     doc,
+		result:  make(chan error, 1),
+	}
+	select {
+	case indexer.writes <- write:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// The document may still be flushed after the context is done, the caller will
+	// retry and the version check will skip it then
+	select {
+	case err := <-write.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run buffers the writes and flushes them by size or time
+func (indexer SolrIndexer) run() {
+	ticker := time.NewTicker(indexer.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]indexerWrite, 0, indexer.config.BatchSize)
+	for {
+		select {
+		case write := <-indexer.writes:
+			batch = append(batch, write)
+			if len(batch) < indexer.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		indexer.flush(batch)
+		batch = make([]indexerWrite, 0, indexer.config.BatchSize)
+	}
+}
+
+// flush sends a batch and reports the result to each writer. When the batch is rejected the
+// documents are sent one by one, so only the failing ones report an error
+func (indexer SolrIndexer) flush(batch []indexerWrite) {
+	indexer.recent.prune()
+
+	// Only the newest version of each hotel is sent, the older writes are superseded by it
+	latest := make(map[string]int)
+	writes := make([]indexerWrite, 0, len(batch))
+	for _, write := range batch {
+		if i, ok := latest[write.id]; ok {
+			if writes[i].version > write.version {
+				write.result <- nil
+				continue
+			}
+			writes[i].result <- nil
+			writes[i] = write
+			continue
+		}
+		latest[write.id] = len(writes)
+		writes = append(writes, write)
+	}
+
+	docs := make([]map[string]interface{}, 0, len(writes))
+	for _, write := range writes {
+		docs = append(docs, write.doc)
+	}
+	if err := indexer.send(docs); err == nil {
+		for _, write := range writes {
+			indexer.recent.set(write.id, write.version, indexer.config.CommitWithin)
+			write.result <- nil
+		}
+		return
+	} else if len(writes) > 1 {
+		log.Printf("error flushing %d hotel documents, retrying them one by one: %v", len(writes), err)
+	} else {
+		writes[0].result <- err
+		return
+	}
+
+	for _, write := range writes {
+		err := indexer.send([]map[string]interface{}{write.doc})
+		if err == nil {
+			indexer.recent.set(write.id, write.version, indexer.config.CommitWithin)
+		}
+		write.result <- err
+	}
+}
+
+// send posts documents to the update handler, to be committed within the configured time
+func (indexer SolrIndexer) send(docs []map[string]interface{}) error {
+	body, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("error marshaling hotel documents: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("commitWithin", strconv.FormatInt(indexer.config.CommitWithin.Milliseconds(), 10))
+	params.Set("wt", "json")
+	resp, err := indexer.client.Post(fmt.Sprintf("%s/solr/%s/update?%s", indexer.BaseURL, indexer.Collection, params.Encode()), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error sending hotel documents: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to index hotel documents: received status code %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
+
+// recentVersions remembers the versions flushed until Solr makes them searchable
+type recentVersions struct {
+	mutex    sync.Mutex
+	versions map[string]recentVersion
+}
+
+type recentVersion struct {
+	version int64
+	expires time.Time
+}
+
+func (recent *recentVersions) get(id string) (int64, bool) {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+	entry, ok := recent.versions[id]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(recent.versions, id)
+		return 0, false
+	}
+	return entry.version, true
+}
+
+// set keeps the version for twice the commit window, by then it's searchable
+func (recent *recentVersions) set(id string, version int64, commitWithin time.Duration) {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+	recent.versions[id] = recentVersion{
+		version: version,
+		expires: time.Now().Add(2 * commitWithin),
+	}
+}
+
+// prune forgets the versions that are searchable by now
+func (recent *recentVersions) prune() {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+	now := time.Now()
+	for id, entry := range recent.versions {
+		if now.After(entry.expires) {
+			delete(recent.versions, id)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package hotels_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	hotelsDAO "search-api/dao/hotels"
+	repositories "search-api/repositories/hotels"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newIndexer starts an indexer over a stand-in playing the Solr update and query handlers
+func newIndexer(t *testing.T, config repositories.IndexerConfig) (*standIn, repositories.SolrIndexer) {
+	stand := &standIn{}
+	server := httptest.NewServer(stand)
+	t.Cleanup(server.Close)
+
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	solr := repositories.NewSolr(repositories.SolrConfig{
+		Host:       parsed.Hostname(),
+		Port:       parsed.Port(),
+		Collection: "hotels",
+		Profiles:   testProfiles,
+	})
+	return stand, repositories.NewSolrIndexer(solr, config)
+}
+
+// updates decodes the documents of every update request received
+func updates(t *testing.T, stand *standIn) [][]map[string]interface{} {
+	stand.mutex.Lock()
+	defer stand.mutex.Unlock()
+	batches := make([][]map[string]interface{}, 0)
+	for _, request := range stand.requests {
+		if !strings.HasPrefix(request.Path, "/solr/hotels/update") {
+			continue
+		}
+		var docs []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(request.Body), &docs))
+		batches = append(batches, docs)
+	}
+	return batches
+}
+
+// writeAll updates the hotels concurrently, as the consumer workers do, returning each error
+func writeAll(indexer repositories.SolrIndexer, hotels []hotelsDAO.Hotel) []error {
+	errs := make([]error, len(hotels))
+	var wg sync.WaitGroup
+	for i, hotel := range hotels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = indexer.Update(context.Background(), hotel)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestSolrIndexer_FlushesBatch(t *testing.T) {
+	stand, indexer := newIndexer(t, repositories.IndexerConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		CommitWithin:  time.Minute,
+	})
+
+	errs := writeAll(indexer, testHotels[:3])
+
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	batches := updates(t, stand)
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0], 3)
+	assert.Contains(t, stand.requests[0].Path, "commitWithin=60000")
+
+	// The flushed versions are known before Solr makes them searchable
+	version, found, err := indexer.GetVersion(context.Background(), "h1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(1), version)
+	assert.Len(t, stand.requests, 1)
+}
+
+func TestSolrIndexer_FlushesOnInterval(t *testing.T) {
+	stand, indexer := newIndexer(t, repositories.IndexerConfig{
+		BatchSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+		CommitWithin:  time.Minute,
+	})
+
+	require.NoError(t, indexer.Delete(context.Background(), "h2", 4))
+
+	batches := updates(t, stand)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	assert.Equal(t, "h2", batches[0][0]["id"])
+	assert.Equal(t, true, batches[0][0]["deleted"])
+	assert.Equal(t, float64(4), batches[0][0]["version"])
+}
+
+func TestSolrIndexer_SendsNewestVersion(t *testing.T) {
+	stand, indexer := newIndexer(t, repositories.IndexerConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		CommitWithin:  time.Minute,
+	})
+	older, newer := testHotels[0], testHotels[0]
+	newer.Name, newer.Version = "Grand Plaza Hotel Renamed", 2
+
+	errs := writeAll(indexer, []hotelsDAO.Hotel{newer, older, testHotels[1]})
+
+	// Both writes of the hotel succeed but only the newest is sent
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	batches := updates(t, stand)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 2)
+	for _, doc := range batches[0] {
+		if doc["id"] == "h1" {
+			assert.Equal(t, "Grand Plaza Hotel Renamed", doc["name"])
+		}
+	}
+}
+
+func TestSolrIndexer_RejectedBatch(t *testing.T) {
+	stand, indexer := newIndexer(t, repositories.IndexerConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		CommitWithin:  time.Minute,
+	})
+	invalid := testHotels[2]
+	invalid.Name = "invalid"
+
+	stand.respond = func(method string, path string) (int, string) {
+		if strings.HasPrefix(path, "/solr/hotels/update") {
+			// Solr rejects the whole request when one of its documents is invalid
+			stand.mutex.Lock()
+			body := stand.requests[len(stand.requests)-1].Body
+			stand.mutex.Unlock()
+			if strings.Contains(body, `"invalid"`) {
+				return http.StatusBadRequest, `{"error":{"msg":"invalid document"}}`
+			}
+			return http.StatusOK, `{"responseHeader":{"status":0}}`
+		}
+		return http.StatusOK, `{"responseHeader":{"status":0},"response":{"numFound":1,"docs":[{"id":"h3","version":7}]}}`
+	}
+
+	errs := writeAll(indexer, []hotelsDAO.Hotel{testHotels[0], testHotels[1], invalid})
+
+	// The batch is retried one by one and only the invalid document fails
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.ErrorContains(t, errs[2], "400")
+	batches := updates(t, stand)
+	require.Len(t, batches, 4)
+	assert.Len(t, batches[0], 3)
+
+	// The failed write wasn't remembered, its version comes from Solr
+	version, found, err := indexer.GetVersion(context.Background(), "h3")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(7), version)
+}
@@ -2,102 +2,529 @@ package search
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	availabilityDAO "search-api/dao/availability"
 	hotelsDAO "search-api/dao/hotels"
 	hotelsDomain "search-api/domain/hotels"
+	"sync"
+	"time"
+)
+
+const (
+	suggestTimeout = 200 * time.Millisecond
+
+	// reindexBatchSize is how many hotels are sent to the rebuilt collection at once
+	reindexBatchSize = 500
+
+	// sparseResults is the total below which a corrected query is suggested
+	sparseResults = 3
 )
 
 type Repository interface {
 	Index(ctx context.Context, hotel hotelsDAO.Hotel) (string, error)
 	Update(ctx context.Context, hotel hotelsDAO.Hotel) error
-	Delete(ctx context.Context, id string) error
-	Search(ctx context.Context, query string, limit int, offset int) ([]hotelsDAO.Hotel, error) // Updated signature
+	Delete(ctx context.Context, id string, version int64) error
+	GetVersion(ctx context.Context, id string) (int64, bool, error)
+	ScanVersions(ctx context.Context, fn func(version hotelsDAO.IndexedVersion) error) error
+	CreateCollection(ctx context.Context) (string, error)
+	IndexInto(ctx context.Context, collection string, hotels []hotelsDAO.Hotel) error
+	SwapCollection(ctx context.Context, collection string) error
+	DropCollection(ctx context.Context, collection string) error
+	Search(ctx context.Context, query hotelsDAO.Query) (hotelsDAO.SearchResult, error)
+	Suggest(ctx context.Context, prefix string, limit int) ([]hotelsDAO.Suggestion, error)
+	BuildSuggestions(ctx context.Context) error
 }
 
 type ExternalRepository interface {
 	GetHotelByID(ctx context.Context, id string) (hotelsDomain.Hotel, error)
+	GetRoomByID(ctx context.Context, hotelID string, roomID string) (hotelsDomain.Room, error)
+	ExportHotels(ctx context.Context, fn func(hotel hotelsDomain.Hotel) error) error
+	ExportRooms(ctx context.Context, fn func(room hotelsDomain.Room) error) error
+	ExportStays(ctx context.Context, fn func(stay hotelsDomain.Stay) error) error
+}
+
+type AvailabilityRepository interface {
+	UpsertRoom(ctx context.Context, room availabilityDAO.Room) error
+	DeleteRoom(ctx context.Context, roomID string) error
+	Reserve(ctx context.Context, reservation availabilityDAO.Reservation) error
+	Release(ctx context.Context, reservation availabilityDAO.Reservation) error
+	AvailableHotels(ctx context.Context, nights []time.Time, guests int) ([]string, error)
 }
 
 type Service struct {
-	repository Repository
-	hotelsAPI  ExternalRepository
+	repository   Repository
+	hotelsAPI    ExternalRepository
+	availability AvailabilityRepository
+	rebuilding   *sync.Mutex
 }
 
-func NewService(repository Repository, hotelsAPI ExternalRepository) Service {
+func NewService(repository Repository, hotelsAPI ExternalRepository, availability AvailabilityRepository) Service {
 	return Service{
-		repository: repository,
-		hotelsAPI:  hotelsAPI,
+		repository:   repository,
+		hotelsAPI:    hotelsAPI,
+		availability: availability,
+		rebuilding:   &sync.Mutex{},
 	}
 }
 
-func (service Service) Search(ctx context.Context, query string, offset int, limit int) ([]hotelsDomain.Hotel, error) {
+func (service Service) Search(ctx context.Context, request hotelsDomain.SearchRequest) (hotelsDomain.SearchResponse, error) {
+	// Restrict the search to the hotels with capacity for the stay
+	var hotelIDs []string
+	if !request.CheckIn.IsZero() {
+		available, err := service.availability.AvailableHotels(ctx, stayNights(request.CheckIn, request.CheckOut), request.Guests)
+		if err != nil {
+			return hotelsDomain.SearchResponse{}, fmt.Errorf("error getting available hotels: %w", err)
+		}
+		if len(available) == 0 {
+			return toSearchResponse(request, hotelsDAO.SearchResult{}), nil
+		}
+		hotelIDs = available
+	}
+
 	// Call the repository's Search method
-	hotelsDAOList, err := service.repository.Search(ctx, query, limit, offset)
+	result, err := service.repository.Search(ctx, hotelsDAO.Query{
+		Text:           request.Query,
+		Mode:           request.Mode,
+		Profile:        request.Profile,
+		City:           request.City,
+		State:          request.State,
+		Amenities:      request.Amenities,
+		AmenitiesMatch: request.AmenitiesMatch,
+		MinRating:      request.MinRating,
+		MaxRating:      request.MaxRating,
+		HotelIDs:       hotelIDs,
+		Latitude:       request.Latitude,
+		Longitude:      request.Longitude,
+		RadiusKm:       request.RadiusKm,
+		Geo:            request.Geo,
+		Sort:           request.Sort,
+		Offset:         request.Offset,
+		Limit:          request.Limit,
+	})
+	if errors.Is(err, hotelsDAO.ErrUnknownProfile) {
+		return hotelsDomain.SearchResponse{}, fmt.Errorf("%w: %s", hotelsDomain.ErrUnknownProfile, request.Profile)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error searching hotels: %w", err)
+		return hotelsDomain.SearchResponse{}, fmt.Errorf("error searching hotels: %w", err)
 	}
 
-	// Convert the dao layer hotels to domain layer hotels
+	return toSearchResponse(request, result), nil
+}
+
+func (service Service) Suggest(ctx context.Context, prefix string, limit int) ([]hotelsDomain.Suggestion, error) {
+	// Suggestions are requested on every keystroke, a late answer is useless
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+
+	suggestionsDAO, err := service.repository.Suggest(ctx, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting suggestions: %w", err)
+	}
+
+	suggestions := make([]hotelsDomain.Suggestion, 0, len(suggestionsDAO))
+	for _, suggestion := range suggestionsDAO {
+		suggestions = append(suggestions, hotelsDomain.Suggestion{
+			Text: suggestion.Text,
+			Type: suggestion.Type,
+		})
+	}
+	return suggestions, nil
+}
+
+// toSearchResponse converts the dao layer result to the domain layer response
+func toSearchResponse(request hotelsDomain.SearchRequest, result hotelsDAO.SearchResult) hotelsDomain.SearchResponse {
 	hotelsDomainList := make([]hotelsDomain.Hotel, 0)
-	for _, hotel := range hotelsDAOList {
+	for _, hotel := range result.Hotels {
 		hotelsDomainList = append(hotelsDomainList, hotelsDomain.Hotel{
-			ID:        hotel.ID,
-			Name:      hotel.Name,
-			Address:   hotel.Address,
-			City:      hotel.City,
-			State:     hotel.State,
-			Rating:    hotel.Rating,
-			Amenities: hotel.Amenities,
+			ID:         hotel.ID,
+			Name:       hotel.Name,
+			Address:    hotel.Address,
+			City:       hotel.City,
+			State:      hotel.State,
+			Rating:     hotel.Rating,
+			Amenities:  hotel.Amenities,
+			Latitude:   hotel.Latitude,
+			Longitude:  hotel.Longitude,
+			DistanceKm: hotel.Distance,
+			Highlights: hotel.Highlights,
 		})
 	}
 
-	return hotelsDomainList, nil
+	// Only suggest the corrected query when the query as typed finds little
+	didYouMean := ""
+	if result.Total < sparseResults {
+		didYouMean = result.Collation
+	}
+
+	return hotelsDomain.SearchResponse{
+		Results: hotelsDomainList,
+		Total:   result.Total,
+		Offset:  request.Offset,
+		Limit:   request.Limit,
+		Facets: hotelsDomain.Facets{
+			City:      convertFacetCounts(result.Facets.City),
+			State:     convertFacetCounts(result.Facets.State),
+			Amenities: convertFacetCounts(result.Facets.Amenities),
+			Rating:    convertFacetCounts(result.Facets.Rating),
+		},
+		DidYouMean: didYouMean,
+	}
+}
+
+func convertFacetCounts(counts []hotelsDAO.FacetCount) []hotelsDomain.FacetCount {
+	result := make([]hotelsDomain.FacetCount, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, hotelsDomain.FacetCount{
+			Value: count.Value,
+			Count: count.Count,
+		})
+	}
+	return result
 }
 
-func (service Service) HandleHotelNew(hotelNew hotelsDomain.HotelNew) {
+func (service Service) HandleHotelNew(hotelNew hotelsDomain.HotelNew) error {
+	if hotelNew.SchemaVersion > hotelsDomain.EventSchemaVersion {
+		return fmt.Errorf("%w: unsupported schema version %d", hotelsDomain.ErrInvalidEvent, hotelNew.SchemaVersion)
+	}
+
 	switch hotelNew.Operation {
-	case "CREATE", "UPDATE":
-		// Fetch hotel details from the local service
-		hotel, err := service.hotelsAPI.GetHotelByID(context.Background(), hotelNew.HotelID)
+	case "CREATE", "UPDATE", "DELETE":
+		return service.handleHotelChange(hotelNew)
+
+	case "ROOM_CREATE", "ROOM_UPDATE":
+		// Fetch room inventory from the hotels API
+		room, err := service.hotelsAPI.GetRoomByID(context.Background(), hotelNew.HotelID, hotelNew.RoomID)
 		if err != nil {
-			fmt.Printf("Error getting hotel (%s) from API: %v\n", hotelNew.HotelID, err)
-			return
+			return fmt.Errorf("error getting room (%s) from API: %w", hotelNew.RoomID, err)
+		}
+		if err := service.availability.UpsertRoom(context.Background(), toRoomDAO(room)); err != nil {
+			return fmt.Errorf("error updating room (%s) availability: %w", hotelNew.RoomID, err)
+		}
+
+	case "ROOM_DELETE":
+		if err := service.availability.DeleteRoom(context.Background(), hotelNew.RoomID); err != nil {
+			return fmt.Errorf("error deleting room (%s) availability: %w", hotelNew.RoomID, err)
 		}
 
-		hotelDAO := hotelsDAO.Hotel{
-			ID:        hotel.ID,
-			Name:      hotel.Name,
-			Address:   hotel.Address,
-			City:      hotel.City,
-			State:     hotel.State,
-			Rating:    hotel.Rating,
-			Amenities: hotel.Amenities,
-		}
-
-		// Handle Index operation
-		if hotelNew.Operation == "CREATE" {
-			if _, err := service.repository.Index(context.Background(), hotelDAO); err != nil {
-				fmt.Printf("Error indexing hotel (%s): %v\n", hotelNew.HotelID, err)
-			} else {
-				fmt.Println("Hotel indexed successfully:", hotelNew.HotelID)
-			}
-		} else { // Handle Update operation
-			if err := service.repository.Update(context.Background(), hotelDAO); err != nil {
-				fmt.Printf("Error updating hotel (%s): %v\n", hotelNew.HotelID, err)
-			} else {
-				fmt.Println("Hotel updated successfully:", hotelNew.HotelID)
-			}
-		}
-
-	case "DELETE":
-		// Call Delete method directly since no hotel details are needed
-		if err := service.repository.Delete(context.Background(), hotelNew.HotelID); err != nil {
-			fmt.Printf("Error deleting hotel (%s): %v\n", hotelNew.HotelID, err)
+	case "RESERVATION_CREATE", "RESERVATION_CANCEL":
+		// Reservations are applied once by ID, events without one can't be told apart from
+		// their redeliveries and are left to the rebuild on startup
+		if hotelNew.ReservationID == "" {
+			return fmt.Errorf("%w: %s for room (%s) without reservation ID", hotelsDomain.ErrInvalidEvent, hotelNew.Operation, hotelNew.RoomID)
+		}
+		reservation, err := toReservationDAO(hotelsDomain.Stay{
+			ID:       hotelNew.ReservationID,
+			HotelID:  hotelNew.HotelID,
+			RoomID:   hotelNew.RoomID,
+			CheckIn:  hotelNew.CheckIn,
+			CheckOut: hotelNew.CheckOut,
+		})
+		if err != nil {
+			return err
+		}
+		if hotelNew.Operation == "RESERVATION_CREATE" {
+			err = service.availability.Reserve(context.Background(), reservation)
 		} else {
-			fmt.Println("Hotel deleted successfully:", hotelNew.HotelID)
+			err = service.availability.Release(context.Background(), reservation)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating room (%s) availability: %w", hotelNew.RoomID, err)
 		}
 
 	default:
-		fmt.Printf("Unknown operation: %s\n", hotelNew.Operation)
+		return fmt.Errorf("%w: unknown operation %s", hotelsDomain.ErrInvalidEvent, hotelNew.Operation)
+	}
+	return nil
+}
+
+// LoadAvailability loads every room and the stays of the confirmed reservations from the
+// hotels API into the availability projection. It runs once the consumer is attached and
+// before the events are handled, the reservation events queued meanwhile are applied once
+// on top of it
+func (service Service) LoadAvailability(ctx context.Context) error {
+	rooms, stays := 0, 0
+	if err := service.hotelsAPI.ExportRooms(ctx, func(room hotelsDomain.Room) error {
+		rooms++
+		return service.availability.UpsertRoom(ctx, toRoomDAO(room))
+	}); err != nil {
+		return fmt.Errorf("error loading rooms: %w", err)
+	}
+	if err := service.hotelsAPI.ExportStays(ctx, func(stay hotelsDomain.Stay) error {
+		reservation, err := toReservationDAO(stay)
+		if err != nil {
+			return err
+		}
+		stays++
+		return service.availability.Reserve(ctx, reservation)
+	}); err != nil {
+		return fmt.Errorf("error loading reservations: %w", err)
+	}
+	fmt.Printf("Availability loaded: %d rooms, %d reservations\n", rooms, stays)
+	return nil
+}
+
+// RunSuggestionBuilds rebuilds the suggestions every interval until the context is cancelled,
+// so the indexed changes show up in them
+func (service Service) RunSuggestionBuilds(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := service.repository.BuildSuggestions(ctx); err != nil {
+			fmt.Printf("Error building suggestions: %v\n", err)
+		}
+	}
+}
+
+// handleHotelChange applies a hotel event to the index unless the index already holds the
+// same or a newer version of the hotel, so duplicated and out of order events are dropped
+// and a late CREATE or UPDATE can't bring back a deleted hotel
+func (service Service) handleHotelChange(hotelNew hotelsDomain.HotelNew) error {
+	ctx := context.Background()
+
+	// Legacy events carry no version and are always applied
+	if hotelNew.Version > 0 {
+		current, found, err := service.repository.GetVersion(ctx, hotelNew.HotelID)
+		if err != nil {
+			return fmt.Errorf("error getting indexed version of hotel (%s): %w", hotelNew.HotelID, err)
+		}
+		if found && current >= hotelNew.Version {
+			fmt.Printf("Skipping stale %s event for hotel (%s): version %d, indexed %d\n", hotelNew.Operation, hotelNew.HotelID, hotelNew.Version, current)
+			return nil
+		}
+	}
+
+	if hotelNew.Operation == "DELETE" {
+		// Leave a tombstone with the version of the delete behind
+		if err := service.repository.Delete(ctx, hotelNew.HotelID, hotelNew.Version); err != nil {
+			return fmt.Errorf("error deleting hotel (%s): %w", hotelNew.HotelID, err)
+		}
+		fmt.Println("Hotel deleted successfully:", hotelNew.HotelID)
+		return nil
+	}
+
+	// Use the snapshot in the event, legacy events only carry the ID so the hotel
+	// details are fetched from the local service
+	var hotel hotelsDomain.Hotel
+	if hotelNew.Hotel != nil {
+		hotel = *hotelNew.Hotel
+	} else {
+		var err error
+		hotel, err = service.hotelsAPI.GetHotelByID(ctx, hotelNew.HotelID)
+		if err != nil {
+			return fmt.Errorf("error getting hotel (%s) from API: %w", hotelNew.HotelID, err)
+		}
+	}
+
+	hotelDAO := toHotelDAO(hotel, hotelNew.Version)
+
+	// Handle Index operation
+	if hotelNew.Operation == "CREATE" {
+		if _, err := service.repository.Index(ctx, hotelDAO); err != nil {
+			return fmt.Errorf("error indexing hotel (%s): %w", hotelNew.HotelID, err)
+		}
+		fmt.Println("Hotel indexed successfully:", hotelNew.HotelID)
+	} else { // Handle Update operation
+		if err := service.repository.Update(ctx, hotelDAO); err != nil {
+			return fmt.Errorf("error updating hotel (%s): %w", hotelNew.HotelID, err)
+		}
+		fmt.Println("Hotel updated successfully:", hotelNew.HotelID)
+	}
+	return nil
+}
+
+// Reindex rebuilds the collection from every hotel in the hotels API and swaps it in
+// atomically, searches keep hitting the previous collection meanwhile. Events keep being
+// applied to the previous collection too, so a reconcile runs after the swap to bring
+// over the changes made during the rebuild
+func (service Service) Reindex(ctx context.Context) (hotelsDomain.ReindexResponse, error) {
+	if !service.rebuilding.TryLock() {
+		return hotelsDomain.ReindexResponse{}, hotelsDomain.ErrRebuildInProgress
+	}
+	defer service.rebuilding.Unlock()
+
+	collection, err := service.repository.CreateCollection(ctx)
+	if err != nil {
+		return hotelsDomain.ReindexResponse{}, fmt.Errorf("error creating collection: %w", err)
+	}
+
+	// Stream the hotels into the new collection in batches
+	indexed := 0
+	batch := make([]hotelsDAO.Hotel, 0, reindexBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := service.repository.IndexInto(ctx, collection, batch); err != nil {
+			return fmt.Errorf("error indexing into collection %s: %w", collection, err)
+		}
+		indexed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	err = service.hotelsAPI.ExportHotels(ctx, func(hotel hotelsDomain.Hotel) error {
+		batch = append(batch, toHotelDAO(hotel, hotel.Version))
+		if len(batch) < reindexBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = service.repository.SwapCollection(ctx, collection)
+	}
+	if err != nil {
+		if dropErr := service.repository.DropCollection(context.Background(), collection); dropErr != nil {
+			fmt.Printf("Error dropping collection (%s): %v\n", collection, dropErr)
+		}
+		return hotelsDomain.ReindexResponse{}, fmt.Errorf("error reindexing hotels: %w", err)
+	}
+
+	reconcile, err := service.reconcile(ctx, false)
+	if err != nil {
+		return hotelsDomain.ReindexResponse{}, fmt.Errorf("error reconciling reindexed hotels: %w", err)
+	}
+
+	// The swapped in collection starts with empty suggesters
+	if err := service.repository.BuildSuggestions(ctx); err != nil {
+		fmt.Printf("Error building suggestions: %v\n", err)
+	}
+	return hotelsDomain.ReindexResponse{
+		Indexed:   indexed,
+		Reconcile: reconcile,
+	}, nil
+}
+
+// Reconcile compares the indexed versions with the hotels API and indexes the missing and
+// stale hotels, and deletes the orphaned ones. A dry run only counts them
+func (service Service) Reconcile(ctx context.Context, dryRun bool) (hotelsDomain.ReconcileResponse, error) {
+	if !service.rebuilding.TryLock() {
+		return hotelsDomain.ReconcileResponse{}, hotelsDomain.ErrRebuildInProgress
+	}
+	defer service.rebuilding.Unlock()
+
+	return service.reconcile(ctx, dryRun)
+}
+
+func (service Service) reconcile(ctx context.Context, dryRun bool) (hotelsDomain.ReconcileResponse, error) {
+	response := hotelsDomain.ReconcileResponse{DryRun: dryRun}
+
+	// Collect what's indexed, only IDs and versions are kept in memory
+	indexed := make(map[string]hotelsDAO.IndexedVersion)
+	if err := service.repository.ScanVersions(ctx, func(version hotelsDAO.IndexedVersion) error {
+		indexed[version.ID] = version
+		return nil
+	}); err != nil {
+		return response, fmt.Errorf("error scanning indexed hotels: %w", err)
+	}
+
+	// Walk the source of truth fixing what differs
+	if err := service.hotelsAPI.ExportHotels(ctx, func(hotel hotelsDomain.Hotel) error {
+		response.Checked++
+		current, found := indexed[hotel.ID]
+		delete(indexed, hotel.ID)
+		switch {
+		case found && current.Version >= hotel.Version:
+			// Indexed at that version or past it, tombstones included
+			return nil
+		case !found || current.Deleted:
+			response.Missing++
+		default:
+			response.Stale++
+		}
+		if dryRun {
+			return nil
+		}
+
+		// The consumer keeps indexing meanwhile, so compare again right before the write the
+		// same way events are compared, the export may already be older than the index
+		if indexedVersion, found, err := service.repository.GetVersion(ctx, hotel.ID); err != nil {
+			return fmt.Errorf("error getting indexed version of hotel (%s): %w", hotel.ID, err)
+		} else if found && indexedVersion >= hotel.Version {
+			return nil
+		}
+		if err := service.repository.Update(ctx, toHotelDAO(hotel, hotel.Version)); err != nil {
+			return fmt.Errorf("error indexing hotel (%s): %w", hotel.ID, err)
+		}
+		return nil
+	}); err != nil {
+		return response, fmt.Errorf("error reconciling hotels: %w", err)
+	}
+
+	// What's left indexed is gone from the hotels API
+	for id, current := range indexed {
+		if current.Deleted {
+			continue
+		}
+		response.Orphaned++
+		if dryRun {
+			continue
+		}
+		if indexedVersion, _, err := service.repository.GetVersion(ctx, id); err != nil {
+			return response, fmt.Errorf("error getting indexed version of hotel (%s): %w", id, err)
+		} else if indexedVersion > current.Version {
+			continue
+		}
+		if err := service.repository.Delete(ctx, id, current.Version+1); err != nil {
+			return response, fmt.Errorf("error deleting orphaned hotel (%s): %w", id, err)
+		}
+	}
+
+	return response, nil
+}
+
+func toHotelDAO(hotel hotelsDomain.Hotel, version int64) hotelsDAO.Hotel {
+	return hotelsDAO.Hotel{
+		ID:        hotel.ID,
+		Name:      hotel.Name,
+		Address:   hotel.Address,
+		City:      hotel.City,
+		State:     hotel.State,
+		Rating:    hotel.Rating,
+		Amenities: hotel.Amenities,
+		Latitude:  hotel.Latitude,
+		Longitude: hotel.Longitude,
+		Version:   version,
+	}
+}
+
+func toRoomDAO(room hotelsDomain.Room) availabilityDAO.Room {
+	return availabilityDAO.Room{
+		ID:       room.ID,
+		HotelID:  room.HotelID,
+		Capacity: room.Capacity,
+		Units:    room.Units,
+	}
+}
+
+func toReservationDAO(stay hotelsDomain.Stay) (availabilityDAO.Reservation, error) {
+	checkIn, err := time.Parse(hotelsDomain.DateLayout, stay.CheckIn)
+	if err != nil {
+		return availabilityDAO.Reservation{}, fmt.Errorf("%w: check in (%s) for room (%s): %v", hotelsDomain.ErrInvalidEvent, stay.CheckIn, stay.RoomID, err)
+	}
+	checkOut, err := time.Parse(hotelsDomain.DateLayout, stay.CheckOut)
+	if err != nil {
+		return availabilityDAO.Reservation{}, fmt.Errorf("%w: check out (%s) for room (%s): %v", hotelsDomain.ErrInvalidEvent, stay.CheckOut, stay.RoomID, err)
+	}
+	return availabilityDAO.Reservation{
+		ID:     stay.ID,
+		RoomID: stay.RoomID,
+		Nights: stayNights(checkIn, checkOut),
+	}, nil
+}
+
+// stayNights returns the dates of every night between check in and check out
+func stayNights(checkIn time.Time, checkOut time.Time) []time.Time {
+	nights := make([]time.Time, 0)
+	for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night)
 	}
+	return nights
 }
@@ -0,0 +1,182 @@
+package search_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	hotelsDAO "search-api/dao/hotels"
+	hotelsDomain "search-api/domain/hotels"
+	availabilityRepositories "search-api/repositories/availability"
+	hotelsRepositories "search-api/repositories/hotels"
+	services "search-api/services/search"
+	"testing"
+)
+
+// hotelsAPI serves the hotels as the hotels API exports them
+type hotelsAPI struct {
+	hotels    []hotelsDomain.Hotel
+	exporting func(hotel hotelsDomain.Hotel) // Called before each hotel is exported
+}
+
+func (api hotelsAPI) GetHotelByID(ctx context.Context, id string) (hotelsDomain.Hotel, error) {
+	for _, hotel := range api.hotels {
+		if hotel.ID == id {
+			return hotel, nil
+		}
+	}
+	return hotelsDomain.Hotel{}, fmt.Errorf("hotel (%s) not found", id)
+}
+
+func (api hotelsAPI) GetRoomByID(ctx context.Context, hotelID string, roomID string) (hotelsDomain.Room, error) {
+	return hotelsDomain.Room{}, fmt.Errorf("room (%s) not found", roomID)
+}
+
+func (api hotelsAPI) ExportHotels(ctx context.Context, fn func(hotel hotelsDomain.Hotel) error) error {
+	for _, hotel := range api.hotels {
+		if api.exporting != nil {
+			api.exporting(hotel)
+		}
+		if err := fn(hotel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (api hotelsAPI) ExportRooms(ctx context.Context, fn func(room hotelsDomain.Room) error) error {
+	return nil
+}
+
+func (api hotelsAPI) ExportStays(ctx context.Context, fn func(stay hotelsDomain.Stay) error) error {
+	return nil
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(api hotelsAPI) (services.Service, hotelsRepositories.Memory) {
+		repository := hotelsRepositories.NewMemory(hotelsRepositories.MemoryConfig{
+			Collection: "hotels",
+			Profiles:   map[string]hotelsRepositories.RankingProfile{"default": {Fields: []hotelsRepositories.FieldBoost{{Field: "name", Boost: 1}}}},
+		})
+		return services.NewService(repository, api, availabilityRepositories.NewMemory()), repository
+	}
+	hotelEvent := func(operation string, id string, version int64) hotelsDomain.HotelNew {
+		hotelNew := hotelsDomain.HotelNew{Operation: operation, HotelID: id, Version: version}
+		if operation != "DELETE" {
+			hotelNew.Hotel = &hotelsDomain.Hotel{ID: id, Name: fmt.Sprintf("Hotel %s v%d", id, version)}
+		}
+		return hotelNew
+	}
+	// live returns the names of the searchable hotels, tombstones aren't found
+	live := func(repository hotelsRepositories.Memory) []string {
+		result, err := repository.Search(ctx, hotelsDAO.Query{Profile: "default", Limit: 10})
+		require.NoError(t, err)
+		names := make([]string, 0, len(result.Hotels))
+		for _, hotel := range result.Hotels {
+			names = append(names, hotel.Name)
+		}
+		return names
+	}
+
+	t.Run("HandleHotelNew - Stale Version", func(t *testing.T) {
+		service, repository := newService(hotelsAPI{})
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("CREATE", "1", 1)))
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("UPDATE", "1", 3)))
+
+		// A late and a duplicated event are skipped
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("UPDATE", "1", 2)))
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("UPDATE", "1", 3)))
+
+		version, found, err := repository.GetVersion(ctx, "1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(3), version)
+		assert.Equal(t, []string{"Hotel 1 v3"}, live(repository))
+	})
+
+	t.Run("HandleHotelNew - Late Update After Delete", func(t *testing.T) {
+		service, repository := newService(hotelsAPI{})
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("CREATE", "1", 1)))
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("DELETE", "1", 3)))
+
+		// The tombstone keeps the hotel from coming back
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("UPDATE", "1", 2)))
+		assert.Empty(t, live(repository))
+		version, found, err := repository.GetVersion(ctx, "1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(3), version)
+
+		// A newer version does, the hotel was recreated
+		assert.NoError(t, service.HandleHotelNew(hotelEvent("CREATE", "1", 4)))
+		assert.Equal(t, []string{"Hotel 1 v4"}, live(repository))
+	})
+
+	t.Run("Reconcile", func(t *testing.T) {
+		service, repository := newService(hotelsAPI{hotels: []hotelsDomain.Hotel{
+			{ID: "current", Name: "Current", Version: 2},
+			{ID: "missing", Name: "Missing", Version: 1},
+			{ID: "stale", Name: "Stale v3", Version: 3},
+			{ID: "deleted", Name: "Deleted", Version: 5},
+		}})
+		assert.NoError(t, repository.Update(ctx, hotelsDAO.Hotel{ID: "current", Name: "Current", Version: 2}))
+		assert.NoError(t, repository.Update(ctx, hotelsDAO.Hotel{ID: "stale", Name: "Stale v1", Version: 1}))
+		assert.NoError(t, repository.Delete(ctx, "deleted", 4))
+		assert.NoError(t, repository.Update(ctx, hotelsDAO.Hotel{ID: "orphaned", Name: "Orphaned", Version: 1}))
+		expected := hotelsDomain.ReconcileResponse{Checked: 4, Missing: 2, Stale: 1, Orphaned: 1}
+
+		// A dry run only counts the differences
+		response, err := service.Reconcile(ctx, true)
+		assert.NoError(t, err)
+		expected.DryRun = true
+		assert.Equal(t, expected, response)
+		assert.ElementsMatch(t, []string{"Current", "Stale v1", "Orphaned"}, live(repository))
+
+		response, err = service.Reconcile(ctx, false)
+		assert.NoError(t, err)
+		expected.DryRun = false
+		assert.Equal(t, expected, response)
+		assert.ElementsMatch(t, []string{"Current", "Missing", "Stale v3", "Deleted"}, live(repository))
+
+		// The orphan is tombstoned past its version, so a late event can't bring it back
+		version, _, err := repository.GetVersion(ctx, "orphaned")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), version)
+
+		// Nothing is left to fix
+		response, err = service.Reconcile(ctx, true)
+		assert.NoError(t, err)
+		assert.Equal(t, hotelsDomain.ReconcileResponse{DryRun: true, Checked: 4}, response)
+	})
+
+	t.Run("Reconcile - Index Ahead Of Export", func(t *testing.T) {
+		// The consumer indexes a newer version while the export is being walked
+		var service services.Service
+		service, repository := newService(hotelsAPI{
+			hotels: []hotelsDomain.Hotel{
+				{ID: "current", Name: "Current v2", Version: 2},
+				{ID: "deleted", Name: "Deleted v5", Version: 5},
+				{ID: "racing", Name: "Racing v2", Version: 2},
+			},
+			exporting: func(hotel hotelsDomain.Hotel) {
+				if hotel.ID == "racing" {
+					require.NoError(t, service.HandleHotelNew(hotelEvent("UPDATE", "racing", 3)))
+				}
+			},
+		})
+		assert.NoError(t, repository.Update(ctx, hotelsDAO.Hotel{ID: "current", Name: "Current v3", Version: 3}))
+		assert.NoError(t, repository.Delete(ctx, "deleted", 6))
+		assert.NoError(t, repository.Update(ctx, hotelsDAO.Hotel{ID: "racing", Name: "Racing v1", Version: 1}))
+
+		_, err := service.Reconcile(ctx, false)
+		assert.NoError(t, err)
+
+		// Nothing went back to an older version
+		assert.ElementsMatch(t, []string{"Current v3", "Hotel racing v3"}, live(repository))
+		version, _, err := repository.GetVersion(ctx, "deleted")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), version)
+	})
+}
@@ -0,0 +1,29 @@
+package keys
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"users-api/internal/tokenizers"
+)
+
+type Tokenizer interface {
+	JWKS() tokenizers.JWKS
+}
+
+type Controller struct {
+	tokenizer Tokenizer
+}
+
+func NewController(tokenizer Tokenizer) Controller {
+	return Controller{
+		tokenizer: tokenizer,
+	}
+}
+
+// JWKS publishes the public keys the tokens can be verified with, so other services don't need
+// any secret to verify them
+func (controller Controller) JWKS(c *gin.Context) {
+	// Let verifiers cache the keys for a while, they fetch them again on unknown key IDs
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, controller.tokenizer.JWKS())
+}
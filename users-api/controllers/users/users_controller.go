@@ -6,13 +6,14 @@ import (
 	"net/http"
 	"strconv"
 	domain "users-api/domain/users"
+	"users-api/middlewares/auth"
 )
 
 type Service interface {
 	GetAll() ([]domain.User, error)
 	GetByID(id int64) (domain.User, error)
-	Create(user domain.User) (int64, error)
-	Update(user domain.User) error
+	Create(request domain.CreateRequest) (int64, error)
+	Update(id int64, request domain.UpdateRequest) (domain.User, error)
 	Delete(id int64) error
 	Login(username string, password string) (domain.LoginResponse, error)
 }
@@ -65,18 +66,45 @@ func (controller Controller) GetByID(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// Me returns the user the bearer token was issued to, along with its roles
+func (controller Controller) Me(c *gin.Context) {
+	// Get the authenticated user from the request context
+	claims, ok := auth.FromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "missing bearer token",
+		})
+		return
+	}
+
+	// Invoke service
+	user, err := controller.service.GetByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("user not found: %s", err.Error()),
+		})
+		return
+	}
+
+	// Send user
+	c.JSON(http.StatusOK, domain.MeResponse{
+		User:  user,
+		Roles: claims.Roles,
+	})
+}
+
 func (controller Controller) Create(c *gin.Context) {
 	// Parse user from HTTP Request
-	var user domain.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
+	var request domain.CreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("invalid request: %s", err.Error()),
 		})
 		return
 	}
 
 	// Invoke service
-	id, err := controller.service.Create(user)
+	id, err := controller.service.Create(request)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("error creating user: %s", err.Error()),
@@ -101,27 +129,33 @@ func (controller Controller) Update(c *gin.Context) {
 		return
 	}
 
+	// Users can only update themselves
+	if auth.UserID(c.Request.Context()) != id {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "users can only update themselves",
+		})
+		return
+	}
+
 	// Parse updated user data from HTTP request
-	var user domain.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var request domain.UpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("invalid request: %s", err.Error()),
 		})
 		return
 	}
 
-	// Set the ID of the user to be updated
-	user.ID = id
-
 	// Invoke service
-	if err := controller.service.Update(user); err != nil {
+	user, err := controller.service.Update(id, request)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("error updating user: %s", err.Error()),
 		})
 		return
 	}
 
-	// Send response
+	// Send the updated user, without its password
 	c.JSON(http.StatusOK, user)
 }
 
@@ -151,9 +185,9 @@ func (controller Controller) Delete(c *gin.Context) {
 }
 
 func (controller Controller) Login(c *gin.Context) {
-	// Parse user from HTTP request
-	var user domain.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	// Parse credentials from HTTP request
+	var request domain.LoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("invalid request: %s", err.Error()),
 		})
@@ -161,7 +195,7 @@ func (controller Controller) Login(c *gin.Context) {
 	}
 
 	// Invoke service
-	response, err := controller.service.Login(user.Username, user.Password)
+	response, err := controller.service.Login(request.Username, request.Password)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": fmt.Sprintf("unauthorized: %s", err.Error()),
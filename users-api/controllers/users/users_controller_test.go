@@ -0,0 +1,224 @@
+package users_test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	controllers "users-api/controllers/users"
+	dao "users-api/dao/users"
+	"users-api/internal/hashers"
+	"users-api/internal/tokenizers"
+	"users-api/middlewares/auth"
+	repositories "users-api/repositories/users"
+	services "users-api/services/users"
+)
+
+const (
+	storedHash = "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	password   = "secret-password"
+)
+
+// newRouter wires the controller over the real service, with the repositories holding password hashes
+func newRouter() (*gin.Engine, *repositories.Mock, *hashers.Mock, *tokenizers.Mock) {
+	gin.SetMode(gin.TestMode)
+	mainRepo := repositories.NewMock()
+	cacheRepo := repositories.NewMock()
+	memcachedRepo := repositories.NewMock()
+	tokenizer := tokenizers.NewMock()
+	hasher := hashers.NewMock()
+
+	// The cache and memcached always miss and accept every write
+	cacheRepo.On("GetByID", mock.Anything).Return(dao.User{}, assert.AnError)
+	cacheRepo.On("GetByUsername", mock.Anything).Return(dao.User{}, assert.AnError)
+	cacheRepo.On("Create", mock.Anything).Return(int64(0), nil)
+	cacheRepo.On("Update", mock.Anything).Return(nil)
+	memcachedRepo.On("GetByID", mock.Anything).Return(dao.User{}, assert.AnError)
+	memcachedRepo.On("GetByUsername", mock.Anything).Return(dao.User{}, assert.AnError)
+	memcachedRepo.On("Create", mock.Anything).Return(int64(0), nil)
+	memcachedRepo.On("Update", mock.Anything).Return(nil)
+
+	// Only the test token is valid, it belongs to user1
+	tokenizer.On("ValidateToken", "token").Return(tokenizers.Claims{UserID: 1, Username: "user1", Roles: []string{}}, nil)
+	tokenizer.On("ValidateToken", mock.Anything).Return(tokenizers.Claims{}, assert.AnError)
+
+	controller := controllers.NewController(services.NewService(mainRepo, cacheRepo, memcachedRepo, tokenizer, hasher, map[string]services.Verifier{
+		hashers.Argon2idPrefix: hasher,
+	}))
+	authMiddleware := auth.NewMiddleware(tokenizer)
+	router := gin.New()
+	router.GET("/users", controller.GetAll)
+	router.GET("/users/:id", controller.GetByID)
+	router.POST("/users", controller.Create)
+	router.PUT("/users/:id", authMiddleware.Authenticate, controller.Update)
+	router.POST("/login", controller.Login)
+	router.GET("/auth/me", authMiddleware.Authenticate, controller.Me)
+	return router, mainRepo, hasher, tokenizer
+}
+
+func serve(router *gin.Engine, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// assertNoCredentials fails when the response body carries a password field or any credential material
+func assertNoCredentials(t *testing.T, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+	body := recorder.Body.String()
+	assert.NotContains(t, strings.ToLower(body), "password")
+	assert.NotContains(t, body, storedHash)
+	assert.NotContains(t, body, password)
+	assert.NotContains(t, body, "$argon2id$")
+}
+
+func TestController(t *testing.T) {
+	t.Run("GetAll - No credentials", func(t *testing.T) {
+		router, mainRepo, _, _ := newRouter()
+		mainRepo.On("GetAll").Return([]dao.User{
+			{ID: 1, Username: "user1", Password: storedHash},
+			{ID: 2, Username: "user2", Password: storedHash},
+		}, nil).Once()
+
+		recorder := serve(router, http.MethodGet, "/users", "", "")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `[{"id":1,"username":"user1"},{"id":2,"username":"user2"}]`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("GetByID - No credentials", func(t *testing.T) {
+		router, mainRepo, _, _ := newRouter()
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+
+		recorder := serve(router, http.MethodGet, "/users/1", "", "")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"username":"user1"}`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Create - No credentials", func(t *testing.T) {
+		router, mainRepo, hasher, _ := newRouter()
+		hasher.On("Hash", password).Return(storedHash, nil).Once()
+		mainRepo.On("Create", dao.User{Username: "user1", Password: storedHash}).Return(int64(1), nil).Once()
+
+		recorder := serve(router, http.MethodPost, "/users", `{"username":"user1","password":"`+password+`"}`, "")
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.JSONEq(t, `{"id":1}`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Create - Missing password", func(t *testing.T) {
+		router, _, _, _ := newRouter()
+
+		recorder := serve(router, http.MethodPost, "/users", `{"username":"user1"}`, "")
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Update - No credentials", func(t *testing.T) {
+		router, mainRepo, hasher, _ := newRouter()
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+		hasher.On("Hash", password).Return(storedHash, nil).Once()
+		mainRepo.On("Update", dao.User{ID: 1, Username: "user1", Password: storedHash}).Return(nil).Once()
+
+		recorder := serve(router, http.MethodPut, "/users/1", `{"username":"user1","password":"`+password+`"}`, "token")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"username":"user1"}`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Update - Keeps password", func(t *testing.T) {
+		router, mainRepo, _, _ := newRouter()
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+		mainRepo.On("Update", dao.User{ID: 1, Username: "renamed", Password: storedHash}).Return(nil).Once()
+
+		recorder := serve(router, http.MethodPut, "/users/1", `{"username":"renamed"}`, "token")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"username":"renamed"}`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Login - No credentials", func(t *testing.T) {
+		router, mainRepo, hasher, tokenizer := newRouter()
+		mainRepo.On("GetByUsername", "user1").Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+		hasher.On("Verify", password, storedHash).Return(true, nil).Once()
+		hasher.On("NeedsRehash", storedHash).Return(false).Once()
+		tokenizer.On("GenerateToken", "user1", int64(1), []string{}).Return("token", nil).Once()
+
+		recorder := serve(router, http.MethodPost, "/login", `{"username":"user1","password":"`+password+`"}`, "")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, map[string]interface{}{"user_id": float64(1), "username": "user1", "token": "token"}, response)
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Login - Invalid credentials", func(t *testing.T) {
+		router, mainRepo, hasher, _ := newRouter()
+		mainRepo.On("GetByUsername", "user1").Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+		hasher.On("Verify", "wrong", storedHash).Return(false, nil).Once()
+
+		recorder := serve(router, http.MethodPost, "/login", `{"username":"user1","password":"wrong"}`, "")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Update - Missing token", func(t *testing.T) {
+		router, _, _, _ := newRouter()
+
+		recorder := serve(router, http.MethodPut, "/users/1", `{"username":"renamed"}`, "")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Update - Invalid token", func(t *testing.T) {
+		router, _, _, _ := newRouter()
+
+		recorder := serve(router, http.MethodPut, "/users/1", `{"username":"renamed"}`, "forged")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Update - Another user", func(t *testing.T) {
+		router, _, _, _ := newRouter()
+
+		recorder := serve(router, http.MethodPut, "/users/2", `{"username":"renamed"}`, "token")
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("Me - Success", func(t *testing.T) {
+		router, mainRepo, _, _ := newRouter()
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: storedHash}, nil).Once()
+
+		recorder := serve(router, http.MethodGet, "/auth/me", "", "token")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"username":"user1","roles":[]}`, recorder.Body.String())
+		assertNoCredentials(t, recorder)
+	})
+
+	t.Run("Me - Missing token", func(t *testing.T) {
+		router, _, _, _ := newRouter()
+
+		recorder := serve(router, http.MethodGet, "/auth/me", "", "")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
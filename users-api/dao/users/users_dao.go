@@ -4,4 +4,5 @@ type User struct {
 	ID       int64  `gorm:"primaryKey;autoIncrement"`                    // Auto-increment primary key
 	Username string `gorm:"size:100;not null;unique" binding:"required"` // Unique username, required
 	Password string `gorm:"size:255;not null" binding:"required"`        // Password field, required
+	Roles    string `gorm:"size:255;not null;default:''"`                // Comma separated roles, granted in the database
 }
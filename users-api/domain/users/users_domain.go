@@ -1,9 +1,24 @@
 package users
 
+// User is the public view of a user, it never carries credentials
 type User struct {
 	ID       int64  `json:"id"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+}
+
+type CreateRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UpdateRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password"` // The current password is kept when empty
+}
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
 type LoginResponse struct {
@@ -11,3 +26,9 @@ type LoginResponse struct {
 	Username string `json:"username"`
 	Token    string `json:"token"`
 }
+
+// MeResponse describes the authenticated user
+type MeResponse struct {
+	User
+	Roles []string `json:"roles"`
+}
@@ -0,0 +1,116 @@
+package hashers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// Argon2idPrefix starts every argon2id hash
+const Argon2idPrefix = "$argon2id$"
+
+type Argon2idConfig struct {
+	Memory      uint32 // Memory used in KiB
+	Iterations  uint32 // Passes over the memory
+	Parallelism uint8  // Threads used
+	SaltLength  uint32 // Random salt length in bytes
+	KeyLength   uint32 // Derived key length in bytes
+}
+
+// Argon2id hashes passwords into the PHC string format, which encodes the parameters along
+// with the salt and key, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type Argon2id struct {
+	config Argon2idConfig
+}
+
+// argon2idHash is a decoded argon2id hash
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func NewArgon2id(config Argon2idConfig) Argon2id {
+	return Argon2id{
+		config: config,
+	}
+}
+
+func (hasher Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.config.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, hasher.config.Iterations, hasher.config.Memory, hasher.config.Parallelism, hasher.config.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		hasher.config.Memory,
+		hasher.config.Iterations,
+		hasher.config.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify hashes the password with the parameters encoded in the hash, so hashes made with
+// previous parameters keep working
+func (hasher Argon2id) Verify(password string, hash string) (bool, error) {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), decoded.salt, decoded.iterations, decoded.memory, decoded.parallelism, uint32(len(decoded.key)))
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+}
+
+// NeedsRehash tells whether the hash isn't argon2id or was made with other parameters
+func (hasher Argon2id) NeedsRehash(hash string) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return decoded.memory != hasher.config.Memory ||
+		decoded.iterations != hasher.config.Iterations ||
+		decoded.parallelism != hasher.config.Parallelism ||
+		uint32(len(decoded.salt)) != hasher.config.SaltLength ||
+		uint32(len(decoded.key)) != hasher.config.KeyLength
+}
+
+func decodeArgon2id(hash string) (argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return argon2idHash{}, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var decoded argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.iterations, &decoded.parallelism); err != nil {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	if decoded.iterations == 0 || decoded.parallelism == 0 || len(salt) == 0 || len(key) == 0 {
+		return argon2idHash{}, fmt.Errorf("invalid argon2id hash")
+	}
+	decoded.salt, decoded.key = salt, key
+	return decoded, nil
+}
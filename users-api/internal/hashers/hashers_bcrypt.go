@@ -0,0 +1,53 @@
+package hashers
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// BcryptPrefix starts every bcrypt hash, whatever its minor version
+const BcryptPrefix = "$2"
+
+type BcryptConfig struct {
+	Cost int // Work factor, each increment doubles the hashing time
+}
+
+type Bcrypt struct {
+	config BcryptConfig
+}
+
+func NewBcrypt(config BcryptConfig) Bcrypt {
+	return Bcrypt{
+		config: config,
+	}
+}
+
+func (hasher Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.config.Cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password with bcrypt: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (hasher Bcrypt) Verify(password string, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error verifying bcrypt hash: %w", err)
+	}
+	return true, nil
+}
+
+// NeedsRehash tells whether the hash isn't bcrypt or was made with another cost
+func (hasher Bcrypt) NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, BcryptPrefix) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != hasher.config.Cost
+}
@@ -0,0 +1,26 @@
+package hashers
+
+import "github.com/stretchr/testify/mock"
+
+type Mock struct {
+	mock.Mock
+}
+
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+func (m *Mock) Hash(password string) (string, error) {
+	args := m.Called(password)
+	return args.String(0), args.Error(1)
+}
+
+func (m *Mock) Verify(password string, hash string) (bool, error) {
+	args := m.Called(password, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *Mock) NeedsRehash(hash string) bool {
+	args := m.Called(hash)
+	return args.Bool(0)
+}
@@ -0,0 +1,147 @@
+package hashers_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+	"users-api/internal/hashers"
+)
+
+// hasher is what the users service needs from a password hasher
+type hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// Cheap parameters so the tests run fast, the PHC format is the same
+var argon2idConfig = hashers.Argon2idConfig{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		name    string
+		hasher  hasher
+		changed hasher // Same hasher with other parameters
+		prefix  string
+		other   string // Hash of another format
+	}{
+		{
+			name:    "Argon2id",
+			hasher:  hashers.NewArgon2id(argon2idConfig),
+			changed: hashers.NewArgon2id(hashers.Argon2idConfig{Memory: 2048, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}),
+			prefix:  hashers.Argon2idPrefix,
+			other:   "$2a$04$abcdefghijklmnopqrstuuJ4aCp1X3Gqh2JgIq6Y0O6QWfA2wRIS.",
+		},
+		{
+			name:    "Bcrypt",
+			hasher:  hashers.NewBcrypt(hashers.BcryptConfig{Cost: bcrypt.MinCost}),
+			changed: hashers.NewBcrypt(hashers.BcryptConfig{Cost: bcrypt.MinCost + 1}),
+			prefix:  hashers.BcryptPrefix,
+			other:   "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+" - Verify", func(t *testing.T) {
+			hash, err := test.hasher.Hash("password")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, test.prefix))
+
+			valid, err := test.hasher.Verify("password", hash)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+
+			valid, err = test.hasher.Verify("wrong-password", hash)
+			assert.NoError(t, err)
+			assert.False(t, valid)
+		})
+
+		t.Run(test.name+" - Salted", func(t *testing.T) {
+			first, err := test.hasher.Hash("password")
+			require.NoError(t, err)
+			second, err := test.hasher.Hash("password")
+			require.NoError(t, err)
+			assert.NotEqual(t, first, second)
+		})
+
+		t.Run(test.name+" - NeedsRehash", func(t *testing.T) {
+			hash, err := test.hasher.Hash("password")
+			require.NoError(t, err)
+			assert.False(t, test.hasher.NeedsRehash(hash))
+
+			// Hashes made before a parameter change still verify, but are upgraded
+			assert.True(t, test.changed.NeedsRehash(hash))
+			valid, err := test.changed.Verify("password", hash)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+
+			assert.True(t, test.hasher.NeedsRehash(test.other))
+			assert.True(t, test.hasher.NeedsRehash(""))
+		})
+	}
+}
+
+func TestArgon2id_Encoding(t *testing.T) {
+	hasher := hashers.NewArgon2id(argon2idConfig)
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+
+	// $argon2id$v=19$m=1024,t=1,p=1$<salt>$<key>, unpadded standard base64
+	parts := strings.Split(hash, "$")
+	require.Len(t, parts, 6)
+	assert.Equal(t, fmt.Sprintf("v=%d", argon2.Version), parts[2])
+	assert.Equal(t, "m=1024,t=1,p=1", parts[3])
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	require.NoError(t, err)
+	assert.Len(t, salt, 16)
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	require.NoError(t, err)
+	assert.Equal(t, argon2.IDKey([]byte("password"), salt, 1, 1024, 1, 32), key)
+
+	// A hash made elsewhere with the same encoding is verified with its own parameters
+	other := fmt.Sprintf("$argon2id$v=19$m=2048,t=3,p=2$%s$%s",
+		base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef")),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("password"), []byte("0123456789abcdef"), 3, 2048, 2, 16)))
+	valid, err := hasher.Verify("password", other)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.True(t, hasher.NeedsRehash(other))
+}
+
+func TestArgon2id_InvalidHash(t *testing.T) {
+	hasher := hashers.NewArgon2id(argon2idConfig)
+	tests := map[string]string{
+		"Not Argon2id":    "$2a$04$abcdefghijklmnopqrstuuJ4aCp1X3Gqh2JgIq6Y0O6QWfA2wRIS.",
+		"Missing Parts":   "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"Other Version":   "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"Bad Parameters":  "$argon2id$v=19$m=big,t=1,p=1$c2FsdA$a2V5",
+		"Zero Iterations": "$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5",
+		"Bad Salt":        "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+		"Bad Key":         "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$!!!",
+		"Empty Key":       "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+		"Padded Salt":     "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA==$a2V5",
+	}
+
+	for name, hash := range tests {
+		t.Run(name, func(t *testing.T) {
+			valid, err := hasher.Verify("password", hash)
+			assert.Error(t, err)
+			assert.False(t, valid)
+			assert.True(t, hasher.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestBcrypt_InvalidHash(t *testing.T) {
+	hasher := hashers.NewBcrypt(hashers.BcryptConfig{Cost: bcrypt.MinCost})
+
+	valid, err := hasher.Verify("password", "$2a$04$truncated")
+	assert.Error(t, err)
+	assert.False(t, valid)
+}
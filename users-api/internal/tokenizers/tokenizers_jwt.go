@@ -1,38 +1,163 @@
 package tokenizers
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"strconv"
 	"time"
 )
 import _ "github.com/go-sql-driver/mysql"
 
 type JWTConfig struct {
-	Key      string
-	Duration time.Duration
+	SigningKey       crypto.Signer      // Signs RS256 tokens when it's an *rsa.PrivateKey, EdDSA ones when it's an ed25519.PrivateKey
+	VerificationKeys []crypto.PublicKey // Retired public keys, still accepted until the tokens they signed expire
+	Issuer           string             // Issuer of the tokens, the iss claim
+	Audience         string             // Services the tokens are meant for, the aud claim
+	Duration         time.Duration      // Tokens expire this long after being issued
+	Leeway           time.Duration      // Clock skew tolerated when checking exp, nbf and iat
+}
+
+// Claims identify the user a token was issued to
+type Claims struct {
+	UserID   int64
+	Username string
+	Roles    []string // Roles granted to the user, empty unless the token carries a roles claim
+}
+
+// jwtClaims are the registered claims along with the user ones
+type jwtClaims struct {
+	Username string   `json:"username"`
+	UserID   int64    `json:"user_id"`
+	Roles    []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
 }
 
 type JWT struct {
 	config JWTConfig
+	method jwt.SigningMethod
+	keyID  string                      // kid header of the issued tokens
+	keys   map[string]crypto.PublicKey // Verification keys by their ID
+	jwks   JWKS
 }
 
 func NewTokenizer(config JWTConfig) JWT {
+	var method jwt.SigningMethod
+	switch config.SigningKey.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		log.Fatalf("unsupported JWT signing key type %T, only RSA and Ed25519 keys are supported", config.SigningKey)
+	}
+
+	// The signing key is published first, followed by the retired ones
+	keys := make(map[string]crypto.PublicKey)
+	jwks := JWKS{Keys: make([]JWK, 0)}
+	for _, publicKey := range append([]crypto.PublicKey{config.SigningKey.Public()}, config.VerificationKeys...) {
+		jwk, err := newJWK(publicKey)
+		if err != nil {
+			log.Fatalf("error publishing JWT verification key: %s", err.Error())
+		}
+		keys[jwk.KeyID] = publicKey
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
 	return JWT{
 		config: config,
+		method: method,
+		keyID:  jwks.Keys[0].KeyID,
+		keys:   keys,
+		jwks:   jwks,
 	}
 }
 
-func (tokenizer JWT) GenerateToken(username string, userID int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username":        username,
-		"user_id":         userID,
-		"expiration_date": time.Now().UTC().Add(tokenizer.config.Duration),
+func (tokenizer JWT) GenerateToken(username string, userID int64, roles []string) (string, error) {
+	// Random token ID
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating JWT token ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(tokenizer.method, jwtClaims{
+		Username: username,
+		UserID:   userID,
+		Roles:    roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenizer.config.Issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{tokenizer.config.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenizer.config.Duration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        hex.EncodeToString(id),
+		},
 	})
+	token.Header["kid"] = tokenizer.keyID
 
-	value, err := token.SignedString([]byte(tokenizer.config.Key))
+	value, err := token.SignedString(tokenizer.config.SigningKey)
 	if err != nil {
 		return "", fmt.Errorf("error generating JWT token: %w", err)
 	}
 
 	return value, nil
 }
+
+// ValidateToken verifies the signature, issuer, audience and validity window of a token and
+// returns its claims
+func (tokenizer JWT) ValidateToken(value string) (Claims, error) {
+	claims := jwtClaims{}
+	_, err := jwt.ParseWithClaims(value, &claims, tokenizer.verificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(tokenizer.config.Issuer),
+		jwt.WithAudience(tokenizer.config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenizer.config.Leeway),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error parsing JWT token: %w", err)
+	}
+	return parseClaims(claims)
+}
+
+// JWKS returns the public keys the tokens can be verified with
+func (tokenizer JWT) JWKS() JWKS {
+	return tokenizer.jwks
+}
+
+// verificationKey picks the public key named by the kid header of the token
+func (tokenizer JWT) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	key, ok := tokenizer.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", keyID)
+	}
+	return key, nil
+}
+
+// parseClaims extracts the user from the token claims
+func parseClaims(claims jwtClaims) (Claims, error) {
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid sub claim: %w", err)
+	}
+
+	roles := claims.Roles
+	if roles == nil {
+		roles = make([]string, 0)
+	}
+
+	return Claims{
+		UserID:   userID,
+		Username: claims.Username,
+		Roles:    roles,
+	}, nil
+}
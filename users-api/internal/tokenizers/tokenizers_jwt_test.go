@@ -0,0 +1,305 @@
+package tokenizers_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"users-api/internal/tokenizers"
+)
+
+var (
+	// Create keys
+	signingKey = newEd25519Key()
+	retiredKey = newRSAKey()
+	config     = tokenizers.JWTConfig{
+		SigningKey:       signingKey,
+		VerificationKeys: []crypto.PublicKey{retiredKey.Public()},
+		Issuer:           "users-api",
+		Audience:         "hotels",
+		Duration:         time.Hour,
+		Leeway:           30 * time.Second,
+	}
+)
+
+func newEd25519Key() ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func newRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// keyID returns the ID the tokenizer publishes a key with
+func keyID(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	for _, jwk := range tokenizers.NewTokenizer(tokenizers.JWTConfig{SigningKey: key}).JWKS().Keys {
+		return jwk.KeyID
+	}
+	t.Fatal("no key published")
+	return ""
+}
+
+// sign issues a token with arbitrary claims, the way a misconfigured or malicious issuer would
+func sign(t *testing.T, key crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+	method := jwt.SigningMethod(jwt.SigningMethodEdDSA)
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		method = jwt.SigningMethodRS256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = keyID(t, key)
+	value, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return value
+}
+
+// validClaims are the claims of a token issued now by the test configuration
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":      "users-api",
+		"aud":      []string{"hotels"},
+		"sub":      "1",
+		"iat":      now.Unix(),
+		"nbf":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+		"jti":      "token-id",
+		"username": "user1",
+		"user_id":  1,
+	}
+}
+
+func TestJWT(t *testing.T) {
+	tokenizer := tokenizers.NewTokenizer(config)
+
+	t.Run("Registered claims", func(t *testing.T) {
+		value, err := tokenizer.GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+
+		claims := jwt.MapClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(value, claims)
+		assert.NoError(t, err)
+		assert.Equal(t, "users-api", claims["iss"])
+		assert.Equal(t, []interface{}{"hotels"}, claims["aud"])
+		assert.Equal(t, "1", claims["sub"])
+		assert.NotEmpty(t, claims["jti"])
+		for _, claim := range []string{"exp", "iat", "nbf"} {
+			assert.IsType(t, float64(0), claims[claim], claim)
+		}
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), claims["exp"], 5)
+		assert.NotContains(t, claims, "expiration_date")
+	})
+
+	t.Run("Unique token IDs", func(t *testing.T) {
+		first, err := tokenizer.GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+		second, err := tokenizer.GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		value, err := tokenizer.GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+
+		claims, err := tokenizer.ValidateToken(value)
+
+		assert.NoError(t, err)
+		assert.Equal(t, tokenizers.Claims{UserID: 1, Username: "user1", Roles: []string{}}, claims)
+	})
+
+	t.Run("Round trip - Roles", func(t *testing.T) {
+		value, err := tokenizer.GenerateToken("admin1", 2, []string{"admin"})
+		assert.NoError(t, err)
+
+		claims, err := tokenizer.ValidateToken(value)
+
+		assert.NoError(t, err)
+		assert.Equal(t, tokenizers.Claims{UserID: 2, Username: "admin1", Roles: []string{"admin"}}, claims)
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		token := validClaims()
+		token["roles"] = []string{"admin"}
+
+		claims, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"admin"}, claims.Roles)
+	})
+
+	t.Run("Expired within leeway", func(t *testing.T) {
+		token := validClaims()
+		token["exp"] = time.Now().Add(-10 * time.Second).Unix()
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		token := validClaims()
+		token["exp"] = time.Now().Add(-time.Minute).Unix()
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	})
+
+	t.Run("Expired by configuration", func(t *testing.T) {
+		expired := config
+		expired.Duration = -time.Minute
+		value, err := tokenizers.NewTokenizer(expired).GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+
+		_, err = tokenizer.ValidateToken(value)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	})
+
+	t.Run("Missing expiration", func(t *testing.T) {
+		token := validClaims()
+		delete(token, "exp")
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenRequiredClaimMissing)
+	})
+
+	t.Run("Legacy expiration_date claim", func(t *testing.T) {
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, jwt.MapClaims{
+			"username":        "user1",
+			"user_id":         1,
+			"expiration_date": time.Now().Add(time.Hour),
+		}))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Not valid yet", func(t *testing.T) {
+		token := validClaims()
+		token["nbf"] = time.Now().Add(time.Minute).Unix()
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenNotValidYet)
+	})
+
+	t.Run("Wrong issuer", func(t *testing.T) {
+		token := validClaims()
+		token["iss"] = "someone-else"
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+	})
+
+	t.Run("Wrong audience", func(t *testing.T) {
+		token := validClaims()
+		token["aud"] = []string{"another-platform"}
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+	})
+
+	t.Run("Retired key", func(t *testing.T) {
+		claims, err := tokenizer.ValidateToken(sign(t, retiredKey, validClaims()))
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), claims.UserID)
+	})
+
+	t.Run("RS256 signing key", func(t *testing.T) {
+		rotated := config
+		rotated.SigningKey = retiredKey
+		rotated.VerificationKeys = []crypto.PublicKey{signingKey.Public()}
+		value, err := tokenizers.NewTokenizer(rotated).GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+
+		token, _, err := jwt.NewParser().ParseUnverified(value, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "RS256", token.Header["alg"])
+
+		// Tokens signed before the rotation are still accepted by both
+		_, err = tokenizers.NewTokenizer(rotated).ValidateToken(sign(t, signingKey, validClaims()))
+		assert.NoError(t, err)
+		_, err = tokenizer.ValidateToken(value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		_, err := tokenizer.ValidateToken(sign(t, newEd25519Key(), validClaims()))
+
+		assert.ErrorIs(t, err, jwt.ErrTokenUnverifiable)
+	})
+
+	t.Run("Missing key ID", func(t *testing.T) {
+		value, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, validClaims()).SignedString(signingKey)
+		assert.NoError(t, err)
+
+		_, err = tokenizer.ValidateToken(value)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenUnverifiable)
+	})
+
+	t.Run("Symmetric token signed with the public key", func(t *testing.T) {
+		publicKey, err := x509.MarshalPKIXPublicKey(signingKey.Public())
+		assert.NoError(t, err)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+		token.Header["kid"] = keyID(t, signingKey)
+		value, err := token.SignedString(publicKey)
+		assert.NoError(t, err)
+
+		_, err = tokenizer.ValidateToken(value)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		jwks := tokenizer.JWKS()
+
+		assert.Len(t, jwks.Keys, 2)
+		assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+		assert.Equal(t, "Ed25519", jwks.Keys[0].Curve)
+		assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+		assert.Equal(t, keyID(t, signingKey), jwks.Keys[0].KeyID)
+		assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+		assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+		assert.Equal(t, "AQAB", jwks.Keys[1].E)
+		for _, jwk := range jwks.Keys {
+			assert.Equal(t, "sig", jwk.Use)
+			assert.NotEmpty(t, jwk.KeyID)
+		}
+
+		value, err := tokenizer.GenerateToken("user1", 1, nil)
+		assert.NoError(t, err)
+		token, _, err := jwt.NewParser().ParseUnverified(value, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "EdDSA", token.Header["alg"])
+		assert.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+	})
+
+	t.Run("Invalid subject", func(t *testing.T) {
+		token := validClaims()
+		token["sub"] = "user1"
+
+		_, err := tokenizer.ValidateToken(sign(t, signingKey, token))
+
+		assert.Error(t, err)
+	})
+}
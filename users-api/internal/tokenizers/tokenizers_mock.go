@@ -10,7 +10,12 @@ func NewMock() *Mock {
 	return &Mock{}
 }
 
-func (m *Mock) GenerateToken(username string, userID int64) (string, error) {
-	args := m.Called(username, userID)
+func (m *Mock) GenerateToken(username string, userID int64, roles []string) (string, error) {
+	args := m.Called(username, userID, roles)
 	return args.String(0), args.Error(1)
 }
+
+func (m *Mock) ValidateToken(token string) (Claims, error) {
+	args := m.Called(token)
+	return args.Get(0).(Claims), args.Error(1)
+}
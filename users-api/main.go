@@ -1,11 +1,19 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"github.com/gin-gonic/gin"
 	"log"
+	"os"
+	"strings"
 	"time"
+	keysControllers "users-api/controllers/keys"
 	controllers "users-api/controllers/users"
+	"users-api/internal/hashers"
 	"users-api/internal/tokenizers"
+	"users-api/middlewares/auth"
 	repositories "users-api/repositories/users"
 	services "users-api/services/users"
 )
@@ -33,19 +41,75 @@ func main() {
 		Port: "11211",
 	})
 
+	// Token signing key, a PEM private key in JWT_SIGNING_KEY or an ephemeral Ed25519 key otherwise
+	var signingKey crypto.Signer
+	if path := os.Getenv("JWT_SIGNING_KEY"); path != "" {
+		key, err := tokenizers.LoadPrivateKey(path)
+		if err != nil {
+			log.Fatalf("Error loading JWT signing key: %v", err)
+		}
+		signingKey = key
+	} else {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatalf("Error generating JWT signing key: %v", err)
+		}
+		log.Println("JWT_SIGNING_KEY is not set, tokens are signed with an ephemeral key and won't survive a restart")
+		signingKey = key
+	}
+
+	// Retired public keys, comma separated PEM files in JWT_VERIFICATION_KEYS
+	verificationKeys := make([]crypto.PublicKey, 0)
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		key, err := tokenizers.LoadPublicKey(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("Error loading JWT verification key: %v", err)
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
 	// Tokenizer
 	jwtTokenizer := tokenizers.NewTokenizer(
 		tokenizers.JWTConfig{
-			Key:      "ThisIsAnExampleJWTKey!",
-			Duration: 1 * time.Hour,
+			SigningKey:       signingKey,
+			VerificationKeys: verificationKeys,
+			Issuer:           "users-api",
+			Audience:         "hotels",
+			Duration:         1 * time.Hour,
+			Leeway:           30 * time.Second,
+		},
+	)
+
+	// Password hasher, argon2id with the OWASP recommended parameters
+	hasher := hashers.NewArgon2id(
+		hashers.Argon2idConfig{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
 		},
 	)
 
+	// Stored hashes are verified by their format, whichever hasher made them, and upgraded
+	// to the hasher above on login
+	verifiers := map[string]services.Verifier{
+		hashers.Argon2idPrefix: hasher,
+		hashers.BcryptPrefix:   hashers.NewBcrypt(hashers.BcryptConfig{Cost: 12}),
+	}
+
 	// Services
-	service := services.NewService(mySQLRepo, cacheRepo, memcachedRepo, jwtTokenizer)
+	service := services.NewService(mySQLRepo, cacheRepo, memcachedRepo, jwtTokenizer, hasher, verifiers)
 
 	// Handlers
 	controller := controllers.NewController(service)
+	keysController := keysControllers.NewController(jwtTokenizer)
+
+	// Middlewares
+	authMiddleware := auth.NewMiddleware(jwtTokenizer)
 
 	// Create router
 	router := gin.Default()
@@ -54,8 +118,10 @@ func main() {
 	router.GET("/users", controller.GetAll)
 	router.GET("/users/:id", controller.GetByID)
 	router.POST("/users", controller.Create)
-	router.PUT("/users/:id", controller.Update)
+	router.PUT("/users/:id", authMiddleware.Authenticate, controller.Update)
 	router.POST("/login", controller.Login)
+	router.GET("/auth/me", authMiddleware.Authenticate, controller.Me)
+	router.GET("/.well-known/jwks.json", keysController.JWKS)
 
 	// Run application
 	if err := router.Run(":8080"); err != nil {
@@ -2,8 +2,11 @@ package users
 
 import (
 	"crypto/md5"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
+	"log"
+	"strings"
 	dao "users-api/dao/users"
 	domain "users-api/domain/users"
 )
@@ -18,7 +21,17 @@ type Repository interface {
 }
 
 type Tokenizer interface {
-	GenerateToken(username string, userID int64) (string, error)
+	GenerateToken(username string, userID int64, roles []string) (string, error)
+}
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+type Verifier interface {
+	Verify(password string, hash string) (bool, error)
 }
 
 type Service struct {
@@ -26,14 +39,20 @@ type Service struct {
 	cacheRepository     Repository
 	memcachedRepository Repository
 	tokenizer           Tokenizer
+	hasher              Hasher
+	verifiers           map[string]Verifier
 }
 
-func NewService(mainRepository, cacheRepository, memcachedRepository Repository, tokenizer Tokenizer) Service {
+// NewService hashes the passwords with the hasher, and verifies the stored hashes with the
+// verifier of their prefix, so hashes made before switching hashers keep working
+func NewService(mainRepository, cacheRepository, memcachedRepository Repository, tokenizer Tokenizer, hasher Hasher, verifiers map[string]Verifier) Service {
 	return Service{
 		mainRepository:      mainRepository,
 		cacheRepository:     cacheRepository,
 		memcachedRepository: memcachedRepository,
 		tokenizer:           tokenizer,
+		hasher:              hasher,
+		verifiers:           verifiers,
 	}
 }
 
@@ -45,11 +64,7 @@ func (service Service) GetAll() ([]domain.User, error) {
 
 	result := make([]domain.User, 0)
 	for _, user := range users {
-		result = append(result, domain.User{
-			ID:       user.ID,
-			Username: user.Username,
-			Password: user.Password,
-		})
+		result = append(result, service.convertUser(user))
 	}
 
 	return result, nil
@@ -121,12 +136,15 @@ func (service Service) GetByUsername(username string) (domain.User, error) {
 	return service.convertUser(user), nil
 }
 
-func (service Service) Create(user domain.User) (int64, error) {
+func (service Service) Create(request domain.CreateRequest) (int64, error) {
 	// Hash the password
-	passwordHash := Hash(user.Password)
+	passwordHash, err := service.hasher.Hash(request.Password)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password: %w", err)
+	}
 
 	newUser := dao.User{
-		Username: user.Username,
+		Username: request.Username,
 		Password: passwordHash,
 	}
 
@@ -148,43 +166,41 @@ func (service Service) Create(user domain.User) (int64, error) {
 	return id, nil
 }
 
-func (service Service) Update(user domain.User) error {
-	// Hash the password if provided
-	var passwordHash string
-	if user.Password != "" {
-		passwordHash = Hash(user.Password)
-	} else {
-		existingUser, err := service.mainRepository.GetByID(user.ID)
+func (service Service) Update(id int64, request domain.UpdateRequest) (domain.User, error) {
+	// The roles are kept, along with the password unless a new one is provided
+	existingUser, err := service.mainRepository.GetByID(id)
+	if err != nil {
+		return domain.User{}, fmt.Errorf("error retrieving existing user: %w", err)
+	}
+	passwordHash := existingUser.Password
+	if request.Password != "" {
+		hash, err := service.hasher.Hash(request.Password)
 		if err != nil {
-			return fmt.Errorf("error retrieving existing user: %w", err)
+			return domain.User{}, fmt.Errorf("error hashing password: %w", err)
 		}
-		passwordHash = existingUser.Password
+		passwordHash = hash
 	}
 
 	// Update in main repository
-	err := service.mainRepository.Update(dao.User{
-		ID:       user.ID,
-		Username: user.Username,
+	updatedUser := dao.User{
+		ID:       id,
+		Username: request.Username,
 		Password: passwordHash,
-	})
-	if err != nil {
-		return fmt.Errorf("error updating user: %w", err)
+		Roles:    existingUser.Roles,
+	}
+	if err := service.mainRepository.Update(updatedUser); err != nil {
+		return domain.User{}, fmt.Errorf("error updating user: %w", err)
 	}
 
 	// Update in cache and memcached
-	updatedUser := dao.User{
-		ID:       user.ID,
-		Username: user.Username,
-		Password: passwordHash,
-	}
 	if err := service.cacheRepository.Update(updatedUser); err != nil {
-		return fmt.Errorf("error updating user in cache: %w", err)
+		return domain.User{}, fmt.Errorf("error updating user in cache: %w", err)
 	}
 	if err := service.memcachedRepository.Update(updatedUser); err != nil {
-		return fmt.Errorf("error updating user in memcached: %w", err)
+		return domain.User{}, fmt.Errorf("error updating user in memcached: %w", err)
 	}
 
-	return nil
+	return service.convertUser(updatedUser), nil
 }
 
 func (service Service) Delete(id int64) error {
@@ -206,9 +222,6 @@ func (service Service) Delete(id int64) error {
 }
 
 func (service Service) Login(username string, password string) (domain.LoginResponse, error) {
-	// Hash the password
-	passwordHash := Hash(password)
-
 	// Try to get user from cache repository first
 	user, err := service.cacheRepository.GetByUsername(username)
 	if err != nil {
@@ -236,13 +249,25 @@ func (service Service) Login(username string, password string) (domain.LoginResp
 		}
 	}
 
-	// Compare passwords
-	if user.Password != passwordHash {
+	// Compare passwords, legacy MD5 hashes are accepted until they're upgraded
+	valid, err := service.verifyPassword(password, user.Password)
+	if err != nil {
+		return domain.LoginResponse{}, fmt.Errorf("error verifying password: %w", err)
+	}
+	if !valid {
 		return domain.LoginResponse{}, fmt.Errorf("invalid credentials")
 	}
 
+	// Upgrade legacy and outdated hashes now that the password is known, the login
+	// goes on if it fails and the upgrade is tried again on the next one
+	if isLegacyHash(user.Password) || service.hasher.NeedsRehash(user.Password) {
+		if err := service.rehash(user, password); err != nil {
+			log.Printf("error upgrading password hash of user %d: %v", user.ID, err)
+		}
+	}
+
 	// Generate token
-	token, err := service.tokenizer.GenerateToken(user.Username, user.ID)
+	token, err := service.tokenizer.GenerateToken(user.Username, user.ID, parseRoles(user.Roles))
 	if err != nil {
 		return domain.LoginResponse{}, fmt.Errorf("error generating token: %w", err)
 	}
@@ -255,15 +280,66 @@ func (service Service) Login(username string, password string) (domain.LoginResp
 	}, nil
 }
 
-func Hash(input string) string {
-	hash := md5.Sum([]byte(input))
-	return hex.EncodeToString(hash[:])
+// verifyPassword checks the password against the stored hash with the verifier of its
+// format, legacy MD5 hashes included
+func (service Service) verifyPassword(password string, hash string) (bool, error) {
+	if isLegacyHash(hash) {
+		legacyHash := md5.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(legacyHash[:])), []byte(hash)) == 1, nil
+	}
+	for prefix, verifier := range service.verifiers {
+		if strings.HasPrefix(hash, prefix) {
+			return verifier.Verify(password, hash)
+		}
+	}
+	return false, fmt.Errorf("unknown password hash format")
+}
+
+// rehash stores the password hashed with the current hasher
+func (service Service) rehash(user dao.User, password string) error {
+	hash, err := service.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	user.Password = hash
+
+	if err := service.mainRepository.Update(user); err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	if err := service.cacheRepository.Update(user); err != nil {
+		return fmt.Errorf("error updating user in cache: %w", err)
+	}
+	if err := service.memcachedRepository.Update(user); err != nil {
+		return fmt.Errorf("error updating user in memcached: %w", err)
+	}
+	return nil
+}
+
+// isLegacyHash tells whether the hash is an unsalted MD5 hex digest, as stored before the
+// adaptive hashers
+func isLegacyHash(hash string) bool {
+	if len(hash) != hex.EncodedLen(md5.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// parseRoles splits the comma separated roles of a user
+func parseRoles(roles string) []string {
+	result := make([]string, 0)
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			result = append(result, role)
+		}
+	}
+	return result
 }
 
+// convertUser converts the dao layer user to its public view, leaving the password hash out
 func (service Service) convertUser(user dao.User) domain.User {
 	return domain.User{
 		ID:       user.ID,
 		Username: user.Username,
-		Password: user.Password,
 	}
 }
@@ -1,11 +1,15 @@
 package users_test
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
 	dao "users-api/dao/users"
 	domain "users-api/domain/users"
+	"users-api/internal/hashers"
 	"users-api/internal/tokenizers"
 	repositories "users-api/repositories/users"
 	service "users-api/services/users"
@@ -17,7 +21,12 @@ var (
 	cacheRepo     = repositories.NewMock()
 	memcachedRepo = repositories.NewMock()
 	tokenizer     = tokenizers.NewMock()
-	usersService  = service.NewService(mainRepo, cacheRepo, memcachedRepo, tokenizer)
+	hasher        = hashers.NewMock()
+	bcryptHasher  = hashers.NewMock()
+	usersService  = service.NewService(mainRepo, cacheRepo, memcachedRepo, tokenizer, hasher, map[string]service.Verifier{
+		hashers.Argon2idPrefix: hasher,
+		hashers.BcryptPrefix:   bcryptHasher,
+	})
 )
 
 func TestService(t *testing.T) {
@@ -31,12 +40,15 @@ func TestService(t *testing.T) {
 		result, err := usersService.GetAll()
 
 		assert.NoError(t, err)
-		assert.Equal(t, 2, len(result))
-		assert.Equal(t, "user1", result[0].Username)
+		assert.Equal(t, []domain.User{
+			{ID: 1, Username: "user1"},
+			{ID: 2, Username: "user2"},
+		}, result)
 
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("GetAll - Error", func(t *testing.T) {
@@ -51,6 +63,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("GetByID - Success from Cache", func(t *testing.T) {
@@ -65,6 +78,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("GetByID - Not Found in Cache, Found in Memcached", func(t *testing.T) {
@@ -81,6 +95,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("GetByID - Not Found in Cache or Memcached, Found in Main Repo", func(t *testing.T) {
@@ -99,6 +114,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("GetByID - Error in Main Repo", func(t *testing.T) {
@@ -115,16 +131,18 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Create - Success", func(t *testing.T) {
-		newUser := dao.User{Username: "newuser", Password: service.Hash("password")}
+		hasher.On("Hash", "password").Return("hashed-password", nil).Once()
+		newUser := dao.User{Username: "newuser", Password: "hashed-password"}
 		mainRepo.On("Create", newUser).Return(int64(1), nil).Once()
 		newUser.ID = 1
 		cacheRepo.On("Create", newUser).Return(int64(1), nil).Once()
 		memcachedRepo.On("Create", newUser).Return(int64(1), nil).Once()
 
-		id, err := usersService.Create(domain.User{Username: "newuser", Password: "password"})
+		id, err := usersService.Create(domain.CreateRequest{Username: "newuser", Password: "password"})
 
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), id)
@@ -132,13 +150,15 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Create - Error", func(t *testing.T) {
-		newUser := dao.User{Username: "newuser", Password: service.Hash("password")}
+		hasher.On("Hash", "password").Return("hashed-password", nil).Once()
+		newUser := dao.User{Username: "newuser", Password: "hashed-password"}
 		mainRepo.On("Create", newUser).Return(int64(0), errors.New("db error")).Once()
 
-		id, err := usersService.Create(domain.User{Username: "newuser", Password: "password"})
+		id, err := usersService.Create(domain.CreateRequest{Username: "newuser", Password: "password"})
 
 		assert.Error(t, err)
 		assert.Equal(t, int64(0), id)
@@ -147,37 +167,46 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Update - Success", func(t *testing.T) {
-		updateUser := dao.User{ID: 1, Username: "updateduser", Password: service.Hash("newpassword")}
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: "hashed-password", Roles: "admin"}, nil).Once()
+		hasher.On("Hash", "newpassword").Return("hashed-newpassword", nil).Once()
+		updateUser := dao.User{ID: 1, Username: "updateduser", Password: "hashed-newpassword", Roles: "admin"}
 		mainRepo.On("Update", updateUser).Return(nil).Once()
 		cacheRepo.On("Update", updateUser).Return(nil).Once()
 		memcachedRepo.On("Update", updateUser).Return(nil).Once()
 
-		userToUpdate := domain.User{ID: 1, Username: "updateduser", Password: "newpassword"}
-		err := usersService.Update(userToUpdate)
+		request := domain.UpdateRequest{Username: "updateduser", Password: "newpassword"}
+		result, err := usersService.Update(1, request)
 
 		assert.NoError(t, err)
+		assert.Equal(t, domain.User{ID: 1, Username: "updateduser"}, result)
 
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Update - Error", func(t *testing.T) {
-		updateUser := dao.User{ID: 1, Username: "updateduser", Password: service.Hash("newpassword")}
+		mainRepo.On("GetByID", int64(1)).Return(dao.User{ID: 1, Username: "user1", Password: "hashed-password", Roles: "admin"}, nil).Once()
+		hasher.On("Hash", "newpassword").Return("hashed-newpassword", nil).Once()
+		updateUser := dao.User{ID: 1, Username: "updateduser", Password: "hashed-newpassword", Roles: "admin"}
 		mainRepo.On("Update", updateUser).Return(errors.New("db error")).Once()
 
-		userToUpdate := domain.User{ID: 1, Username: "updateduser", Password: "newpassword"}
-		err := usersService.Update(userToUpdate)
+		request := domain.UpdateRequest{Username: "updateduser", Password: "newpassword"}
+		result, err := usersService.Update(1, request)
 
 		assert.Error(t, err)
 		assert.Equal(t, "error updating user: db error", err.Error())
+		assert.Equal(t, domain.User{}, result)
 
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Delete - Success", func(t *testing.T) {
@@ -192,6 +221,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Delete - Error", func(t *testing.T) {
@@ -205,16 +235,19 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Login - Success", func(t *testing.T) {
 		username := "user1"
 		password := "password"
-		hashedPassword := service.Hash(password)
+		hashedPassword := "$argon2id$hashed-password"
 
 		mockUser := dao.User{ID: 1, Username: username, Password: hashedPassword}
 		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
-		tokenizer.On("GenerateToken", username, int64(1)).Return("token", nil).Once()
+		hasher.On("Verify", password, hashedPassword).Return(true, nil).Once()
+		hasher.On("NeedsRehash", hashedPassword).Return(false).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("token", nil).Once()
 
 		response, err := usersService.Login(username, password)
 
@@ -225,15 +258,40 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Roles", func(t *testing.T) {
+		username := "admin1"
+		password := "password"
+		hashedPassword := "$argon2id$hashed-password"
+
+		mockUser := dao.User{ID: 2, Username: username, Password: hashedPassword, Roles: "admin, support"}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+		hasher.On("Verify", password, hashedPassword).Return(true, nil).Once()
+		hasher.On("NeedsRehash", hashedPassword).Return(false).Once()
+		tokenizer.On("GenerateToken", username, int64(2), []string{"admin", "support"}).Return("token", nil).Once()
+
+		response, err := usersService.Login(username, password)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "token", response.Token)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+		tokenizer.AssertExpectations(t)
 	})
 
 	t.Run("Login - Invalid Credentials", func(t *testing.T) {
 		username := "user1"
 		password := "wrongpassword"
-		hashedPassword := service.Hash("password")
+		hashedPassword := "$argon2id$hashed-password"
 
 		mockUser := dao.User{ID: 1, Username: username, Password: hashedPassword}
 		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+		hasher.On("Verify", password, hashedPassword).Return(false, nil).Once()
 
 		response, err := usersService.Login(username, password)
 
@@ -244,6 +302,7 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Login - User Not Found", func(t *testing.T) {
@@ -263,16 +322,19 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 
 	t.Run("Login - Token Generation Error", func(t *testing.T) {
 		username := "user1"
 		password := "password"
-		hashedPassword := service.Hash(password)
+		hashedPassword := "$argon2id$hashed-password"
 
 		mockUser := dao.User{ID: 1, Username: username, Password: hashedPassword}
 		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
-		tokenizer.On("GenerateToken", username, int64(1)).Return("", errors.New("token error")).Once()
+		hasher.On("Verify", password, hashedPassword).Return(true, nil).Once()
+		hasher.On("NeedsRehash", hashedPassword).Return(false).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("", errors.New("token error")).Once()
 
 		response, err := usersService.Login(username, password)
 
@@ -283,5 +345,157 @@ func TestService(t *testing.T) {
 		mainRepo.AssertExpectations(t)
 		cacheRepo.AssertExpectations(t)
 		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Legacy Hash Upgraded", func(t *testing.T) {
+		username := "user1"
+		password := "password"
+		legacyHash := md5.Sum([]byte(password))
+
+		mockUser := dao.User{ID: 1, Username: username, Password: hex.EncodeToString(legacyHash[:])}
+		upgradedUser := dao.User{ID: 1, Username: username, Password: "hashed-password"}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+		hasher.On("Hash", password).Return("hashed-password", nil).Once()
+		mainRepo.On("Update", upgradedUser).Return(nil).Once()
+		cacheRepo.On("Update", upgradedUser).Return(nil).Once()
+		memcachedRepo.On("Update", upgradedUser).Return(nil).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("token", nil).Once()
+
+		response, err := usersService.Login(username, password)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "token", response.Token)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Legacy Hash Invalid Credentials", func(t *testing.T) {
+		username := "user1"
+		legacyHash := md5.Sum([]byte("password"))
+
+		mockUser := dao.User{ID: 1, Username: username, Password: hex.EncodeToString(legacyHash[:])}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+
+		response, err := usersService.Login(username, "wrongpassword")
+
+		assert.Error(t, err)
+		assert.Equal(t, "invalid credentials", err.Error())
+		assert.Equal(t, domain.LoginResponse{}, response)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Outdated Hash Upgrade Fails", func(t *testing.T) {
+		username := "user1"
+		password := "password"
+
+		mockUser := dao.User{ID: 1, Username: username, Password: "$argon2id$outdated-hash"}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+		hasher.On("Verify", password, "$argon2id$outdated-hash").Return(true, nil).Once()
+		hasher.On("NeedsRehash", "$argon2id$outdated-hash").Return(true).Once()
+		hasher.On("Hash", password).Return("hashed-password", nil).Once()
+		mainRepo.On("Update", dao.User{ID: 1, Username: username, Password: "hashed-password"}).Return(errors.New("db error")).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("token", nil).Once()
+
+		// The login succeeds, the upgrade is tried again on the next one
+		response, err := usersService.Login(username, password)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "token", response.Token)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Hash From Previous Hasher", func(t *testing.T) {
+		username := "user1"
+		password := "password"
+		bcryptHash := "$2a$12$previous-hash"
+
+		mockUser := dao.User{ID: 1, Username: username, Password: bcryptHash}
+		upgradedUser := dao.User{ID: 1, Username: username, Password: "$argon2id$hashed-password"}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+		bcryptHasher.On("Verify", password, bcryptHash).Return(true, nil).Once()
+		hasher.On("NeedsRehash", bcryptHash).Return(true).Once()
+		hasher.On("Hash", password).Return("$argon2id$hashed-password", nil).Once()
+		mainRepo.On("Update", upgradedUser).Return(nil).Once()
+		cacheRepo.On("Update", upgradedUser).Return(nil).Once()
+		memcachedRepo.On("Update", upgradedUser).Return(nil).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("token", nil).Once()
+
+		// The hash is verified by its own hasher and upgraded to the configured one
+		response, err := usersService.Login(username, password)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "token", response.Token)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
+		bcryptHasher.AssertExpectations(t)
+	})
+
+	t.Run("Login - Bcrypt Hash Upgraded To Argon2id", func(t *testing.T) {
+		username := "user1"
+		password := "password"
+		argon2id := hashers.NewArgon2id(hashers.Argon2idConfig{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+		bcrypt := hashers.NewBcrypt(hashers.BcryptConfig{Cost: 4})
+		bcryptHash, err := bcrypt.Hash(password)
+		assert.NoError(t, err)
+
+		// Real hashers, so the stored hash must verify with the password it was made from
+		mainRepo, cacheRepo, memcachedRepo := repositories.NewMock(), repositories.NewMock(), repositories.NewMock()
+		tokenizer := tokenizers.NewMock()
+		usersService := service.NewService(mainRepo, cacheRepo, memcachedRepo, tokenizer, argon2id, map[string]service.Verifier{
+			hashers.Argon2idPrefix: argon2id,
+			hashers.BcryptPrefix:   bcrypt,
+		})
+		upgraded := mock.MatchedBy(func(user dao.User) bool {
+			valid, err := argon2id.Verify(password, user.Password)
+			return user.ID == 1 && err == nil && valid && !argon2id.NeedsRehash(user.Password)
+		})
+		cacheRepo.On("GetByUsername", username).Return(dao.User{ID: 1, Username: username, Password: bcryptHash}, nil).Once()
+		mainRepo.On("Update", upgraded).Return(nil).Once()
+		cacheRepo.On("Update", upgraded).Return(nil).Once()
+		memcachedRepo.On("Update", upgraded).Return(nil).Once()
+		tokenizer.On("GenerateToken", username, int64(1), []string{}).Return("token", nil).Once()
+
+		response, err := usersService.Login(username, password)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "token", response.Token)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		tokenizer.AssertExpectations(t)
+	})
+
+	t.Run("Login - Unknown Hash Format", func(t *testing.T) {
+		username := "user1"
+
+		mockUser := dao.User{ID: 1, Username: username, Password: "$scrypt$unknown-hash"}
+		cacheRepo.On("GetByUsername", username).Return(mockUser, nil).Once()
+
+		response, err := usersService.Login(username, "password")
+
+		assert.Error(t, err)
+		assert.Equal(t, "error verifying password: unknown password hash format", err.Error())
+		assert.Equal(t, domain.LoginResponse{}, response)
+
+		mainRepo.AssertExpectations(t)
+		cacheRepo.AssertExpectations(t)
+		memcachedRepo.AssertExpectations(t)
+		hasher.AssertExpectations(t)
 	})
 }